@@ -0,0 +1,152 @@
+package cardfilter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"trellomirror/backend/models"
+)
+
+// Compile turns a parsed filter into an SQL condition over cards aliased c and their list
+// aliased l. Values are passed as parameters $1, $2, …; userID resolves member:me and now
+// anchors relative due dates. A nil node compiles to TRUE.
+func Compile(n Node, userID int, now time.Time) (string, []interface{}) {
+	if n == nil {
+		return "TRUE", nil
+	}
+	c := &compiler{userID: userID, now: now}
+	return c.compile(n), c.args
+}
+
+type compiler struct {
+	userID int
+	now    time.Time
+	args   []interface{}
+}
+
+// arg adds a parameter and returns its placeholder.
+func (c *compiler) arg(v interface{}) string {
+	c.args = append(c.args, v)
+	return "$" + strconv.Itoa(len(c.args))
+}
+
+func (c *compiler) join(terms []Node, sep string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = c.compile(t)
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+func (c *compiler) compile(n Node) string {
+	switch n := n.(type) {
+	case And:
+		return c.join(n.Terms, " AND ")
+	case Or:
+		return c.join(n.Terms, " OR ")
+	case Not:
+		// A comparison with a missing value is NULL; its negation should still match.
+		return "NOT COALESCE(" + c.compile(n.Term) + ", FALSE)"
+	case Text:
+		p := c.arg("%" + escapeLike(n.Value) + "%")
+		return "(c.title ILIKE " + p + " OR COALESCE(c.description, '') ILIKE " + p + ")"
+	case Label:
+		return "EXISTS (SELECT 1 FROM card_labels fcl JOIN board_labels fbl ON fbl.id = fcl.label_id WHERE fcl.card_id = c.id AND lower(fbl.name) = lower(" + c.arg(n.Name) + "))"
+	case Member:
+		if n.Me {
+			return "EXISTS (SELECT 1 FROM card_members fcm WHERE fcm.card_id = c.id AND fcm.user_id = " + c.arg(c.userID) + ")"
+		}
+		return "EXISTS (SELECT 1 FROM card_members fcm JOIN users fu ON fu.id = fcm.user_id WHERE fcm.card_id = c.id AND lower(fu.email) = lower(" + c.arg(n.Email) + "))"
+	case List:
+		return "lower(trim(l.title)) = lower(trim(" + c.arg(n.Title) + "))"
+	case Due:
+		return c.compileDue(n)
+	case Priority:
+		return "c.priority = ANY(" + c.arg(pq.Array(priorities(n.Op, n.Priority))) + ")"
+	case Is:
+		switch n.State {
+		case "completed":
+			return "c.completed"
+		case "open":
+			return "NOT c.completed"
+		}
+		return `EXISTS (SELECT 1 FROM card_relations fr JOIN cards fb ON fb.id = fr.from_card_id JOIN lists fbl ON fbl.id = fb.list_id
+			WHERE fr.to_card_id = c.id AND fr.type = 'blocks' AND NOT fb.completed AND LOWER(TRIM(fbl.title)) <> 'done')`
+	case Has:
+		switch n.What {
+		case "due":
+			return "c.due_date IS NOT NULL"
+		case "start":
+			return "c.start_date IS NOT NULL"
+		case "label":
+			return "EXISTS (SELECT 1 FROM card_labels fcl WHERE fcl.card_id = c.id)"
+		case "member":
+			return "EXISTS (SELECT 1 FROM card_members fcm WHERE fcm.card_id = c.id)"
+		case "attachment":
+			return "EXISTS (SELECT 1 FROM attachments fa WHERE fa.card_id = c.id)"
+		case "checklist":
+			return "EXISTS (SELECT 1 FROM checklists fch WHERE fch.card_id = c.id)"
+		}
+		return "EXISTS (SELECT 1 FROM cards fk WHERE fk.parent_card_id = c.id)"
+	}
+	return "FALSE"
+}
+
+func (c *compiler) compileDue(d Due) string {
+	switch d.Kind {
+	case DueNone:
+		return "c.due_date IS NULL"
+	case DueOverdue:
+		return "(c.due_date < " + c.arg(c.now) + " AND NOT c.completed)"
+	case DueRelative:
+		at := c.arg(c.now.Add(d.Offset))
+		if d.Op == "" {
+			now := c.arg(c.now)
+			if d.Offset < 0 {
+				return "(c.due_date >= " + at + " AND c.due_date <= " + now + ")"
+			}
+			return "(c.due_date >= " + now + " AND c.due_date <= " + at + ")"
+		}
+		return "c.due_date " + d.Op + " " + at
+	}
+	start, end := d.Day, d.Day.AddDate(0, 0, 1)
+	switch d.Op {
+	case "<":
+		return "c.due_date < " + c.arg(start)
+	case "<=":
+		return "c.due_date < " + c.arg(end)
+	case ">":
+		return "c.due_date >= " + c.arg(end)
+	case ">=":
+		return "c.due_date >= " + c.arg(start)
+	}
+	return "(c.due_date >= " + c.arg(start) + " AND c.due_date < " + c.arg(end) + ")"
+}
+
+// priorities lists the priorities p compares true against, in models.Priorities order.
+func priorities(op string, p models.Priority) []string {
+	rank := func(p models.Priority) int {
+		for i, v := range models.Priorities {
+			if v == p {
+				return i
+			}
+		}
+		return -1
+	}
+	want := rank(p)
+	var out []string
+	for i, v := range models.Priorities {
+		if (op == "<" && i < want) || (op == "<=" && i <= want) || (op == ">" && i > want) ||
+			(op == ">=" && i >= want) || ((op == "" || op == "=") && i == want) {
+			out = append(out, string(v))
+		}
+	}
+	return out
+}
+
+// escapeLike escapes the LIKE wildcards in s, with Postgres' default backslash escape.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,148 @@
+package cardfilter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"trellomirror/backend/models"
+)
+
+func TestCompile(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	may31 := time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)
+	jun1 := may31.AddDate(0, 0, 1)
+	tests := []struct {
+		query string
+		sql   string
+		args  []interface{}
+	}{
+		{"", "TRUE", nil},
+		{"login", "(c.title ILIKE $1 OR COALESCE(c.description, '') ILIKE $1)", []interface{}{"%login%"}},
+		{`"50%_off\"`, "(c.title ILIKE $1 OR COALESCE(c.description, '') ILIKE $1)", []interface{}{`%50\%\_off\\%`}},
+		{"label:Bug", "EXISTS (SELECT 1 FROM card_labels fcl JOIN board_labels fbl ON fbl.id = fcl.label_id WHERE fcl.card_id = c.id AND lower(fbl.name) = lower($1))", []interface{}{"Bug"}},
+		{"member:me", "EXISTS (SELECT 1 FROM card_members fcm WHERE fcm.card_id = c.id AND fcm.user_id = $1)", []interface{}{7}},
+		{"member:ana@example.com", "EXISTS (SELECT 1 FROM card_members fcm JOIN users fu ON fu.id = fcm.user_id WHERE fcm.card_id = c.id AND lower(fu.email) = lower($1))", []interface{}{"ana@example.com"}},
+		{`list:"In Progress"`, "lower(trim(l.title)) = lower(trim($1))", []interface{}{"In Progress"}},
+
+		{"due:none", "c.due_date IS NULL", nil},
+		{"due:overdue", "(c.due_date < $1 AND NOT c.completed)", []interface{}{now}},
+		{"due:7d", "(c.due_date >= $2 AND c.due_date <= $1)", []interface{}{now.Add(7 * day), now}},
+		{"due:-2d", "(c.due_date >= $1 AND c.due_date <= $2)", []interface{}{now.Add(-2 * day), now}},
+		{"due:<48h", "c.due_date < $1", []interface{}{now.Add(48 * hour)}},
+		{"due:>=1w", "c.due_date >= $1", []interface{}{now.Add(7 * day)}},
+		{"due:2024-05-31", "(c.due_date >= $1 AND c.due_date < $2)", []interface{}{may31, jun1}},
+		{"due:<2024-05-31", "c.due_date < $1", []interface{}{may31}},
+		{"due:<=2024-05-31", "c.due_date < $1", []interface{}{jun1}},
+		{"due:>2024-05-31", "c.due_date >= $1", []interface{}{jun1}},
+		{"due:>=2024-05-31", "c.due_date >= $1", []interface{}{may31}},
+
+		{"is:completed", "c.completed", nil},
+		{"is:open", "NOT c.completed", nil},
+		{"has:due", "c.due_date IS NOT NULL", nil},
+		{"has:start", "c.start_date IS NOT NULL", nil},
+		{"has:label", "EXISTS (SELECT 1 FROM card_labels fcl WHERE fcl.card_id = c.id)", nil},
+		{"has:member", "EXISTS (SELECT 1 FROM card_members fcm WHERE fcm.card_id = c.id)", nil},
+		{"has:attachment", "EXISTS (SELECT 1 FROM attachments fa WHERE fa.card_id = c.id)", nil},
+		{"has:checklist", "EXISTS (SELECT 1 FROM checklists fch WHERE fch.card_id = c.id)", nil},
+		{"has:children", "EXISTS (SELECT 1 FROM cards fk WHERE fk.parent_card_id = c.id)", nil},
+
+		{"-has:due", "NOT COALESCE(c.due_date IS NOT NULL, FALSE)", nil},
+		{"is:open has:due", "(NOT c.completed AND c.due_date IS NOT NULL)", nil},
+		{"is:open OR has:due", "(NOT c.completed OR c.due_date IS NOT NULL)", nil},
+		// Placeholders are numbered across the whole tree.
+		{"list:a OR (list:b -member:me)",
+			"(lower(trim(l.title)) = lower(trim($1)) OR (lower(trim(l.title)) = lower(trim($2)) AND NOT COALESCE(EXISTS (SELECT 1 FROM card_members fcm WHERE fcm.card_id = c.id AND fcm.user_id = $3), FALSE)))",
+			[]interface{}{"a", "b", 7}},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.query)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.query, err)
+		}
+		sql, args := Compile(n, 7, now)
+		if sql != tt.sql {
+			t.Errorf("Compile(%q) SQL = %s, want %s", tt.query, sql, tt.sql)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("Compile(%q) args = %#v, want %#v", tt.query, args, tt.args)
+		}
+	}
+}
+
+func TestCompileBlocked(t *testing.T) {
+	n, err := Parse("is:blocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args := Compile(n, 7, time.Now())
+	for _, want := range []string{"card_relations", "fr.to_card_id = c.id", "fr.type = 'blocks'", "NOT fb.completed", "<> 'done'"} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("is:blocked SQL %q lacks %q", sql, want)
+		}
+	}
+	if args != nil {
+		t.Errorf("is:blocked args = %#v, want none", args)
+	}
+}
+
+func TestCompilePriority(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"priority:high", []string{"high"}},
+		{"priority:=none", []string{"none"}},
+		{"priority:<medium", []string{"none", "low"}},
+		{"priority:<=medium", []string{"none", "low", "medium"}},
+		{"priority:>medium", []string{"high", "urgent"}},
+		{"priority:>=high", []string{"high", "urgent"}},
+		{"priority:>urgent", nil},
+		{"priority:<none", nil},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.query)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.query, err)
+		}
+		sql, args := Compile(n, 7, time.Now())
+		if sql != "c.priority = ANY($1)" {
+			t.Errorf("Compile(%q) SQL = %s", tt.query, sql)
+		}
+		if len(args) != 1 {
+			t.Fatalf("Compile(%q) args = %#v, want one", tt.query, args)
+		}
+		got, ok := args[0].(*pq.StringArray)
+		if !ok {
+			t.Fatalf("Compile(%q) arg is %T, want *pq.StringArray", tt.query, args[0])
+		}
+		if !reflect.DeepEqual([]string(*got), tt.want) {
+			t.Errorf("Compile(%q) priorities = %v, want %v", tt.query, *got, tt.want)
+		}
+	}
+}
+
+func TestPrioritiesCoverModels(t *testing.T) {
+	var all []string
+	for _, p := range models.Priorities {
+		all = append(all, string(p))
+	}
+	if got := priorities(">=", models.PriorityNone); !reflect.DeepEqual(got, all) {
+		t.Errorf("priorities(>=, none) = %v, want %v", got, all)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	for in, want := range map[string]string{
+		"plain":  "plain",
+		"100%":   `100\%`,
+		"a_b":    `a\_b`,
+		`c:\tmp`: `c:\\tmp`,
+	} {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
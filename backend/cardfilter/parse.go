@@ -0,0 +1,393 @@
+// Package cardfilter parses the card filter language used on boards and in search, such as
+//
+//	label:bug member:me due:<7d -list:Done "login"
+//
+// into a typed syntax tree and compiles it to a parameterized SQL condition.
+//
+// Terms are separated by spaces and must all match; OR between terms and parentheses group
+// alternatives, and a leading - negates a term. A bare word or "quoted phrase" matches card
+// titles and descriptions. key:value terms are:
+//
+//	label:<name>            the card has the label (ignoring case)
+//	member:me|<email>       the user is a member of the card
+//	list:<title>            the card is in the list (ignoring case)
+//	due:none|overdue        no due date / past due and not completed
+//	due:[op]<n>h|d|w        due relative to now; without op, between now and then
+//	due:[op]YYYY-MM-DD      due on, before or after a day (UTC)
+//	priority:[op]<priority> none, low, medium, high or urgent
+//	is:completed|open|blocked
+//	has:due|start|label|member|attachment|checklist|children
+//
+// where op is one of <, <=, >, >= and =. Values with spaces are quoted: list:"In Progress".
+package cardfilter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"trellomirror/backend/models"
+)
+
+// MaxLength bounds the length of a query; MaxTerms bounds how many terms it may have.
+const (
+	MaxLength = 500
+	MaxTerms  = 30
+)
+
+// Error is a syntax or value error, pointing at the offending token.
+type Error struct {
+	Pos   int // 1-based column of the token, counted in characters
+	Token string
+	Msg   string
+}
+
+func (e *Error) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("filter: %s at column %d", e.Msg, e.Pos)
+	}
+	return fmt.Sprintf("filter: %s at column %d (%q)", e.Msg, e.Pos, e.Token)
+}
+
+// Node is a node of the syntax tree.
+type Node interface{ node() }
+
+type (
+	// And matches cards matching every term.
+	And struct{ Terms []Node }
+	// Or matches cards matching any term.
+	Or struct{ Terms []Node }
+	// Not matches cards not matching Term.
+	Not struct{ Term Node }
+
+	// Text matches cards whose title or description contains the text, ignoring case.
+	Text  struct{ Value string }
+	Label struct{ Name string }
+	// Member matches cards the user (Me) or the user with the email is a member of.
+	Member struct {
+		Me    bool
+		Email string
+	}
+	List struct{ Title string }
+	Due  struct {
+		Kind DueKind
+		Op   string
+		// Offset is relative to now for DueRelative; Day is a UTC midnight for DueDay.
+		Offset time.Duration
+		Day    time.Time
+	}
+	Priority struct {
+		Op       string
+		Priority models.Priority
+	}
+	// Is matches a card state: "completed", "open" or "blocked".
+	Is struct{ State string }
+	// Has matches cards having something: "due", "start", "label", "member", "attachment",
+	// "checklist" or "children".
+	Has struct{ What string }
+)
+
+type DueKind int
+
+const (
+	DueNone DueKind = iota
+	DueOverdue
+	DueRelative
+	DueDay
+)
+
+func (And) node()      {}
+func (Or) node()       {}
+func (Not) node()      {}
+func (Text) node()     {}
+func (Label) node()    {}
+func (Member) node()   {}
+func (List) node()     {}
+func (Due) node()      {}
+func (Priority) node() {}
+func (Is) node()       {}
+func (Has) node()      {}
+
+var (
+	isStates = []string{"completed", "open", "blocked"}
+	hasKinds = []string{"due", "start", "label", "member", "attachment", "checklist", "children"}
+)
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokNot
+	tokOr
+	tokLParen
+	tokRParen
+	tokEOF
+)
+
+type token struct {
+	kind tokenKind
+	raw  string // as typed, for error messages
+	// For words: key is the part before the first colon (empty for plain words and quoted
+	// phrases) and value the rest, unquoted.
+	key, value string
+	pos        int
+}
+
+// lex splits the query into tokens. Positions are 1-based character columns.
+func lex(q string) ([]token, error) {
+	var toks []token
+	col := func(i int) int { return utf8.RuneCountInString(q[:i]) + 1 }
+	i := 0
+	for i < len(q) {
+		c := q[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			toks = append(toks, token{kind: tokLParen, raw: "(", pos: col(i)})
+			i++
+		case c == ')':
+			toks = append(toks, token{kind: tokRParen, raw: ")", pos: col(i)})
+			i++
+		case c == '-' && i+1 < len(q) && !strings.ContainsRune(" \t\n\r)", rune(q[i+1])):
+			toks = append(toks, token{kind: tokNot, raw: "-", pos: col(i)})
+			i++
+		case c == '"':
+			end := strings.IndexByte(q[i+1:], '"')
+			if end < 0 {
+				return nil, &Error{Pos: col(i), Token: q[i:], Msg: "unterminated quote"}
+			}
+			toks = append(toks, token{kind: tokWord, raw: q[i : i+end+2], value: q[i+1 : i+1+end], pos: col(i)})
+			i += end + 2
+		default:
+			start := i
+			for i < len(q) && !strings.ContainsRune(" \t\n\r()\"", rune(q[i])) {
+				i++
+			}
+			word := q[start:i]
+			t := token{kind: tokWord, raw: word, value: word, pos: col(start)}
+			if k := strings.IndexByte(word, ':'); k > 0 {
+				t.key, t.value = strings.ToLower(word[:k]), word[k+1:]
+				// key:"quoted value"
+				if t.value == "" && i < len(q) && q[i] == '"' {
+					end := strings.IndexByte(q[i+1:], '"')
+					if end < 0 {
+						return nil, &Error{Pos: col(start), Token: q[start:], Msg: "unterminated quote"}
+					}
+					t.value = q[i+1 : i+1+end]
+					i += end + 2
+					t.raw = q[start:i]
+				}
+			} else if word == "OR" {
+				t.kind = tokOr
+			}
+			toks = append(toks, t)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: utf8.RuneCountInString(q) + 1}), nil
+}
+
+type parser struct {
+	toks  []token
+	i     int
+	terms int
+}
+
+// Parse parses a filter query. An empty query parses to nil, which matches every card.
+func Parse(q string) (Node, error) {
+	if utf8.RuneCountInString(q) > MaxLength {
+		return nil, &Error{Pos: MaxLength + 1, Msg: fmt.Sprintf("query is longer than %d characters", MaxLength)}
+	}
+	toks, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+	if toks[0].kind == tokEOF {
+		return nil, nil
+	}
+	p := &parser{toks: toks}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &Error{Pos: t.pos, Token: t.raw, Msg: "unexpected closing parenthesis"}
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (Node, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	terms := []Node{first}
+	for p.peek().kind == tokOr {
+		p.next()
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, n)
+	}
+	if len(terms) == 1 {
+		return first, nil
+	}
+	return Or{Terms: terms}, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	var terms []Node
+	for {
+		switch t := p.peek(); t.kind {
+		case tokEOF, tokRParen, tokOr:
+			if len(terms) == 0 {
+				return nil, &Error{Pos: t.pos, Token: t.raw, Msg: "expected a filter term"}
+			}
+			if len(terms) == 1 {
+				return terms[0], nil
+			}
+			return And{Terms: terms}, nil
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, n)
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNot:
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Term: n}, nil
+	case tokLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, &Error{Pos: t.pos, Token: t.raw, Msg: "unclosed parenthesis"}
+		}
+		return n, nil
+	}
+	p.terms++
+	if p.terms > MaxTerms {
+		return nil, &Error{Pos: t.pos, Token: t.raw, Msg: fmt.Sprintf("too many terms (at most %d)", MaxTerms)}
+	}
+	return parseTerm(t)
+}
+
+func parseTerm(t token) (Node, error) {
+	bad := func(msg string) error { return &Error{Pos: t.pos, Token: t.raw, Msg: msg} }
+	if t.key == "" {
+		if strings.TrimSpace(t.value) == "" {
+			return nil, bad("empty phrase")
+		}
+		return Text{Value: t.value}, nil
+	}
+	if t.value == "" {
+		return nil, bad("missing value after " + t.key + ":")
+	}
+	switch t.key {
+	case "label":
+		return Label{Name: t.value}, nil
+	case "list":
+		return List{Title: t.value}, nil
+	case "member":
+		if strings.EqualFold(t.value, "me") {
+			return Member{Me: true}, nil
+		}
+		if !strings.Contains(t.value, "@") {
+			return nil, bad("member must be me or an email address")
+		}
+		return Member{Email: t.value}, nil
+	case "due":
+		return parseDue(t.value, bad)
+	case "priority":
+		op, v := splitOp(t.value)
+		p := models.Priority(strings.ToLower(v))
+		if !models.ValidPriority(p) {
+			return nil, bad("priority must be none, low, medium, high or urgent")
+		}
+		return Priority{Op: op, Priority: p}, nil
+	case "is":
+		if v := strings.ToLower(t.value); contains(isStates, v) {
+			return Is{State: v}, nil
+		}
+		return nil, bad("is must be one of " + strings.Join(isStates, ", "))
+	case "has":
+		if v := strings.ToLower(t.value); contains(hasKinds, v) {
+			return Has{What: v}, nil
+		}
+		return nil, bad("has must be one of " + strings.Join(hasKinds, ", "))
+	}
+	return nil, bad("unknown filter " + t.key + ": (use label, member, list, due, priority, is or has)")
+}
+
+func parseDue(v string, bad func(string) error) (Node, error) {
+	switch strings.ToLower(v) {
+	case "none":
+		return Due{Kind: DueNone}, nil
+	case "overdue":
+		return Due{Kind: DueOverdue}, nil
+	}
+	op, v := splitOp(v)
+	if day, err := time.Parse("2006-01-02", v); err == nil {
+		if op == "" {
+			op = "="
+		}
+		return Due{Kind: DueDay, Op: op, Day: day}, nil
+	}
+	if len(v) < 2 {
+		return nil, bad("due must be none, overdue, a duration like 7d or a date like 2024-05-31")
+	}
+	n, err := strconv.Atoi(v[:len(v)-1])
+	if err != nil || n > 3650 || n < -3650 {
+		return nil, bad("due must be none, overdue, a duration like 7d or a date like 2024-05-31")
+	}
+	unit := map[byte]time.Duration{'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}[v[len(v)-1]]
+	if unit == 0 {
+		return nil, bad("due durations use h, d or w, such as 48h, 7d or 2w")
+	}
+	if op == "=" {
+		return nil, bad("use <, <=, > or >= with a due duration")
+	}
+	return Due{Kind: DueRelative, Op: op, Offset: time.Duration(n) * unit}, nil
+}
+
+// splitOp separates a leading comparison operator from a value.
+func splitOp(v string) (string, string) {
+	for _, op := range []string{"<=", ">=", "<", ">", "="} {
+		if strings.HasPrefix(v, op) {
+			return op, v[len(op):]
+		}
+	}
+	return "", v
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
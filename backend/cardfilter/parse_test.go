@@ -0,0 +1,205 @@
+package cardfilter
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"trellomirror/backend/models"
+)
+
+const (
+	hour = time.Hour
+	day  = 24 * time.Hour
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Node
+	}{
+		{"", nil},
+		{"  \t ", nil},
+
+		// Text
+		{"login", Text{"login"}},
+		{`"log in"`, Text{"log in"}},
+		{`"label:bug"`, Text{"label:bug"}},
+		{":foo", Text{":foo"}},
+		{"-", Text{"-"}},
+		{"a - b", And{[]Node{Text{"a"}, Text{"-"}, Text{"b"}}}},
+		{"été", Text{"été"}},
+
+		// Keys
+		{"label:bug", Label{"bug"}},
+		{"LABEL:Bug", Label{"Bug"}},
+		{`label:"needs review"`, Label{"needs review"}},
+		{"list:Done", List{"Done"}},
+		{`list:"In Progress"`, List{"In Progress"}},
+		{"member:me", Member{Me: true}},
+		{"member:ME", Member{Me: true}},
+		{"member:ana@example.com", Member{Email: "ana@example.com"}},
+		{"is:completed", Is{"completed"}},
+		{"is:Open", Is{"open"}},
+		{"is:blocked", Is{"blocked"}},
+		{"has:due", Has{"due"}},
+		{"has:start", Has{"start"}},
+		{"has:label", Has{"label"}},
+		{"has:member", Has{"member"}},
+		{"has:attachment", Has{"attachment"}},
+		{"has:checklist", Has{"checklist"}},
+		{"has:Children", Has{"children"}},
+
+		// due
+		{"due:none", Due{Kind: DueNone}},
+		{"due:Overdue", Due{Kind: DueOverdue}},
+		{"due:7d", Due{Kind: DueRelative, Offset: 7 * day}},
+		{"due:-3d", Due{Kind: DueRelative, Offset: -3 * day}},
+		{"due:<48h", Due{Kind: DueRelative, Op: "<", Offset: 48 * hour}},
+		{"due:<=1d", Due{Kind: DueRelative, Op: "<=", Offset: day}},
+		{"due:>2w", Due{Kind: DueRelative, Op: ">", Offset: 14 * day}},
+		{"due:>=-1w", Due{Kind: DueRelative, Op: ">=", Offset: -7 * day}},
+		{"due:2024-05-31", Due{Kind: DueDay, Op: "=", Day: time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)}},
+		{"due:=2024-05-31", Due{Kind: DueDay, Op: "=", Day: time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)}},
+		{"due:<2024-05-31", Due{Kind: DueDay, Op: "<", Day: time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)}},
+		{"due:>=2024-01-01", Due{Kind: DueDay, Op: ">=", Day: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}},
+
+		// priority
+		{"priority:high", Priority{Priority: models.PriorityHigh}},
+		{"priority:=none", Priority{Op: "=", Priority: models.PriorityNone}},
+		{"priority:>=Medium", Priority{Op: ">=", Priority: models.PriorityMedium}},
+		{"priority:<urgent", Priority{Op: "<", Priority: models.PriorityUrgent}},
+		{"priority:<=LOW", Priority{Op: "<=", Priority: models.PriorityLow}},
+		{"priority:>low", Priority{Op: ">", Priority: models.PriorityLow}},
+
+		// Combinations
+		{"label:bug member:me", And{[]Node{Label{"bug"}, Member{Me: true}}}},
+		{"a OR b", Or{[]Node{Text{"a"}, Text{"b"}}}},
+		{"a or b", And{[]Node{Text{"a"}, Text{"or"}, Text{"b"}}}},
+		{"a b OR c", Or{[]Node{And{[]Node{Text{"a"}, Text{"b"}}}, Text{"c"}}}},
+		{"a OR b c", Or{[]Node{Text{"a"}, And{[]Node{Text{"b"}, Text{"c"}}}}}},
+		{"a OR b OR c", Or{[]Node{Text{"a"}, Text{"b"}, Text{"c"}}}},
+		{"(a OR b) c", And{[]Node{Or{[]Node{Text{"a"}, Text{"b"}}}, Text{"c"}}}},
+		{"((a))", Text{"a"}},
+		{"(a)(b)", And{[]Node{Text{"a"}, Text{"b"}}}},
+		{"-label:bug", Not{Label{"bug"}}},
+		{"--a", Not{Not{Text{"a"}}}},
+		{`-"a b"`, Not{Text{"a b"}}},
+		{"-(a OR b)", Not{Or{[]Node{Text{"a"}, Text{"b"}}}}},
+		{`label:bug member:me due:<7d -list:Done "login"`, And{[]Node{
+			Label{"bug"},
+			Member{Me: true},
+			Due{Kind: DueRelative, Op: "<", Offset: 7 * day},
+			Not{List{"Done"}},
+			Text{"login"},
+		}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		token string
+		msg   string
+	}{
+		{`"abc`, 1, `"abc`, "unterminated quote"},
+		{`a "abc`, 3, `"abc`, "unterminated quote"},
+		{`label:"abc`, 1, `label:"abc`, "unterminated quote"},
+		{"a )", 3, ")", "unexpected closing parenthesis"},
+		{"(a", 1, "(", "unclosed parenthesis"},
+		{"a (b (c)", 3, "(", "unclosed parenthesis"},
+		{"()", 2, ")", "expected a filter term"},
+		{"OR a", 1, "OR", "expected a filter term"},
+		{"a OR", 5, "", "expected a filter term"},
+		{"a OR OR b", 6, "OR", "expected a filter term"},
+		{`""`, 1, `""`, "empty phrase"},
+		{`a "  "`, 3, `"  "`, "empty phrase"},
+		{"label:", 1, "label:", "missing value after label:"},
+		{`list:""`, 1, `list:""`, "missing value after list:"},
+		{"foo:bar", 1, "foo:bar", "unknown filter foo:"},
+		{"https://example.com", 1, "https://example.com", "unknown filter https:"},
+		{"member:bob", 1, "member:bob", "member must be me or an email address"},
+		{"due:soon", 1, "due:soon", "due must be none"},
+		{"due:d", 1, "due:d", "due must be none"},
+		{"due:99999d", 1, "due:99999d", "due must be none"},
+		{"due:7y", 1, "due:7y", "due durations use h, d or w"},
+		{"due:=7d", 1, "due:=7d", "use <, <=, > or >= with a due duration"},
+		{"due:2024-02-30", 1, "due:2024-02-30", "due must be none"},
+		{"priority:critical", 1, "priority:critical", "priority must be"},
+		{"priority:>>high", 1, "priority:>>high", "priority must be"},
+		{"is:done", 1, "is:done", "is must be one of completed, open, blocked"},
+		{"has:cover", 1, "has:cover", "has must be one of"},
+		// Columns count characters, not bytes.
+		{"été label:x foo:y", 13, "foo:y", "unknown filter foo:"},
+		{"(label:bug OR is:late)", 15, "is:late", "is must be"},
+		{"a -(b OR is:x)", 10, "is:x", "is must be"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.query)
+		var fe *Error
+		if !errors.As(err, &fe) {
+			t.Errorf("Parse(%q): got %v, want an *Error", tt.query, err)
+			continue
+		}
+		if fe.Pos != tt.pos || fe.Token != tt.token || !strings.Contains(fe.Msg, tt.msg) {
+			t.Errorf("Parse(%q) = %+v, want column %d, token %q, message containing %q", tt.query, *fe, tt.pos, tt.token, tt.msg)
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	if _, err := Parse(strings.TrimSpace(strings.Repeat("a ", MaxTerms))); err != nil {
+		t.Errorf("%d terms: %v", MaxTerms, err)
+	}
+	// Parentheses and negations are not terms.
+	if _, err := Parse("-(" + strings.TrimSpace(strings.Repeat("a ", MaxTerms)) + ")"); err != nil {
+		t.Errorf("%d terms in parentheses: %v", MaxTerms, err)
+	}
+
+	_, err := Parse(strings.Repeat("a ", MaxTerms) + "label:x")
+	var fe *Error
+	if !errors.As(err, &fe) {
+		t.Fatalf("%d terms: got %v, want an *Error", MaxTerms+1, err)
+	}
+	if fe.Pos != 2*MaxTerms+1 || fe.Token != "label:x" || !strings.Contains(fe.Msg, "too many terms") {
+		t.Errorf("%d terms: got %+v", MaxTerms+1, *fe)
+	}
+
+	if _, err := Parse(strings.Repeat("x", MaxLength)); err != nil {
+		t.Errorf("%d characters: %v", MaxLength, err)
+	}
+	if _, err := Parse(strings.Repeat("é", MaxLength)); err != nil {
+		t.Errorf("%d multibyte characters: %v", MaxLength, err)
+	}
+	_, err = Parse(strings.Repeat("x", MaxLength+1))
+	if !errors.As(err, &fe) {
+		t.Fatalf("%d characters: got %v, want an *Error", MaxLength+1, err)
+	}
+	if fe.Pos != MaxLength+1 || !strings.Contains(fe.Msg, "longer than") {
+		t.Errorf("%d characters: got %+v", MaxLength+1, *fe)
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := &Error{Pos: 3, Token: ")", Msg: "unexpected closing parenthesis"}
+	if got, want := err.Error(), `filter: unexpected closing parenthesis at column 3 (")")`; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	err = &Error{Pos: 5, Msg: "expected a filter term"}
+	if got, want := err.Error(), "filter: expected a filter term at column 5"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
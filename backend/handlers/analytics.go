@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// GetAnalyticsOverview sums up every board the user owns or is a member of: boards, lists,
+// cards, completion, overdue cards and cards per board, member and label name.
+func (h *BoardHandler) GetAnalyticsOverview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	overview, err := h.Analytics.Overview(r.Context().Value("userID").(int))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(overview)
+}
+
+// GetBoardAnalytics sums up one board: cards, completion and overdue cards per list, member
+// and label.
+func (h *BoardHandler) GetBoardAnalytics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := h.Analytics.BoardAnalytics(board.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,504 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+	"trellomirror/backend/storage"
+	"trellomirror/backend/thumbnail"
+)
+
+var attachmentMaxBytes = func() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return 10 << 20
+}()
+
+// attachmentTypes lists the sniffed MIME types accepted for upload. SVG and HTML are left out
+// on purpose: served back from our origin they could run scripts.
+var attachmentTypes = func() map[string]bool {
+	raw := os.Getenv("ATTACHMENT_ALLOWED_TYPES")
+	if raw == "" {
+		raw = "image/png,image/jpeg,image/gif,image/webp,application/pdf,text/plain,application/zip"
+	}
+	types := map[string]bool{}
+	for _, t := range strings.Split(raw, ",") {
+		if t = strings.TrimSpace(strings.ToLower(t)); t != "" {
+			types[t] = true
+		}
+	}
+	return types
+}()
+
+// sanitizeFilename keeps the base name of an uploaded file without control characters.
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' || r == '\\' {
+			return -1
+		}
+		return r
+	}, filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	if runes := []rune(name); len(runes) > 255 {
+		name = string(runes[len(runes)-255:])
+	}
+	return name
+}
+
+// thumbnailKey names the blob holding one size of an image's thumbnail. Thumbnails follow
+// the content hash, so duplicate uploads share them too.
+func thumbnailKey(hash string, size thumbnail.Size) string {
+	return hash + "-" + size.Name
+}
+
+// thumbnailURL is where clients fetch a size of the attachment's thumbnail. The URL is signed
+// so that it works as an <img src>, which cannot send the Authorization header. It expires at
+// the end of the next UTC day: a board reloaded on the same day gets the same URLs, which keeps
+// the browser cache useful.
+func thumbnailURL(attachmentID int, size thumbnail.Size) string {
+	expires := time.Now().UTC().Truncate(24 * time.Hour).Add(48 * time.Hour).Unix()
+	return "/api/attachments/" + strconv.Itoa(attachmentID) + "/thumbnail?size=" + size.Name +
+		"&expires=" + strconv.FormatInt(expires, 10) + "&sig=" + thumbnailSignature(attachmentID, size.Name, expires)
+}
+
+// thumbnailKeyBytes signs thumbnail URLs. It is derived from jwtSecret rather than being
+// jwtSecret itself, so a thumbnail signature is never a MAC under the key that signs logins.
+var thumbnailKeyBytes = func() []byte {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte("thumbnail-url"))
+	return mac.Sum(nil)
+}()
+
+func thumbnailSignature(attachmentID int, size string, expires int64) string {
+	mac := hmac.New(sha256.New, thumbnailKeyBytes)
+	mac.Write([]byte("thumbnail:" + strconv.Itoa(attachmentID) + ":" + size + ":" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validThumbnailURL checks the signature and expiry of a thumbnail request.
+func validThumbnailURL(attachmentID int, size string, r *http.Request) bool {
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	sig := r.URL.Query().Get("sig")
+	return hmac.Equal([]byte(sig), []byte(thumbnailSignature(attachmentID, size, expires)))
+}
+
+func withThumbnailURL(a *models.Attachment) {
+	if thumbnail.Supported(a.MimeType) {
+		a.ThumbnailURL = thumbnailURL(a.ID, thumbnail.Small)
+	}
+}
+
+// thumbnailRenders bounds how many images are decoded at once. An image can be up to
+// thumbnail.MaxPixels, and GetAttachmentThumbnail renders on a route that needs no login.
+var thumbnailRenders = make(chan struct{}, 2)
+
+// storeThumbnails renders every thumbnail size of the image in r and stores them. Callers
+// hold a thumbnailRenders slot.
+func (h *BoardHandler) storeThumbnails(hash string, r io.ReadSeeker) error {
+	images, _, err := thumbnail.Generate(r, thumbnail.Sizes...)
+	if err != nil {
+		return err
+	}
+	for i, size := range thumbnail.Sizes {
+		if err := h.Blobs.Put(thumbnailKey(hash, size), bytes.NewReader(images[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachmentForMember loads the attachment from the {id} route variable with its card's
+// board id, and writes the error response itself when the caller cannot access it.
+func (h *BoardHandler) attachmentForMember(w http.ResponseWriter, r *http.Request) (*models.Attachment, int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid attachment id", http.StatusBadRequest)
+		return nil, 0, false
+	}
+	a, err := h.Attachments.GetAttachmentByID(id)
+	if err != nil {
+		http.Error(w, "attachment not found", http.StatusNotFound)
+		return nil, 0, false
+	}
+	card, err := h.Cards.GetCardByID(a.CardID)
+	if err != nil {
+		http.Error(w, "card not found", http.StatusNotFound)
+		return nil, 0, false
+	}
+	boardID := h.cardBoardID(card)
+	if boardID == nil || !h.canAccessBoard(*boardID, r.Context().Value("userID").(int)) {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return nil, 0, false
+	}
+	return a, *boardID, true
+}
+
+func (h *BoardHandler) GetCardAttachments(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, _, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	attachments, err := h.Attachments.GetAttachmentsByCard(card.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if attachments == nil {
+		attachments = []models.Attachment{}
+	}
+	for i := range attachments {
+		withThumbnailURL(&attachments[i])
+	}
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// UploadAttachment accepts a multipart form with a "file" field. The file is spooled to a
+// temporary file while it is hashed; its type is sniffed from the content, not taken from
+// the client. Identical content is stored once, under its SHA-256. Thumbnails of PNG, JPEG
+// and GIF images are rendered with the first upload of the content; failing to render them
+// does not fail the upload.
+func (h *BoardHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(int)
+
+	// Leave room for the multipart framing around the file itself.
+	r.Body = http.MaxBytesReader(w, r.Body, attachmentMaxBytes+64<<10)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+	var part io.ReadCloser
+	var filename string
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			http.Error(w, "missing file field", http.StatusBadRequest)
+			return
+		}
+		if p.FormName() == "file" {
+			part, filename = p, sanitizeFilename(p.FileName())
+			break
+		}
+		p.Close()
+	}
+	defer part.Close()
+
+	tmp, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), io.LimitReader(part, attachmentMaxBytes+1))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || size > attachmentMaxBytes {
+		http.Error(w, "file exceeds "+strconv.FormatInt(attachmentMaxBytes, 10)+" bytes", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "could not read upload", http.StatusBadRequest)
+		return
+	}
+	if size == 0 {
+		http.Error(w, "file is empty", http.StatusBadRequest)
+		return
+	}
+
+	head := make([]byte, 512)
+	n, _ := tmp.ReadAt(head, 0)
+	mimeType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if !attachmentTypes[mimeType] {
+		http.Error(w, "file type "+mimeType+" is not allowed", http.StatusUnsupportedMediaType)
+		return
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	var attachment *models.Attachment
+	err = h.inTx(func(tx *BoardHandler) error {
+		if err := tx.Attachments.LockHash(hash); err != nil {
+			return err
+		}
+		exists, err := h.Blobs.Exists(hash)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			if err := h.Blobs.Put(hash, tmp); err != nil {
+				return err
+			}
+			if thumbnail.Supported(mimeType) {
+				if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+					return err
+				}
+				thumbnailRenders <- struct{}{}
+				err := h.storeThumbnails(hash, tmp)
+				<-thumbnailRenders
+				if err != nil {
+					log.Printf("thumbnails for %s: %v", hash, err)
+				}
+			}
+		}
+		attachment, err = tx.Attachments.CreateAttachment(&models.Attachment{
+			CardID:      card.ID,
+			UploaderID:  userID,
+			Filename:    filename,
+			MimeType:    mimeType,
+			Size:        size,
+			ContentHash: hash,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			CardID:  &card.ID,
+			UserID:  userID,
+			Action:  models.ActionAddAttachment,
+			Details: "attached " + filename,
+			Refs:    map[string]int{"board": boardID, "card": card.ID, "attachment": attachment.ID},
+			After:   map[string]interface{}{"attachment_id": attachment.ID, "filename": filename, "size": size},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	withThumbnailURL(attachment)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// DownloadAttachment streams the file. Images and PDFs are shown inline with ?inline=true.
+func (h *BoardHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	a, _, ok := h.attachmentForMember(w, r)
+	if !ok {
+		return
+	}
+
+	rc, err := h.Blobs.Get(a.ContentHash)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "attachment content is missing", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	disposition := "attachment"
+	if r.URL.Query().Get("inline") == "true" && (strings.HasPrefix(a.MimeType, "image/") || a.MimeType == "application/pdf") {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", a.MimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, rc); err != nil {
+		log.Printf("download of attachment %d: %v", a.ID, err)
+	}
+}
+
+// GetAttachmentThumbnail serves the ?size=small (default) or ?size=cover thumbnail of an
+// image attachment. It sits outside the authenticated routes: the URL handed out by
+// thumbnailURL carries its own signature instead. Thumbnails missing because the image
+// predates them, or because the blob store lost them, are rendered on demand.
+func (h *BoardHandler) GetAttachmentThumbnail(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid attachment id", http.StatusBadRequest)
+		return
+	}
+	size := thumbnail.Small
+	if name := r.URL.Query().Get("size"); name != "" {
+		var ok bool
+		if size, ok = thumbnail.SizeByName(name); !ok {
+			http.Error(w, "size must be small or cover", http.StatusBadRequest)
+			return
+		}
+	}
+	if !validThumbnailURL(id, size.Name, r) {
+		http.Error(w, "invalid or expired thumbnail link", http.StatusForbidden)
+		return
+	}
+	a, err := h.Attachments.GetAttachmentByID(id)
+	if err != nil {
+		http.Error(w, "attachment not found", http.StatusNotFound)
+		return
+	}
+	if !thumbnail.Supported(a.MimeType) {
+		http.Error(w, "attachment has no thumbnail", http.StatusNotFound)
+		return
+	}
+
+	key := thumbnailKey(a.ContentHash, size)
+	exists, err := h.Blobs.Exists(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		// Rather than queueing decodes behind a full semaphore, ask the client to come back.
+		select {
+		case thumbnailRenders <- struct{}{}:
+		default:
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "thumbnail is being rendered, try again shortly", http.StatusServiceUnavailable)
+			return
+		}
+		err := h.inTx(func(tx *BoardHandler) error {
+			if err := tx.Attachments.LockHash(a.ContentHash); err != nil {
+				return err
+			}
+			rc, err := h.Blobs.Get(a.ContentHash)
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			original, err := io.ReadAll(rc)
+			if err != nil {
+				return err
+			}
+			return h.storeThumbnails(a.ContentHash, bytes.NewReader(original))
+		})
+		<-thumbnailRenders
+		if err != nil {
+			log.Printf("thumbnails for attachment %d: %v", a.ID, err)
+			http.Error(w, "thumbnail not available", http.StatusNotFound)
+			return
+		}
+	}
+
+	rc, err := h.Blobs.Get(key)
+	if err != nil {
+		http.Error(w, "thumbnail not available", http.StatusNotFound)
+		return
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(data)
+}
+
+// DeleteAttachment is allowed to the uploader and the board owner. The blob is removed with
+// the last attachment referencing it, together with its thumbnails. A card using it as its
+// cover falls back to its cover color.
+func (h *BoardHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	a, boardID, ok := h.attachmentForMember(w, r)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(int)
+
+	if a.UploaderID != userID {
+		board, err := h.Boards.GetBoardByID(boardID)
+		if err != nil || board.UserID != userID {
+			http.Error(w, "only the uploader or the board owner can delete this attachment", http.StatusForbidden)
+			return
+		}
+	}
+
+	var orphaned bool
+	err := h.inTx(func(tx *BoardHandler) error {
+		if err := tx.Attachments.LockHash(a.ContentHash); err != nil {
+			return err
+		}
+		if err := tx.Attachments.DeleteAttachment(a.ID); err != nil {
+			return err
+		}
+		_, err := tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			CardID:  &a.CardID,
+			UserID:  userID,
+			Action:  models.ActionRemoveAttachment,
+			Details: "removed the attachment " + a.Filename,
+			Refs:    map[string]int{"board": boardID, "card": a.CardID, "attachment": a.ID},
+			Before:  map[string]interface{}{"attachment_id": a.ID, "filename": a.Filename, "size": a.Size},
+		})
+		if err != nil {
+			return err
+		}
+		inUse, err := tx.Attachments.HashInUse(a.ContentHash)
+		orphaned = !inUse
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if orphaned {
+		// The row is gone either way; a blob that fails to delete is only wasted space.
+		if err := h.deleteBlobs(a.ContentHash); err != nil {
+			log.Printf("deleting blobs for %s: %v", a.ContentHash, err)
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Attachment deleted"})
+}
+
+// deleteBlobs removes the content and thumbnails stored under hash once no attachment
+// references it. It runs after the deleting transaction has committed, so a rollback never
+// leaves rows pointing at missing blobs, and re-checks under the hash lock in case an upload
+// of the same content claimed the blob in between.
+func (h *BoardHandler) deleteBlobs(hash string) error {
+	return h.inTx(func(tx *BoardHandler) error {
+		if err := tx.Attachments.LockHash(hash); err != nil {
+			return err
+		}
+		inUse, err := tx.Attachments.HashInUse(hash)
+		if err != nil || inUse {
+			return err
+		}
+		for _, size := range thumbnail.Sizes {
+			if err := h.Blobs.Delete(thumbnailKey(hash, size)); err != nil {
+				return err
+			}
+		}
+		return h.Blobs.Delete(hash)
+	})
+}
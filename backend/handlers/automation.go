@@ -0,0 +1,714 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+// maxAutomationDepth bounds how many rule-caused events can chain from one change.
+const maxAutomationDepth = 5
+
+var errConditionsNotMet = errors.New("conditions not met")
+
+type automationEvent struct {
+	Trigger models.TriggerType
+	BoardID int
+	CardID  int
+	ListID  int
+	Tag     string
+	depth   int
+}
+
+// runAutomations evaluates the board's rules for events caused by actorID, then for every
+// event their actions cause in turn. It runs after the triggering change has committed;
+// each rule executes in its own transaction and failures only land in the execution log.
+// A rule runs at most once per card per chain, which stops rules from re-triggering
+// each other forever.
+func (h *BoardHandler) runAutomations(actorID int, events ...automationEvent) {
+	fired := map[[2]int]bool{}
+	for len(events) > 0 {
+		ev := events[0]
+		events = events[1:]
+
+		rules, err := h.Automations.GetEnabledRules(ev.BoardID, ev.Trigger)
+		if err != nil {
+			log.Printf("automation: loading rules for board %d: %v", ev.BoardID, err)
+			continue
+		}
+		for i := range rules {
+			rule := &rules[i]
+			if !triggerMatches(rule.Trigger, ev) {
+				continue
+			}
+			cardID := ev.CardID
+			run := models.AutomationRun{
+				RuleID:   &rule.ID,
+				RuleName: rule.Name,
+				BoardID:  ev.BoardID,
+				CardID:   &cardID,
+				Trigger:  ev.Trigger,
+				Depth:    ev.depth,
+			}
+			key := [2]int{rule.ID, ev.CardID}
+			if fired[key] || ev.depth >= maxAutomationDepth {
+				run.Status = models.RunSkipped
+				run.Error = "loop protection: rule already ran on this card in this chain"
+				if !fired[key] {
+					run.Error = fmt.Sprintf("loop protection: chain deeper than %d rules", maxAutomationDepth)
+				}
+				h.logAutomationRun(run)
+				continue
+			}
+
+			var follow []automationEvent
+			err := h.inTx(func(tx *BoardHandler) error {
+				var err error
+				run.Actions, follow, err = tx.applyRule(actorID, rule, ev.CardID)
+				if err != nil {
+					return err
+				}
+				run.Status = models.RunSucceeded
+				return tx.Automations.LogRun(run)
+			})
+			if err == errConditionsNotMet {
+				continue
+			}
+			fired[key] = true
+			if err != nil {
+				run.Status, run.Error, run.Actions = models.RunFailed, err.Error(), nil
+				h.logAutomationRun(run)
+				continue
+			}
+			for j := range follow {
+				follow[j].depth = ev.depth + 1
+			}
+			events = append(events, follow...)
+		}
+	}
+}
+
+func (h *BoardHandler) logAutomationRun(run models.AutomationRun) {
+	if err := h.Automations.LogRun(run); err != nil {
+		log.Printf("automation: logging run of rule %s: %v", run.RuleName, err)
+	}
+}
+
+// FireDueDateAutomations runs due_date_reached rules for a card claimed by the scheduler,
+// acting as the board owner.
+func (h *BoardHandler) FireDueDateAutomations(t models.DueTrigger) {
+	h.runAutomations(t.BoardOwnerID, automationEvent{
+		Trigger: models.TriggerDueDateReached,
+		BoardID: t.BoardID,
+		CardID:  t.CardID,
+	})
+}
+
+func triggerMatches(t models.AutomationTrigger, ev automationEvent) bool {
+	switch t.Type {
+	case models.TriggerCardMoved, models.TriggerCardCreated:
+		return t.ListID == nil || *t.ListID == ev.ListID
+	case models.TriggerTagAdded:
+		return t.Tag == "" || strings.EqualFold(t.Tag, ev.Tag)
+	}
+	return true
+}
+
+func conditionsMet(conditions []models.AutomationCondition, card *models.Card, tags []models.CardTag) bool {
+	hasTag := func(name string) bool {
+		for _, t := range tags {
+			if strings.EqualFold(t.Name, name) {
+				return true
+			}
+		}
+		return false
+	}
+	hasMember := func(userID *int) bool {
+		for _, m := range card.Members {
+			if userID == nil || m.UserID == *userID {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, c := range conditions {
+		var ok bool
+		switch c.Type {
+		case models.ConditionInList:
+			ok = card.ListID == *c.ListID
+		case models.ConditionNotInList:
+			ok = card.ListID != *c.ListID
+		case models.ConditionHasTag:
+			ok = hasTag(c.Tag)
+		case models.ConditionLacksTag:
+			ok = !hasTag(c.Tag)
+		case models.ConditionHasMember:
+			ok = hasMember(c.UserID)
+		case models.ConditionNoMembers:
+			ok = len(card.Members) == 0
+		case models.ConditionHasDueDate:
+			ok = card.DueDate != nil
+		case models.ConditionNoDueDate:
+			ok = card.DueDate == nil
+		case models.ConditionTitleContains:
+			ok = strings.Contains(strings.ToLower(card.Title), strings.ToLower(c.Value))
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// applyRule locks the card, checks the rule's conditions against its current state and
+// applies the actions in order. It returns a summary of what changed and the events the
+// changes raise.
+func (h *BoardHandler) applyRule(actorID int, rule *models.AutomationRule, cardID int) ([]string, []automationEvent, error) {
+	if err := h.Cards.LockCard(cardID); err != nil {
+		return nil, nil, err
+	}
+	card, err := h.Cards.GetCardByID(cardID)
+	if err != nil {
+		return nil, nil, err
+	}
+	tags, err := h.CardTags.GetTagsByCard(cardID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !conditionsMet(rule.Conditions, card, tags) {
+		return nil, nil, errConditionsNotMet
+	}
+
+	var summary []string
+	var follow []automationEvent
+	for _, a := range rule.Actions {
+		done, next, err := h.applyAutomationAction(actorID, rule, card, a)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", a.Type, err)
+		}
+		summary = append(summary, done...)
+		follow = append(follow, next...)
+		if card, err = h.Cards.GetCardByID(cardID); err != nil {
+			return nil, nil, err
+		}
+	}
+	return summary, follow, nil
+}
+
+// logAutomation records an activity for a change made by a rule, with the same payload a
+// manual change would carry so it can be undone.
+func (h *BoardHandler) logAutomation(actorID int, rule *models.AutomationRule, card *models.Card, action models.ActionType, details string, refs map[string]int, before, after interface{}) error {
+	if refs == nil {
+		refs = map[string]int{}
+	}
+	refs["board"], refs["card"], refs["rule"] = rule.BoardID, card.ID, rule.ID
+	_, err := h.Activities.Log(models.ActivityEntry{
+		BoardID: &rule.BoardID,
+		CardID:  &card.ID,
+		UserID:  actorID,
+		Action:  action,
+		Details: details + " (automation \"" + rule.Name + "\")",
+		Refs:    refs,
+		Before:  before,
+		After:   after,
+	})
+	return err
+}
+
+func (h *BoardHandler) userEmail(userID int) string {
+	u, err := h.Users.GetUserByID(userID)
+	if err != nil {
+		return "someone"
+	}
+	return u.Email
+}
+
+func (h *BoardHandler) applyAutomationAction(actorID int, rule *models.AutomationRule, card *models.Card, a models.AutomationAction) ([]string, []automationEvent, error) {
+	switch a.Type {
+	case models.AutomationMoveToList:
+		if card.ListID == *a.ListID {
+			return nil, nil, nil
+		}
+		target, err := h.Lists.GetListByID(*a.ListID)
+		if err != nil || target.BoardID != rule.BoardID {
+			return nil, nil, fmt.Errorf("list %d is not on this board", *a.ListID)
+		}
+		blockers, err := h.startBlockers(card.ID, target.ID, card.Completed)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(blockers) > 0 {
+			return nil, nil, &blockedError{blockers}
+		}
+		wipWarning, err := h.Lists.EnterList(target.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		existing, err := h.Cards.GetCardsByList(target.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		moved, err := h.Cards.UpdateCard(card.ID, card.Title, card.Description, card.Badge, card.Color, target.ID, len(existing), card.DueDate)
+		if err != nil {
+			return nil, nil, err
+		}
+		details := "moved this card to " + target.Title
+		if from, err := h.Lists.GetListByID(card.ListID); err == nil {
+			details = "moved this card from " + from.Title + " to " + target.Title
+		}
+		err = h.logAutomation(actorID, rule, card, models.ActionMoveCard, details, nil,
+			map[string]interface{}{"list_id": card.ListID, "position": card.Position},
+			map[string]interface{}{"list_id": moved.ListID, "position": moved.Position},
+		)
+		next := automationEvent{Trigger: models.TriggerCardMoved, BoardID: rule.BoardID, CardID: card.ID, ListID: target.ID}
+		done := "moved to " + target.Title
+		if wipWarning != "" {
+			done += " (over its WIP limit, " + wipWarning + ")"
+		}
+		return []string{done}, []automationEvent{next}, err
+
+	case models.AutomationAssignMember:
+		if !h.canAccessBoard(rule.BoardID, *a.UserID) {
+			return nil, nil, fmt.Errorf("user %d is not a board member", *a.UserID)
+		}
+		added, err := h.CardMembers.AddMember(card.ID, *a.UserID)
+		if err != nil || !added {
+			return nil, nil, err
+		}
+		email := h.userEmail(*a.UserID)
+		err = h.logAutomation(actorID, rule, card, models.ActionAddCardMember, "assigned "+email+" to this card",
+			map[string]int{"user": *a.UserID}, nil, map[string]interface{}{"user_id": *a.UserID})
+		if err != nil {
+			return nil, nil, err
+		}
+		err = h.Notifications.Notify(models.Notification{
+			UserID:  *a.UserID,
+			ActorID: &actorID,
+			Type:    models.NotificationCardAssigned,
+			BoardID: &rule.BoardID,
+			CardID:  &card.ID,
+			Message: "assigned you to \"" + card.Title + "\"",
+		})
+		return []string{"assigned " + email}, nil, err
+
+	case models.AutomationRemoveMember:
+		var done []string
+		for _, m := range card.Members {
+			if a.UserID != nil && m.UserID != *a.UserID {
+				continue
+			}
+			removed, err := h.CardMembers.RemoveMember(card.ID, m.UserID)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !removed {
+				continue
+			}
+			email := h.userEmail(m.UserID)
+			err = h.logAutomation(actorID, rule, card, models.ActionRemoveCardMember, "removed "+email+" from this card",
+				map[string]int{"user": m.UserID}, map[string]interface{}{"user_id": m.UserID}, nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			done = append(done, "removed "+email)
+		}
+		return done, nil, nil
+
+	case models.AutomationAddTag:
+		name, color := strings.TrimSpace(a.Tag), a.Color
+		if !isLabelColor(color) {
+			color = "primary"
+		}
+		label, err := h.Labels.EnsureLabel(rule.BoardID, name, color)
+		if err != nil {
+			return nil, nil, err
+		}
+		tag, added, err := h.CardTags.AddTag(card.ID, label.ID)
+		if err != nil || !added {
+			return nil, nil, err
+		}
+		err = h.logAutomation(actorID, rule, card, models.ActionAddTag, "added the tag "+tag.Name,
+			map[string]int{"label": tag.ID}, nil,
+			map[string]interface{}{"label_id": tag.ID, "name": tag.Name, "color": tag.Color},
+		)
+		next := automationEvent{Trigger: models.TriggerTagAdded, BoardID: rule.BoardID, CardID: card.ID, Tag: tag.Name}
+		return []string{"tagged " + tag.Name}, []automationEvent{next}, err
+
+	case models.AutomationRemoveTag:
+		tags, err := h.CardTags.GetTagsByCard(card.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		var done []string
+		for _, t := range tags {
+			if !strings.EqualFold(t.Name, strings.TrimSpace(a.Tag)) {
+				continue
+			}
+			if err := h.CardTags.RemoveTag(card.ID, t.ID); err != nil {
+				return nil, nil, err
+			}
+			err = h.logAutomation(actorID, rule, card, models.ActionRemoveTag, "removed the tag "+t.Name,
+				map[string]int{"label": t.ID}, map[string]interface{}{"label_id": t.ID, "name": t.Name, "color": t.Color}, nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			done = append(done, "untagged "+t.Name)
+		}
+		return done, nil, nil
+
+	case models.AutomationAddComment:
+		comment, err := h.CardComments.AddComment(card.ID, actorID, strings.TrimSpace(a.Text))
+		if err != nil {
+			return nil, nil, err
+		}
+		err = h.logAutomation(actorID, rule, card, models.ActionAddComment, "commented on this card",
+			map[string]int{"comment": comment.ID}, nil,
+			map[string]interface{}{"comment_id": comment.ID, "content": comment.Content},
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, m := range card.Members {
+			err := h.Notifications.Notify(models.Notification{
+				UserID:  m.UserID,
+				ActorID: &actorID,
+				Type:    models.NotificationCardComment,
+				BoardID: &rule.BoardID,
+				CardID:  &card.ID,
+				Message: "commented on \"" + card.Title + "\"",
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return []string{"commented"}, nil, nil
+
+	case models.AutomationSetDueDate:
+		var due *time.Time
+		if a.DueIn != "" {
+			d, err := models.ParseDueIn(a.DueIn)
+			if err != nil {
+				return nil, nil, err
+			}
+			t := time.Now().Add(d).UTC().Truncate(time.Minute)
+			due = &t
+		}
+		if sameTime(card.DueDate, due) {
+			return nil, nil, nil
+		}
+		if due != nil && card.StartDate != nil && !card.StartDate.Before(*due) {
+			return nil, nil, fmt.Errorf("the card starts on %s, not before the new due date %s",
+				card.StartDate.UTC().Format(time.RFC3339), due.Format(time.RFC3339))
+		}
+		if _, err := h.Cards.UpdateCard(card.ID, card.Title, card.Description, card.Badge, card.Color, card.ListID, card.Position, due); err != nil {
+			return nil, nil, err
+		}
+		details, done := "removed the due date", "cleared the due date"
+		if due != nil {
+			details = "set the due date to " + due.Format("Jan 2, 2006 15:04")
+			done = "due " + due.Format(time.RFC3339)
+		}
+		err := h.logAutomation(actorID, rule, card, models.ActionUpdateDueDate, details, nil,
+			map[string]interface{}{"due_date": card.DueDate},
+			map[string]interface{}{"due_date": due},
+		)
+		return []string{done}, nil, err
+	}
+	return nil, nil, fmt.Errorf("unknown action type %q", a.Type)
+}
+
+// boardForMember loads the board from the {id} route variable and writes the error response
+// itself when the board is missing or the caller cannot access it.
+func (h *BoardHandler) boardForMember(w http.ResponseWriter, r *http.Request) (*models.Board, bool) {
+	boardID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || boardID <= 0 {
+		http.Error(w, "invalid board id", http.StatusBadRequest)
+		return nil, false
+	}
+	board, err := h.Boards.GetBoardByID(boardID)
+	if err != nil {
+		http.Error(w, "board not found", http.StatusNotFound)
+		return nil, false
+	}
+	if !h.canAccessBoard(boardID, r.Context().Value("userID").(int)) {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return nil, false
+	}
+	return board, true
+}
+
+// validateRuleRefs checks that every list a rule names is on its board and every user it
+// names can access the board.
+func (h *BoardHandler) validateRuleRefs(rule *models.AutomationRule) error {
+	var lists, users []*int
+	lists = append(lists, rule.Trigger.ListID)
+	for _, c := range rule.Conditions {
+		lists = append(lists, c.ListID)
+		users = append(users, c.UserID)
+	}
+	for _, a := range rule.Actions {
+		lists = append(lists, a.ListID)
+		users = append(users, a.UserID)
+	}
+	for _, id := range lists {
+		if id == nil {
+			continue
+		}
+		l, err := h.Lists.GetListByID(*id)
+		if err != nil || l.BoardID != rule.BoardID {
+			return fmt.Errorf("list %d is not on this board", *id)
+		}
+	}
+	for _, id := range users {
+		if id != nil && !h.canAccessBoard(rule.BoardID, *id) {
+			return fmt.Errorf("user %d is not a board member", *id)
+		}
+	}
+	return nil
+}
+
+func (h *BoardHandler) ListAutomations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := h.Automations.GetRulesByBoard(board.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rules == nil {
+		rules = []models.AutomationRule{}
+	}
+	json.NewEncoder(w).Encode(rules)
+}
+
+func (h *BoardHandler) CreateAutomation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(int)
+
+	var body struct {
+		Name       string                       `json:"name"`
+		Trigger    models.AutomationTrigger     `json:"trigger"`
+		Conditions []models.AutomationCondition `json:"conditions"`
+		Actions    []models.AutomationAction    `json:"actions"`
+		Enabled    *bool                        `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	rule := &models.AutomationRule{
+		BoardID:    board.ID,
+		Name:       strings.TrimSpace(body.Name),
+		Trigger:    body.Trigger,
+		Conditions: body.Conditions,
+		Actions:    body.Actions,
+		Enabled:    body.Enabled == nil || *body.Enabled,
+		CreatedBy:  userID,
+	}
+	if err := rule.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validateRuleRefs(rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var created *models.AutomationRule
+	err := h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if created, err = tx.Automations.CreateRule(rule); err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionCreateAutomation,
+			Details: "added the automation \"" + created.Name + "\"",
+			Refs:    map[string]int{"board": board.ID, "rule": created.ID},
+			After:   created,
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *BoardHandler) UpdateAutomation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	ruleID, err := strconv.Atoi(mux.Vars(r)["ruleId"])
+	if err != nil || ruleID <= 0 {
+		http.Error(w, "invalid rule id", http.StatusBadRequest)
+		return
+	}
+	rule, err := h.Automations.GetRuleByID(ruleID)
+	if err != nil || rule.BoardID != board.ID {
+		http.Error(w, "rule not found", http.StatusNotFound)
+		return
+	}
+
+	var body struct {
+		Name       *string                       `json:"name"`
+		Trigger    *models.AutomationTrigger     `json:"trigger"`
+		Conditions *[]models.AutomationCondition `json:"conditions"`
+		Actions    *[]models.AutomationAction    `json:"actions"`
+		Enabled    *bool                         `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	before := *rule
+	if body.Name != nil {
+		rule.Name = strings.TrimSpace(*body.Name)
+	}
+	if body.Trigger != nil {
+		rule.Trigger = *body.Trigger
+	}
+	if body.Conditions != nil {
+		rule.Conditions = *body.Conditions
+	}
+	if body.Actions != nil {
+		rule.Actions = *body.Actions
+	}
+	if body.Enabled != nil {
+		rule.Enabled = *body.Enabled
+	}
+	if err := rule.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validateRuleRefs(rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var updated *models.AutomationRule
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if updated, err = tx.Automations.UpdateRule(rule); err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionEditAutomation,
+			Details: "edited the automation \"" + updated.Name + "\"",
+			Refs:    map[string]int{"board": board.ID, "rule": rule.ID},
+			Before:  before,
+			After:   updated,
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *BoardHandler) DeleteAutomation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	ruleID, err := strconv.Atoi(mux.Vars(r)["ruleId"])
+	if err != nil || ruleID <= 0 {
+		http.Error(w, "invalid rule id", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var deleted bool
+	err = h.inTx(func(tx *BoardHandler) error {
+		rule, err := tx.Automations.GetRuleByID(ruleID)
+		if err == sql.ErrNoRows || (err == nil && rule.BoardID != board.ID) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if deleted, err = tx.Automations.DeleteRule(board.ID, ruleID); err != nil || !deleted {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionDeleteAutomation,
+			Details: "deleted the automation \"" + rule.Name + "\"",
+			Refs:    map[string]int{"board": board.ID, "rule": ruleID},
+			Before:  rule,
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "rule not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Rule deleted"})
+}
+
+func (h *BoardHandler) ListAutomationRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var ruleID *int
+	if v := r.URL.Query().Get("rule_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid rule id", http.StatusBadRequest)
+			return
+		}
+		ruleID = &id
+	}
+	limit := queryInt(r, "limit", 50)
+	if limit == 0 || limit > 200 {
+		limit = 50
+	}
+
+	runs, err := h.Automations.GetRunsByBoard(board.ID, ruleID, limit, queryInt(r, "offset", 0))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if runs == nil {
+		runs = []models.AutomationRun{}
+	}
+	json.NewEncoder(w).Encode(runs)
+}
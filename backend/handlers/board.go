@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,32 +11,106 @@ import (
 
 	"github.com/gorilla/mux"
 	"trellomirror/backend/models"
+	"trellomirror/backend/storage"
+	"trellomirror/backend/thumbnail"
 )
 
 type BoardHandler struct {
-	Boards       *models.BoardService
-	Lists        *models.ListService
-	Cards        *models.CardService
-	BoardMembers *models.BoardMemberService
-	Users        *models.UserService
-	CardTags     *models.CardTagService
-	CardComments *models.CardCommentService
-	CardMembers  *models.CardMemberService
-	Activities   *models.ActivityService
+	DB            *sql.DB
+	Boards        *models.BoardService
+	Lists         *models.ListService
+	Cards         *models.CardService
+	BoardMembers  *models.BoardMemberService
+	Users         *models.UserService
+	CardTags      *models.CardTagService
+	Labels        *models.LabelService
+	CardComments  *models.CardCommentService
+	CardMembers   *models.CardMemberService
+	Activities    *models.ActivityService
+	Notifications *models.NotificationService
+	Webhooks      *models.WebhookService
+	Automations   *models.AutomationService
+	Recurrences   *models.RecurrenceService
+	Checklists    *models.ChecklistService
+	Attachments   *models.AttachmentService
+	CustomFields  *models.CustomFieldService
+	Relations     *models.CardRelationService
+	Search        *models.SearchService
+	SavedFilters  *models.SavedFilterService
+	Analytics     *models.AnalyticsService
+	FlowMetrics   *models.FlowMetricsService
+	Sprints       *models.SprintService
+	TimeEntries   *models.TimeEntryService
+	Templates     *models.TemplateService
+
+	// Blobs holds attachment contents; it is not part of the transaction.
+	Blobs storage.BlobStore
 }
 
 func NewBoardHandler(db *sql.DB) *BoardHandler {
-	return &BoardHandler{
-		Boards:       &models.BoardService{DB: db},
-		Lists:        &models.ListService{DB: db},
-		Cards:        &models.CardService{DB: db},
-		BoardMembers: &models.BoardMemberService{DB: db},
-		Users:        &models.UserService{DB: db},
-		CardTags:     &models.CardTagService{DB: db},
-		CardComments: &models.CardCommentService{DB: db},
-		CardMembers:  &models.CardMemberService{DB: db},
-		Activities:   &models.ActivityService{DB: db},
+	h := &BoardHandler{DB: db}
+	h.bind(db)
+	return h
+}
+
+func (h *BoardHandler) bind(db models.DBTX) {
+	h.Boards = &models.BoardService{DB: db}
+	h.Lists = &models.ListService{DB: db}
+	h.Cards = &models.CardService{DB: db}
+	h.BoardMembers = &models.BoardMemberService{DB: db}
+	h.Users = &models.UserService{DB: db}
+	h.CardTags = &models.CardTagService{DB: db}
+	h.Labels = &models.LabelService{DB: db}
+	h.CardComments = &models.CardCommentService{DB: db}
+	h.CardMembers = &models.CardMemberService{DB: db}
+	h.Activities = &models.ActivityService{DB: db}
+	h.Notifications = &models.NotificationService{DB: db}
+	h.Webhooks = &models.WebhookService{DB: db}
+	h.Automations = &models.AutomationService{DB: db}
+	h.Recurrences = &models.RecurrenceService{DB: db}
+	h.Checklists = &models.ChecklistService{DB: db}
+	h.Attachments = &models.AttachmentService{DB: db}
+	h.CustomFields = &models.CustomFieldService{DB: db}
+	h.Relations = &models.CardRelationService{DB: db}
+	h.Search = &models.SearchService{DB: db}
+	h.SavedFilters = &models.SavedFilterService{DB: db}
+	h.Analytics = &models.AnalyticsService{DB: db}
+	h.FlowMetrics = &models.FlowMetricsService{DB: db}
+	h.Sprints = &models.SprintService{DB: db}
+	h.TimeEntries = &models.TimeEntryService{DB: db}
+	h.Templates = &models.TemplateService{DB: db}
+}
+
+// inTx runs fn against a copy of the handler whose services all share one transaction,
+// so a mutation and its activity entry are committed together.
+func (h *BoardHandler) inTx(fn func(tx *BoardHandler) error) error {
+	return models.WithTx(h.DB, func(tx *sql.Tx) error {
+		t := *h
+		t.bind(tx)
+		return fn(&t)
+	})
+}
+
+// cardBoardID resolves the board owning a card through its list.
+func (h *BoardHandler) cardBoardID(c *models.Card) *int {
+	l, err := h.Lists.GetListByID(c.ListID)
+	if err != nil {
+		return nil
 	}
+	return &l.BoardID
+}
+
+// canAccessBoard reports whether the user owns the board or is one of its members.
+func (h *BoardHandler) canAccessBoard(boardID, userID int) bool {
+	b, err := h.Boards.GetBoardByID(boardID)
+	if err != nil {
+		return false
+	}
+	if b.UserID == userID {
+		return true
+	}
+	isMember, err := h.BoardMembers.IsMember(boardID, userID)
+	return err == nil && isMember
 }
 
 func (h *BoardHandler) ListBoards(w http.ResponseWriter, r *http.Request) {
@@ -43,7 +118,7 @@ func (h *BoardHandler) ListBoards(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(int)
 
 	rows, err := h.Boards.DB.Query(
-		`SELECT DISTINCT b.id, b.user_id, b.title, b.created_at
+		`SELECT DISTINCT b.id, b.user_id, b.title, b.wip_policy, b.created_at
 		 FROM boards b
 		 LEFT JOIN board_members bm ON bm.board_id = b.id
 		 WHERE b.user_id = $1 OR bm.user_id = $1
@@ -58,7 +133,7 @@ func (h *BoardHandler) ListBoards(w http.ResponseWriter, r *http.Request) {
 	var out []models.Board
 	for rows.Next() {
 		var b models.Board
-		if err := rows.Scan(&b.ID, &b.UserID, &b.Title, &b.CreatedAt); err != nil {
+		if err := rows.Scan(&b.ID, &b.UserID, &b.Title, &b.WIPPolicy, &b.CreatedAt); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -71,16 +146,54 @@ func (h *BoardHandler) ListBoards(w http.ResponseWriter, r *http.Request) {
 }
 
 type cardWithTags struct {
-	models.Card `json:",inline"`
-	Tags        []models.CardTag `json:"tags"`
+	models.Card       `json:",inline"`
+	Tags              []models.CardTag          `json:"tags"`
+	ChecklistProgress models.ChecklistProgress  `json:"checklist_progress"`
+	Cover             *cardCover                `json:"cover"`
+	CustomFields      []models.CustomFieldValue `json:"custom_fields"`
+	ChildProgress     models.ChildProgress      `json:"child_progress"`
+}
+
+// cardCover is what the board shows on top of a card: the thumbnail of its cover image, or a
+// solid color from the card palette. Image covers carry a color too, for clients to show
+// while the thumbnail loads or if it cannot be rendered.
+type cardCover struct {
+	Type         string `json:"type"` // "image" or "color"
+	Color        string `json:"color"`
+	AttachmentID *int   `json:"attachment_id,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+// coverFor returns the card's cover, or nil when it has neither a cover image nor a cover
+// color. Without a cover color, image covers fall back to the card's own color.
+func coverFor(c models.Card) *cardCover {
+	color := c.CoverColor
+	if c.CoverAttachmentID != nil {
+		if color == "" {
+			color = c.Color
+		}
+		return &cardCover{Type: "image", Color: color, AttachmentID: c.CoverAttachmentID, ThumbnailURL: thumbnailURL(*c.CoverAttachmentID, thumbnail.Cover)}
+	}
+	if color != "" {
+		return &cardCover{Type: "color", Color: color}
+	}
+	return nil
 }
 
 type boardDetail struct {
 	models.Board `json:",inline"`
-	Lists        []struct {
-		models.List `json:",inline"`
-		Cards       []cardWithTags `json:"cards"`
-	} `json:"lists"`
+	Labels       []models.Label       `json:"labels"`
+	CustomFields []models.CustomField `json:"custom_fields"`
+	Lists        []boardList          `json:"lists"`
+}
+
+// boardList is a list of GetBoard. CardCount counts all its cards, filtered out or not, to
+// compare with its WIP limit.
+type boardList struct {
+	models.List  `json:",inline"`
+	CardCount    int            `json:"card_count"`
+	OverWIPLimit bool           `json:"over_wip_limit"`
+	Cards        []cardWithTags `json:"cards"`
 }
 
 func (h *BoardHandler) GetBoard(w http.ResponseWriter, r *http.Request) {
@@ -109,34 +222,105 @@ func (h *BoardHandler) GetBoard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp := boardDetail{Board: *b}
+	progress, err := h.Checklists.ProgressByBoard(b.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	labels, err := h.Labels.GetLabelsByBoard(b.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if labels == nil {
+		labels = []models.Label{}
+	}
+
+	fields, err := h.CustomFields.GetFieldsByBoard(b.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if fields == nil {
+		fields = []models.CustomField{}
+	}
+	fieldQuery, err := parseBoardFieldQuery(r.URL.Query(), fields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fieldValues, err := h.CustomFields.ValuesByBoard(b.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	keep, err := parseEpicFilter(r.URL.Query().Get("epic"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	childCounts, err := h.Cards.ChildProgressByBoard(b.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	matches, status, err := h.boardFilterMatches(r, b.ID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	resp := boardDetail{Board: *b, Labels: labels, CustomFields: fields}
 	for _, l := range lists {
 		cards, err := h.Cards.GetCardsByList(l.ID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		count := len(cards)
+		cards = fieldQuery.apply(cards, fieldValues)
 		var cardsWithTags []cardWithTags
 		for i := range cards {
+			if !keep(cards[i]) || (matches != nil && !matches[cards[i].ID]) {
+				continue
+			}
 			cards[i].Color = normalizeCardColor(cards[i].Color, l)
 			tags, _ := h.CardTags.GetTagsByCard(cards[i].ID)
 			if tags == nil {
 				tags = []models.CardTag{}
 			}
-			cardsWithTags = append(cardsWithTags, cardWithTags{Card: cards[i], Tags: tags})
+			values := fieldValues[cards[i].ID]
+			if values == nil {
+				values = []models.CustomFieldValue{}
+			}
+			cardsWithTags = append(cardsWithTags, cardWithTags{Card: cards[i], Tags: tags, ChecklistProgress: progress[cards[i].ID], Cover: coverFor(cards[i]), CustomFields: values, ChildProgress: childCounts[cards[i].ID]})
 		}
 		if cardsWithTags == nil {
 			cardsWithTags = []cardWithTags{}
 		}
-		item := struct {
-			models.List `json:",inline"`
-			Cards       []cardWithTags `json:"cards"`
-		}{List: l, Cards: cardsWithTags}
-		resp.Lists = append(resp.Lists, item)
+		resp.Lists = append(resp.Lists, boardList{
+			List:         l,
+			CardCount:    count,
+			OverWIPLimit: l.WIPLimit != nil && count > *l.WIPLimit,
+			Cards:        cardsWithTags,
+		})
 	}
 	json.NewEncoder(w).Encode(resp)
 }
 
+// paletteColors are the card colors the frontend knows how to draw.
+var paletteColors = []string{"primary", "warning", "accent", "success", "inbox"}
+
+func isPaletteColor(c string) bool {
+	for _, p := range paletteColors {
+		if c == p {
+			return true
+		}
+	}
+	return false
+}
+
 func normalizeCardColor(current string, list models.List) string {
 	title := strings.TrimSpace(strings.ToLower(list.Title))
 	switch title {
@@ -180,27 +364,59 @@ func (h *BoardHandler) CreateBoard(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(int)
 	var body struct {
 		Title string `json:"title"`
+		// template_id picks a built-in template or one of the user's; Kanban by default.
+		TemplateID *int `json:"template_id"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Title == "" {
-		body.Title = "My Board"
-	}
-	b, err := h.Boards.CreateBoard(userID, body.Title)
-	if err != nil {
+	json.NewDecoder(r.Body).Decode(&body)
+
+	var tpl *models.BoardTemplate
+	var err error
+	if body.TemplateID != nil {
+		tpl, err = h.Templates.GetTemplateByID(*body.TemplateID)
+		if err != nil || (tpl.UserID != nil && *tpl.UserID != userID) {
+			http.Error(w, "template not found", http.StatusBadRequest)
+			return
+		}
+	} else if tpl, err = h.Templates.GetTemplateByKey(models.DefaultTemplateKey); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	_, _ = h.BoardMembers.AddMember(b.ID, userID, "owner")
-
-	defaults := []struct{ Title, Accent string }{
-		{"Ideas", "accent"}, {"In Progress", "primary"}, {"Review", "warning"}, {"Done", "success"},
+	if strings.TrimSpace(body.Title) == "" {
+		body.Title = "My Board"
+		if body.TemplateID != nil {
+			body.Title = tpl.Name
+		}
 	}
-	for i, d := range defaults {
-		_, err := h.Lists.CreateList(b.ID, d.Title, d.Accent, i)
+
+	var b *models.Board
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		b, err = tx.Boards.CreateBoard(userID, body.Title)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return err
+		}
+
+		if _, err := tx.BoardMembers.AddMember(b.ID, userID, "owner"); err != nil {
+			return err
 		}
+
+		if err := tx.applyTemplate(b.ID, tpl.Content); err != nil {
+			return err
+		}
+
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &b.ID,
+			UserID:  userID,
+			Action:  models.ActionCreateBoard,
+			Details: "created this board from the " + tpl.Name + " template",
+			Refs:    map[string]int{"board": b.ID, "template": tpl.ID},
+			After:   map[string]interface{}{"title": b.Title, "template_id": tpl.ID},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	json.NewEncoder(w).Encode(b)
@@ -220,7 +436,6 @@ func (h *BoardHandler) CreateCard(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "list not found", http.StatusNotFound)
 		return
 	}
-	_ = l
 
 	var body struct {
 		Title string `json:"title"`
@@ -239,32 +454,57 @@ func (h *BoardHandler) CreateCard(w http.ResponseWriter, r *http.Request) {
 	}
 	pos := len(existing)
 
-	card, err := h.Cards.CreateCard(listID, body.Title, body.Badge, body.Color, pos)
+	userID := r.Context().Value("userID").(int)
+	var card *models.Card
+	var wipWarning string
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if wipWarning, err = tx.Lists.EnterList(listID); err != nil {
+			return err
+		}
+		card, err = tx.Cards.CreateCard(listID, body.Title, body.Badge, body.Color, pos)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &l.BoardID,
+			CardID:  &card.ID,
+			UserID:  userID,
+			Action:  models.ActionCreateCard,
+			Details: "created this card in list " + l.Title,
+			Refs:    map[string]int{"board": l.BoardID, "list": l.ID, "card": card.ID},
+			After:   map[string]interface{}{"title": card.Title, "list_id": card.ListID, "position": card.Position},
+		})
+		return err
+	})
+	var wipErr *models.WIPLimitError
+	if errors.As(err, &wipErr) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	userID := r.Context().Value("userID").(int)
-	h.Activities.LogActivity(&card.ID, userID, "create_card", "created this card in list "+l.Title)
+	h.runAutomations(userID, automationEvent{Trigger: models.TriggerCardCreated, BoardID: l.BoardID, CardID: card.ID, ListID: listID})
+	if c, err := h.Cards.GetCardByID(card.ID); err == nil {
+		card = c
+	}
 
+	if wipWarning != "" {
+		w.Header().Set("X-WIP-Limit-Exceeded", wipWarning)
+	}
 	json.NewEncoder(w).Encode(card)
 }
 
 func (h *BoardHandler) GetCard(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
-	if err != nil || id <= 0 {
-		http.Error(w, "invalid card id", http.StatusBadRequest)
-		return
-	}
-
-	card, err := h.Cards.GetCardByID(id)
-	if err != nil {
-		http.Error(w, "card not found", http.StatusNotFound)
+	card, _, ok := h.cardForMember(w, r)
+	if !ok {
 		return
 	}
+	id := card.ID
 
 	tags, _ := h.CardTags.GetTagsByCard(id)
 	if tags == nil {
@@ -276,29 +516,39 @@ func (h *BoardHandler) GetCard(w http.ResponseWriter, r *http.Request) {
 		comments = []models.CardComment{}
 	}
 
+	values, _ := h.CustomFields.GetValuesByCard(id)
+	if values == nil {
+		values = []models.CustomFieldValue{}
+	}
+
+	userID := r.Context().Value("userID").(int)
+	rels, _ := h.Relations.GetRelationsByCard(id)
+	relations := h.visibleRelations(userID, rels)
+	kids, _ := h.Cards.GetChildren(id)
+	children := h.visibleCards(userID, kids)
+
 	resp := struct {
-		*models.Card `json:",inline"`
-		Tags         []models.CardTag     `json:"tags"`
-		Comments     []models.CardComment `json:"comments"`
-	}{Card: card, Tags: tags, Comments: comments}
+		*models.Card  `json:",inline"`
+		Tags          []models.CardTag          `json:"tags"`
+		Comments      []models.CardComment      `json:"comments"`
+		CustomFields  []models.CustomFieldValue `json:"custom_fields"`
+		Relations     []models.CardRelation     `json:"relations"`
+		Children      []models.RelatedCard      `json:"children"`
+		ChildProgress models.ChildProgress      `json:"child_progress"`
+	}{Card: card, Tags: tags, Comments: comments, CustomFields: values, Relations: relations,
+		Children: children, ChildProgress: childProgress(children)}
 
 	json.NewEncoder(w).Encode(resp)
 }
 
 func (h *BoardHandler) UpdateCard(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
-	if err != nil || id <= 0 {
-		http.Error(w, "invalid card id", http.StatusBadRequest)
-		return
-	}
-
-	existing, err := h.Cards.GetCardByID(id)
-	if err != nil {
-		http.Error(w, "card not found", http.StatusNotFound)
+	existing, _, ok := h.cardForMember(w, r)
+	if !ok {
 		return
 	}
+	id := existing.ID
+	var err error
 
 	var body struct {
 		Title       *string `json:"title"`
@@ -308,6 +558,20 @@ func (h *BoardHandler) UpdateCard(w http.ResponseWriter, r *http.Request) {
 		ListID      *int    `json:"listId"`
 		Position    *int    `json:"position"`
 		DueDate     *string `json:"due_date"`
+		// Dates are RFC3339; an empty string clears them.
+		StartDate *string `json:"start_date"`
+		Priority  *string `json:"priority"`
+		Completed *bool   `json:"completed"`
+		// ignore_blockers moves a blocked card into an in-progress list anyway.
+		IgnoreBlockers *bool `json:"ignore_blockers"`
+		// cover_attachment_id 0 and an empty cover_color remove them.
+		CoverAttachmentID *int    `json:"cover_attachment_id"`
+		CoverColor        *string `json:"cover_color"`
+		// custom_fields maps field ids to values; null clears a value.
+		CustomFields map[string]json.RawMessage `json:"custom_fields"`
+		// sprint_id 0 moves the card back to the backlog; a null story_points clears the estimate.
+		SprintID    *int            `json:"sprint_id"`
+		StoryPoints json.RawMessage `json:"story_points"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, "invalid payload", http.StatusBadRequest)
@@ -339,10 +603,16 @@ func (h *BoardHandler) UpdateCard(w http.ResponseWriter, r *http.Request) {
 
 	newListID := existing.ListID
 	if body.ListID != nil && *body.ListID > 0 {
-		if _, err := h.Lists.GetListByID(*body.ListID); err != nil {
+		l, err := h.Lists.GetListByID(*body.ListID)
+		if err != nil {
 			http.Error(w, "list not found", http.StatusBadRequest)
 			return
 		}
+		// Moving a card to another board needs access to that board too.
+		if !h.canAccessBoard(l.BoardID, r.Context().Value("userID").(int)) {
+			http.Error(w, "access denied to the target list", http.StatusForbidden)
+			return
+		}
 		newListID = *body.ListID
 	}
 
@@ -351,48 +621,342 @@ func (h *BoardHandler) UpdateCard(w http.ResponseWriter, r *http.Request) {
 		newPosition = *body.Position
 	}
 
-	var newDueDate *time.Time
-	if body.DueDate != nil && *body.DueDate != "" {
-		t, err := time.Parse(time.RFC3339, *body.DueDate)
-		if err == nil {
-			newDueDate = &t
+	newDueDate, ok := parseCardDate(body.DueDate, existing.DueDate)
+	if !ok {
+		http.Error(w, "due_date must be an RFC3339 date such as 2006-01-02T15:04:05Z", http.StatusBadRequest)
+		return
+	}
+	newStartDate, ok := parseCardDate(body.StartDate, existing.StartDate)
+	if !ok {
+		http.Error(w, "start_date must be an RFC3339 date such as 2006-01-02T15:04:05Z", http.StatusBadRequest)
+		return
+	}
+	if newStartDate != nil && newDueDate != nil && !newStartDate.Before(*newDueDate) {
+		http.Error(w, "start_date must be before due_date", http.StatusBadRequest)
+		return
+	}
+
+	newPriority := existing.Priority
+	if body.Priority != nil {
+		newPriority = models.Priority(strings.ToLower(strings.TrimSpace(*body.Priority)))
+		if newPriority == "" {
+			newPriority = models.PriorityNone
+		}
+		if !models.ValidPriority(newPriority) {
+			http.Error(w, "priority must be one of none, low, medium, high, urgent", http.StatusBadRequest)
+			return
+		}
+	}
+
+	newCompleted := existing.Completed
+	if body.Completed != nil {
+		newCompleted = *body.Completed
+	}
+	// Starting work on a card that still waits for others is refused unless the client insists;
+	// the blockers are then reported in the X-Blocked-By header.
+	var blockers []models.RelatedCard
+	if newListID != existing.ListID {
+		if blockers, err = h.startBlockers(id, newListID, newCompleted); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(blockers) > 0 && (body.IgnoreBlockers == nil || !*body.IgnoreBlockers) {
+			http.Error(w, (&blockedError{blockers}).Error()+"; resolve them first or set ignore_blockers", http.StatusConflict)
+			return
+		}
+	}
+
+	scheduleChanged := newPriority != existing.Priority || !sameTime(newStartDate, existing.StartDate) || newCompleted != existing.Completed
+
+	newCover, newCoverColor := existing.CoverAttachmentID, existing.CoverColor
+	if body.CoverAttachmentID != nil {
+		newCover = nil
+		if *body.CoverAttachmentID > 0 {
+			a, err := h.Attachments.GetAttachmentByID(*body.CoverAttachmentID)
+			if err != nil || a.CardID != id {
+				http.Error(w, "cover attachment must belong to this card", http.StatusBadRequest)
+				return
+			}
+			if !thumbnail.Supported(a.MimeType) {
+				http.Error(w, "cover attachment must be a PNG, JPEG or GIF image", http.StatusBadRequest)
+				return
+			}
+			newCover = body.CoverAttachmentID
+		}
+	}
+	if body.CoverColor != nil {
+		c := strings.TrimSpace(strings.ToLower(*body.CoverColor))
+		if c != "" && !isPaletteColor(c) {
+			http.Error(w, "cover_color must be one of "+strings.Join(paletteColors, ", "), http.StatusBadRequest)
+			return
+		}
+		newCoverColor = c
+	}
+	var fieldChanges []fieldChange
+	targetBoardID := h.cardBoardID(&models.Card{ListID: newListID})
+	if len(body.CustomFields) > 0 {
+		if targetBoardID == nil {
+			http.Error(w, "list not found", http.StatusBadRequest)
+			return
+		}
+		fields, err := h.CustomFields.GetFieldsByBoard(*targetBoardID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if fieldChanges, err = parseFieldValues(fields, body.CustomFields); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-	} else if existing.DueDate != nil && body.DueDate != nil && *body.DueDate == "" {
-		newDueDate = nil
-	} else {
-		newDueDate = existing.DueDate
 	}
 
-	updated, err := h.Cards.UpdateCard(id, newTitle, newDescription, newBadge, newColor, newListID, newPosition, newDueDate)
+	newSprintID, newStoryPoints, err := h.parseCardPlanning(existing, targetBoardID, body.SprintID, body.StoryPoints)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	planningChanged := !sameInt(newSprintID, existing.SprintID) || !sameFloat(newStoryPoints, existing.StoryPoints)
+
+	coverChanged := newCoverColor != existing.CoverColor || (newCover == nil) != (existing.CoverAttachmentID == nil) ||
+		(newCover != nil && *newCover != *existing.CoverAttachmentID)
 
 	userID := r.Context().Value("userID").(int)
-	if newListID != existing.ListID {
-		oldList, _ := h.Lists.GetListByID(existing.ListID)
-		newList, _ := h.Lists.GetListByID(newListID)
-		if oldList != nil && newList != nil {
-			h.Activities.LogActivity(&id, userID, "move_card", "moved this card from "+oldList.Title+" to "+newList.Title)
+	var updated *models.Card
+	var wipWarning string
+	err = h.inTx(func(tx *BoardHandler) error {
+		if newListID != existing.ListID {
+			var err error
+			if wipWarning, err = tx.Lists.EnterList(newListID); err != nil {
+				return err
+			}
 		}
+		if coverChanged {
+			if err := tx.Cards.SetCover(id, newCover, newCoverColor); err != nil {
+				return err
+			}
+		}
+		if scheduleChanged {
+			if err := tx.Cards.SetSchedule(id, newPriority, newStartDate, newCompleted); err != nil {
+				return err
+			}
+		}
+		if planningChanged {
+			if err := tx.Cards.SetPlanning(id, newSprintID, newStoryPoints); err != nil {
+				return err
+			}
+		}
+		var err error
+		updated, err = tx.Cards.UpdateCard(id, newTitle, newDescription, newBadge, newColor, newListID, newPosition, newDueDate)
+		if err != nil {
+			return err
+		}
+		if updated.ListID != existing.ListID {
+			from, to := tx.cardBoardID(existing), tx.cardBoardID(updated)
+			if from != nil && to != nil && *from != *to {
+				if err := tx.cardChangedBoard(updated, *to); err != nil {
+					return err
+				}
+			}
+		}
+		if err := tx.logCardChanges(userID, existing, updated); err != nil {
+			return err
+		}
+		if targetBoardID == nil {
+			return nil
+		}
+		return tx.saveFieldValues(userID, *targetBoardID, id, fieldChanges)
+	})
+	var wipErr *models.WIPLimitError
+	if errors.As(err, &wipErr) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
 	}
-	if newTitle != existing.Title {
-		h.Activities.LogActivity(&id, userID, "update_card", "renamed this card")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if updated.ListID != existing.ListID {
+		if boardID := h.cardBoardID(updated); boardID != nil {
+			h.runAutomations(userID, automationEvent{Trigger: models.TriggerCardMoved, BoardID: *boardID, CardID: id, ListID: updated.ListID})
+			if c, err := h.Cards.GetCardByID(id); err == nil {
+				updated = c
+			}
+		}
 	}
 
+	if len(blockers) > 0 {
+		ids := make([]string, len(blockers))
+		for i, b := range blockers {
+			ids[i] = strconv.Itoa(b.ID)
+		}
+		w.Header().Set("X-Blocked-By", strings.Join(ids, ","))
+	}
+	if wipWarning != "" {
+		w.Header().Set("X-WIP-Limit-Exceeded", wipWarning)
+	}
 	json.NewEncoder(w).Encode(updated)
 }
 
+// logCardChanges records one activity per aspect of the card that differs between before and after.
+func (h *BoardHandler) logCardChanges(userID int, before, after *models.Card) error {
+	boardID := h.cardBoardID(after)
+	refs := map[string]int{"card": after.ID}
+	if boardID != nil {
+		refs["board"] = *boardID
+	}
+	entry := func(action models.ActionType, details string, b, a interface{}) models.ActivityEntry {
+		return models.ActivityEntry{
+			BoardID: boardID,
+			CardID:  &after.ID,
+			UserID:  userID,
+			Action:  action,
+			Details: details,
+			Refs:    refs,
+			Before:  b,
+			After:   a,
+		}
+	}
 
+	var entries []models.ActivityEntry
+	if after.ListID != before.ListID {
+		oldList, _ := h.Lists.GetListByID(before.ListID)
+		newList, _ := h.Lists.GetListByID(after.ListID)
+		details := "moved this card"
+		if oldList != nil && newList != nil {
+			details = "moved this card from " + oldList.Title + " to " + newList.Title
+		}
+		entries = append(entries, entry(models.ActionMoveCard, details,
+			map[string]interface{}{"list_id": before.ListID, "position": before.Position},
+			map[string]interface{}{"list_id": after.ListID, "position": after.Position},
+		))
+	}
+	if after.Title != before.Title {
+		entries = append(entries, entry(models.ActionRenameCard, "renamed this card",
+			map[string]interface{}{"title": before.Title},
+			map[string]interface{}{"title": after.Title},
+		))
+	}
+	if after.Description != before.Description {
+		entries = append(entries, entry(models.ActionUpdateDescription, "updated the description",
+			map[string]interface{}{"description": before.Description},
+			map[string]interface{}{"description": after.Description},
+		))
+	}
+	if !sameTime(before.DueDate, after.DueDate) {
+		details := "removed the due date"
+		if after.DueDate != nil {
+			details = "set the due date to " + after.DueDate.Format("Jan 2, 2006 15:04")
+		}
+		entries = append(entries, entry(models.ActionUpdateDueDate, details,
+			map[string]interface{}{"due_date": before.DueDate},
+			map[string]interface{}{"due_date": after.DueDate},
+		))
+	}
+	if !sameTime(before.StartDate, after.StartDate) {
+		details := "removed the start date"
+		if after.StartDate != nil {
+			details = "set the start date to " + after.StartDate.Format("Jan 2, 2006 15:04")
+		}
+		entries = append(entries, entry(models.ActionUpdateStartDate, details,
+			map[string]interface{}{"start_date": before.StartDate},
+			map[string]interface{}{"start_date": after.StartDate},
+		))
+	}
+	if after.Priority != before.Priority {
+		entries = append(entries, entry(models.ActionUpdatePriority, "set the priority to "+string(after.Priority),
+			map[string]interface{}{"priority": before.Priority},
+			map[string]interface{}{"priority": after.Priority},
+		))
+	}
+	if after.Completed != before.Completed {
+		action, details := models.ActionCompleteCard, "marked this card complete"
+		if !after.Completed {
+			action, details = models.ActionReopenCard, "reopened this card"
+		}
+		entries = append(entries, entry(action, details,
+			map[string]interface{}{"completed": before.Completed},
+			map[string]interface{}{"completed": after.Completed},
+		))
+	}
+	if !sameInt(before.SprintID, after.SprintID) {
+		details := "moved this card to the backlog"
+		if after.SprintID != nil {
+			details = "added this card to a sprint"
+			if sp, err := h.Sprints.GetSprintByID(*after.SprintID); err == nil {
+				details = "added this card to " + sp.Name
+			}
+		}
+		entries = append(entries, entry(models.ActionUpdateSprint, details,
+			map[string]interface{}{"sprint_id": before.SprintID},
+			map[string]interface{}{"sprint_id": after.SprintID},
+		))
+	}
+	if !sameFloat(before.StoryPoints, after.StoryPoints) {
+		details := "removed the estimate"
+		if after.StoryPoints != nil {
+			details = "estimated this card at " + strconv.FormatFloat(*after.StoryPoints, 'f', -1, 64) + " points"
+		}
+		entries = append(entries, entry(models.ActionUpdateEstimate, details,
+			map[string]interface{}{"story_points": before.StoryPoints},
+			map[string]interface{}{"story_points": after.StoryPoints},
+		))
+	}
+	if after.Badge != before.Badge || after.Color != before.Color {
+		entries = append(entries, entry(models.ActionUpdateAppearance, "changed the badge or color",
+			map[string]interface{}{"badge": before.Badge, "color": before.Color},
+			map[string]interface{}{"badge": after.Badge, "color": after.Color},
+		))
+	}
+
+	for _, e := range entries {
+		if _, err := h.Activities.Log(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseCardDate reads a date field of a card update: nil keeps current and an empty string
+// clears the date. It reports false when the value is not RFC3339.
+func parseCardDate(raw *string, current *time.Time) (*time.Time, bool) {
+	if raw == nil {
+		return current, true
+	}
+	t, err := parseOptionalDate(strings.TrimSpace(*raw))
+	return t, err == nil
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func sameInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+
+// AddCardMember assigns a member of the card's board to the card and notifies them.
 func (h *BoardHandler) AddCardMember(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	vars := mux.Vars(r)
-	cardID, err := strconv.Atoi(vars["id"])
-	if err != nil || cardID <= 0 {
-		http.Error(w, "invalid card id", http.StatusBadRequest)
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
 		return
 	}
+	cardID := card.ID
 	userID := r.Context().Value("userID").(int)
 
 	var body struct {
@@ -402,14 +966,8 @@ func (h *BoardHandler) AddCardMember(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid user id in body", http.StatusBadRequest)
 		return
 	}
-
-	if _, err := h.Cards.GetCardByID(cardID); err != nil {
-		http.Error(w, "card not found", http.StatusNotFound)
-		return
-	}
-
-	if err := h.CardMembers.AddMember(cardID, body.UserID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !h.canAccessBoard(boardID, body.UserID) {
+		http.Error(w, "user is not a board member", http.StatusBadRequest)
 		return
 	}
 
@@ -418,38 +976,84 @@ func (h *BoardHandler) AddCardMember(w http.ResponseWriter, r *http.Request) {
 	if invitedUser != nil {
 		email = invitedUser.Email
 	}
-	h.Activities.LogActivity(&cardID, userID, "add_member", "assigned "+email+" to this card")
+
+	err := h.inTx(func(tx *BoardHandler) error {
+		added, err := tx.CardMembers.AddMember(cardID, body.UserID)
+		if err != nil || !added {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			CardID:  &cardID,
+			UserID:  userID,
+			Action:  models.ActionAddCardMember,
+			Details: "assigned " + email + " to this card",
+			Refs:    map[string]int{"board": boardID, "card": cardID, "user": body.UserID},
+			After:   map[string]interface{}{"user_id": body.UserID},
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Notifications.Notify(models.Notification{
+			UserID:  body.UserID,
+			ActorID: &userID,
+			Type:    models.NotificationCardAssigned,
+			BoardID: &boardID,
+			CardID:  &cardID,
+			Message: "assigned you to \"" + card.Title + "\"",
+		})
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	members, _ := h.CardMembers.GetMembersByCard(cardID)
 	json.NewEncoder(w).Encode(members)
 }
 
+// RemoveCardMember unassigns a user from the card. The user need not be a board member any
+// more, so cards keep being cleaned up after someone leaves the board.
 func (h *BoardHandler) RemoveCardMember(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	vars := mux.Vars(r)
-	cardID, err := strconv.Atoi(vars["id"])
-	if err != nil || cardID <= 0 {
-		http.Error(w, "invalid card id", http.StatusBadRequest)
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
 		return
 	}
-	memberID, err := strconv.Atoi(vars["userId"])
+	cardID := card.ID
+	memberID, err := strconv.Atoi(mux.Vars(r)["userId"])
 	if err != nil || memberID <= 0 {
 		http.Error(w, "invalid member user id", http.StatusBadRequest)
 		return
 	}
 	userID := r.Context().Value("userID").(int)
 
-	if err := h.CardMembers.RemoveMember(cardID, memberID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
 	removedUser, _ := h.Users.GetUserByID(memberID)
 	email := "someone"
 	if removedUser != nil {
 		email = removedUser.Email
 	}
-	h.Activities.LogActivity(&cardID, userID, "remove_member", "removed "+email+" from this card")
+
+	err = h.inTx(func(tx *BoardHandler) error {
+		removed, err := tx.CardMembers.RemoveMember(cardID, memberID)
+		if err != nil || !removed {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			CardID:  &cardID,
+			UserID:  userID,
+			Action:  models.ActionRemoveCardMember,
+			Details: "removed " + email + " from this card",
+			Refs:    map[string]int{"board": boardID, "card": cardID, "user": memberID},
+			Before:  map[string]interface{}{"user_id": memberID},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Member removed"})
@@ -477,51 +1081,117 @@ func (h *BoardHandler) GetCardActivities(w http.ResponseWriter, r *http.Request)
 }
 
 
+// AddCardTag attaches a board label to the card, by label_id or by name. A name the board
+// has no label for creates one with the given color; an existing label keeps its color.
 func (h *BoardHandler) AddCardTag(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	vars := mux.Vars(r)
-	cardID, err := strconv.Atoi(vars["id"])
-	if err != nil || cardID <= 0 {
-		http.Error(w, "invalid card id", http.StatusBadRequest)
-		return
-	}
-
-	if _, err := h.Cards.GetCardByID(cardID); err != nil {
-		http.Error(w, "card not found", http.StatusNotFound)
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
 		return
 	}
+	cardID := card.ID
+	userID := r.Context().Value("userID").(int)
 
 	var body struct {
-		Name  string `json:"name"`
-		Color string `json:"color"`
+		LabelID int    `json:"label_id"`
+		Name    string `json:"name"`
+		Color   string `json:"color"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Name) == "" {
-		http.Error(w, "name is required", http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || (body.LabelID <= 0 && strings.TrimSpace(body.Name) == "") {
+		http.Error(w, "label_id or name is required", http.StatusBadRequest)
 		return
 	}
 	if body.Color == "" {
 		body.Color = "primary"
 	}
+	if body.LabelID <= 0 && !isLabelColor(body.Color) {
+		http.Error(w, "color must be one of "+strings.Join(labelColors, ", "), http.StatusBadRequest)
+		return
+	}
+	if body.LabelID > 0 {
+		label, err := h.Labels.GetLabelByID(body.LabelID)
+		if err != nil || label.BoardID != boardID {
+			http.Error(w, "label not found on this board", http.StatusBadRequest)
+			return
+		}
+	}
 
-	tag, err := h.CardTags.AddTag(cardID, strings.TrimSpace(body.Name), body.Color)
+	var tag *models.CardTag
+	var added bool
+	err := h.inTx(func(tx *BoardHandler) error {
+		labelID := body.LabelID
+		if labelID <= 0 {
+			label, err := tx.Labels.EnsureLabel(boardID, strings.TrimSpace(body.Name), body.Color)
+			if err != nil {
+				return err
+			}
+			labelID = label.ID
+		}
+
+		var err error
+		tag, added, err = tx.CardTags.AddTag(cardID, labelID)
+		if err != nil || !added {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			CardID:  &cardID,
+			UserID:  userID,
+			Action:  models.ActionAddTag,
+			Details: "added the tag " + tag.Name,
+			Refs:    map[string]int{"board": boardID, "card": cardID, "label": tag.ID},
+			After:   map[string]interface{}{"label_id": tag.ID, "name": tag.Name, "color": tag.Color},
+		})
+		return err
+	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if added {
+		h.runAutomations(userID, automationEvent{Trigger: models.TriggerTagAdded, BoardID: boardID, CardID: cardID, Tag: tag.Name})
+	}
+
 	json.NewEncoder(w).Encode(tag)
 }
 
+// RemoveCardTag detaches the label {tagId} from the card; the label stays in the catalog.
 func (h *BoardHandler) RemoveCardTag(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	vars := mux.Vars(r)
-	tagID, err := strconv.Atoi(vars["tagId"])
-	if err != nil || tagID <= 0 {
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	labelID, err := strconv.Atoi(mux.Vars(r)["tagId"])
+	if err != nil || labelID <= 0 {
 		http.Error(w, "invalid tag id", http.StatusBadRequest)
 		return
 	}
 
-	err = h.CardTags.RemoveTag(tagID)
+	userID := r.Context().Value("userID").(int)
+
+	tag, err := h.CardTags.GetTag(card.ID, labelID)
+	if err != nil {
+		http.Error(w, "tag not found", http.StatusNotFound)
+		return
+	}
+
+	err = h.inTx(func(tx *BoardHandler) error {
+		if err := tx.CardTags.RemoveTag(card.ID, labelID); err != nil {
+			return err
+		}
+		_, err := tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			CardID:  &card.ID,
+			UserID:  userID,
+			Action:  models.ActionRemoveTag,
+			Details: "removed the tag " + tag.Name,
+			Refs:    map[string]int{"board": boardID, "card": card.ID, "label": tag.ID},
+			Before:  map[string]interface{}{"label_id": tag.ID, "name": tag.Name, "color": tag.Color},
+		})
+		return err
+	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -561,7 +1231,8 @@ func (h *BoardHandler) AddCardComment(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := r.Context().Value("userID").(int)
 
-	if _, err := h.Cards.GetCardByID(cardID); err != nil {
+	card, err := h.Cards.GetCardByID(cardID)
+	if err != nil {
 		http.Error(w, "card not found", http.StatusNotFound)
 		return
 	}
@@ -574,7 +1245,49 @@ func (h *BoardHandler) AddCardComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comment, err := h.CardComments.AddComment(cardID, userID, strings.TrimSpace(body.Content))
+	var comment *models.CardComment
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		comment, err = tx.CardComments.AddComment(cardID, userID, strings.TrimSpace(body.Content))
+		if err != nil {
+			return err
+		}
+		boardID := tx.cardBoardID(card)
+		refs := map[string]int{"card": cardID, "comment": comment.ID}
+		if boardID != nil {
+			refs["board"] = *boardID
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: boardID,
+			CardID:  &cardID,
+			UserID:  userID,
+			Action:  models.ActionAddComment,
+			Details: "commented on this card",
+			Refs:    refs,
+			After:   map[string]interface{}{"comment_id": comment.ID, "content": comment.Content},
+		})
+		if err != nil {
+			return err
+		}
+		members, err := tx.CardMembers.GetMembersByCard(cardID)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			err := tx.Notifications.Notify(models.Notification{
+				UserID:  m.UserID,
+				ActorID: &userID,
+				Type:    models.NotificationCardComment,
+				BoardID: boardID,
+				CardID:  &cardID,
+				Message: "commented on \"" + card.Title + "\"",
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -668,7 +1381,32 @@ func (h *BoardHandler) InviteMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	member, err := h.BoardMembers.AddMember(boardID, invitedUser.ID, "member")
+	var member *models.BoardMember
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		member, err = tx.BoardMembers.AddMember(boardID, invitedUser.ID, "member")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			UserID:  userID,
+			Action:  models.ActionInviteMember,
+			Details: "invited " + invitedUser.Email + " to this board",
+			Refs:    map[string]int{"board": boardID, "user": invitedUser.ID},
+			After:   map[string]interface{}{"user_id": invitedUser.ID, "role": member.Role},
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Notifications.Notify(models.Notification{
+			UserID:  invitedUser.ID,
+			ActorID: &userID,
+			Type:    models.NotificationBoardInvite,
+			BoardID: &boardID,
+			Message: "invited you to the board \"" + board.Title + "\"",
+		})
+	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -709,7 +1447,26 @@ func (h *BoardHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.BoardMembers.RemoveMember(boardID, memberUserID)
+	removedUser, _ := h.Users.GetUserByID(memberUserID)
+	email := "someone"
+	if removedUser != nil {
+		email = removedUser.Email
+	}
+
+	err = h.inTx(func(tx *BoardHandler) error {
+		if err := tx.BoardMembers.RemoveMember(boardID, memberUserID); err != nil {
+			return err
+		}
+		_, err := tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			UserID:  userID,
+			Action:  models.ActionRemoveBoardMember,
+			Details: "removed " + email + " from this board",
+			Refs:    map[string]int{"board": boardID, "user": memberUserID},
+			Before:  map[string]interface{}{"user_id": memberUserID},
+		})
+		return err
+	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+var errChildLoop = errors.New("the card is an ancestor of the parent and cannot become its child")
+
+// childProgress rolls the children up into done and total counts.
+func childProgress(children []models.RelatedCard) models.ChildProgress {
+	p := models.ChildProgress{Total: len(children)}
+	for _, c := range children {
+		if c.Resolved {
+			p.Done++
+		}
+	}
+	return p
+}
+
+// parseEpicFilter reads the epic parameter of GetBoard: a card id keeps that card's children
+// and "none" keeps cards without a parent.
+func parseEpicFilter(epic string) (func(models.Card) bool, error) {
+	switch epic {
+	case "":
+		return func(models.Card) bool { return true }, nil
+	case "none":
+		return func(c models.Card) bool { return c.ParentCardID == nil }, nil
+	}
+	id, err := strconv.Atoi(epic)
+	if err != nil || id <= 0 {
+		return nil, errors.New("epic must be a card id or none")
+	}
+	return func(c models.Card) bool { return c.ParentCardID != nil && *c.ParentCardID == id }, nil
+}
+
+// visibleCards drops cards on boards the user cannot open.
+func (h *BoardHandler) visibleCards(userID int, cards []models.RelatedCard) []models.RelatedCard {
+	canAccess := h.boardAccess(userID)
+	out := []models.RelatedCard{}
+	for _, c := range cards {
+		if canAccess(c.BoardID) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (h *BoardHandler) GetCardChildren(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, _, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	children, err := h.Cards.GetChildren(card.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(h.visibleCards(r.Context().Value("userID").(int), children))
+}
+
+// AttachCardChild makes another card the user can open a child of this one, taking it from
+// its previous parent if it had one.
+func (h *BoardHandler) AttachCardChild(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(int)
+
+	var body struct {
+		CardID int `json:"card_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.CardID <= 0 {
+		http.Error(w, "card_id is required", http.StatusBadRequest)
+		return
+	}
+	if body.CardID == card.ID {
+		http.Error(w, "a card cannot be its own child", http.StatusBadRequest)
+		return
+	}
+	child, err := h.Cards.GetCardByID(body.CardID)
+	if err != nil {
+		http.Error(w, "child card not found", http.StatusNotFound)
+		return
+	}
+	if childBoardID := h.cardBoardID(child); childBoardID == nil || !h.canAccessBoard(*childBoardID, userID) {
+		http.Error(w, "child card not found", http.StatusNotFound)
+		return
+	}
+	if child.ParentCardID != nil && *child.ParentCardID == card.ID {
+		http.Error(w, "the card is already a child of this card", http.StatusConflict)
+		return
+	}
+
+	err = h.inTx(func(tx *BoardHandler) error {
+		if err := tx.Cards.LockHierarchy(); err != nil {
+			return err
+		}
+		loop, err := tx.Cards.IsAncestor(child.ID, card.ID)
+		if err != nil {
+			return err
+		}
+		if loop {
+			return errChildLoop
+		}
+		if err := tx.Cards.SetParent(child.ID, &card.ID); err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			CardID:  &card.ID,
+			UserID:  userID,
+			Action:  models.ActionAttachChild,
+			Details: "added " + child.Title + " as a child card",
+			Refs:    map[string]int{"board": boardID, "card": card.ID, "child_card": child.ID},
+			Before:  map[string]interface{}{"card_id": child.ID, "parent_card_id": child.ParentCardID},
+			After:   map[string]interface{}{"card_id": child.ID, "parent_card_id": card.ID},
+		})
+		return err
+	})
+	if err == errChildLoop {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := h.Cards.GetCardByID(child.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *BoardHandler) DetachCardChild(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	childID, err := strconv.Atoi(mux.Vars(r)["childId"])
+	if err != nil || childID <= 0 {
+		http.Error(w, "invalid child id", http.StatusBadRequest)
+		return
+	}
+	child, err := h.Cards.GetCardByID(childID)
+	if err != nil || child.ParentCardID == nil || *child.ParentCardID != card.ID {
+		http.Error(w, "child card not found", http.StatusNotFound)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	err = h.inTx(func(tx *BoardHandler) error {
+		if err := tx.Cards.SetParent(child.ID, nil); err != nil {
+			return err
+		}
+		_, err := tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			CardID:  &card.ID,
+			UserID:  userID,
+			Action:  models.ActionDetachChild,
+			Details: "removed " + child.Title + " from the child cards",
+			Refs:    map[string]int{"board": boardID, "card": card.ID, "child_card": child.ID},
+			Before:  map[string]interface{}{"card_id": child.ID, "parent_card_id": card.ID},
+			After:   map[string]interface{}{"card_id": child.ID, "parent_card_id": nil},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Child card detached"})
+}
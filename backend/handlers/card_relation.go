@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+var (
+	errRelationExists = errors.New("the cards are already related this way")
+	errRelationCycle  = errors.New("the relation would create a cycle")
+)
+
+// relationPhrases complete "this card ..." for each relation type.
+var relationPhrases = map[models.RelationType]string{
+	models.RelationBlocks:       "blocks",
+	models.RelationBlockedBy:    "is blocked by",
+	models.RelationRelatesTo:    "relates to",
+	models.RelationDuplicates:   "duplicates",
+	models.RelationDuplicatedBy: "is duplicated by",
+}
+
+// isInProgressList reports whether moving a card into the list means work on it has started.
+// Like the Done list for due reminders, this is decided by the list title.
+func isInProgressList(l models.List) bool {
+	switch strings.TrimSpace(strings.ToLower(l.Title)) {
+	case "in progress", "doing":
+		return true
+	}
+	return false
+}
+
+// blockedError refuses to start work on a card that still waits for other cards.
+type blockedError struct {
+	Blockers []models.RelatedCard
+}
+
+func (e *blockedError) Error() string {
+	return "card is blocked by " + describeCards(e.Blockers)
+}
+
+// startBlockers returns the open blockers of a card about to enter listID when that is an
+// in-progress list and the card is not completed. Every path that moves a card checks it:
+// users may move the card anyway with ignore_blockers, automations and undo may not.
+func (h *BoardHandler) startBlockers(cardID, listID int, completed bool) ([]models.RelatedCard, error) {
+	if completed {
+		return nil, nil
+	}
+	l, err := h.Lists.GetListByID(listID)
+	if err != nil || !isInProgressList(*l) {
+		return nil, nil
+	}
+	return h.Relations.OpenBlockers(cardID)
+}
+
+// describeCards renders cards as `#12 "Title"` for error messages.
+func describeCards(cards []models.RelatedCard) string {
+	parts := make([]string, len(cards))
+	for i, c := range cards {
+		parts[i] = "#" + strconv.Itoa(c.ID) + " " + strconv.Quote(c.Title)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// boardAccess returns a memoised canAccessBoard for the user, for checking the boards of many
+// related cards.
+func (h *BoardHandler) boardAccess(userID int) func(boardID int) bool {
+	access := map[int]bool{}
+	return func(boardID int) bool {
+		ok, seen := access[boardID]
+		if !seen {
+			ok = h.canAccessBoard(boardID, userID)
+			access[boardID] = ok
+		}
+		return ok
+	}
+}
+
+// visibleRelations drops relations to cards on boards the user cannot open.
+func (h *BoardHandler) visibleRelations(userID int, rels []models.CardRelation) []models.CardRelation {
+	canAccess := h.boardAccess(userID)
+	out := []models.CardRelation{}
+	for _, rel := range rels {
+		if canAccess(rel.Card.BoardID) {
+			out = append(out, rel)
+		}
+	}
+	return out
+}
+
+func (h *BoardHandler) GetCardRelations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, _, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	rels, err := h.Relations.GetRelationsByCard(card.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(h.visibleRelations(r.Context().Value("userID").(int), rels))
+}
+
+// AddCardRelation links the card to another card the user can open. blocks and duplicates
+// links may not form a cycle.
+func (h *BoardHandler) AddCardRelation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(int)
+
+	var body struct {
+		Type   models.RelationType `json:"type"`
+		CardID int                 `json:"card_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.CardID <= 0 {
+		http.Error(w, "type and card_id are required", http.StatusBadRequest)
+		return
+	}
+	if !models.ValidRelationType(body.Type) {
+		http.Error(w, "type must be one of blocks, blocked_by, relates_to, duplicates, duplicated_by", http.StatusBadRequest)
+		return
+	}
+	if body.CardID == card.ID {
+		http.Error(w, "a card cannot be related to itself", http.StatusBadRequest)
+		return
+	}
+	other, err := h.Cards.GetCardByID(body.CardID)
+	if err != nil {
+		http.Error(w, "related card not found", http.StatusNotFound)
+		return
+	}
+	if otherBoardID := h.cardBoardID(other); otherBoardID == nil || !h.canAccessBoard(*otherBoardID, userID) {
+		http.Error(w, "related card not found", http.StatusNotFound)
+		return
+	}
+
+	stored, from, to := models.StoredRelation(body.Type, card.ID, other.ID)
+	var created models.CardRelation
+	err = h.inTx(func(tx *BoardHandler) error {
+		if err := tx.Relations.LockRelations(); err != nil {
+			return err
+		}
+		if stored != models.RelationRelatesTo {
+			cycle, err := tx.Relations.Reaches(to, from, stored)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				return errRelationCycle
+			}
+		}
+		link, added, err := tx.Relations.AddRelation(from, to, stored, userID)
+		if err != nil {
+			return err
+		}
+		if !added {
+			return errRelationExists
+		}
+
+		rels, err := tx.Relations.GetRelationsByCard(card.ID)
+		if err != nil {
+			return err
+		}
+		for _, rel := range rels {
+			if rel.ID == link.ID {
+				created = rel
+			}
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			CardID:  &card.ID,
+			UserID:  userID,
+			Action:  models.ActionAddRelation,
+			Details: "marked that this card " + relationPhrases[body.Type] + " " + other.Title,
+			Refs:    map[string]int{"board": boardID, "card": card.ID, "related_card": other.ID, "relation": link.ID},
+			After:   map[string]interface{}{"relation_id": link.ID, "type": body.Type, "card_id": other.ID},
+		})
+		return err
+	})
+	if err == errRelationExists || err == errRelationCycle {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *BoardHandler) RemoveCardRelation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	relationID, err := strconv.Atoi(mux.Vars(r)["relationId"])
+	if err != nil || relationID <= 0 {
+		http.Error(w, "invalid relation id", http.StatusBadRequest)
+		return
+	}
+
+	rels, err := h.Relations.GetRelationsByCard(card.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var rel *models.CardRelation
+	for i := range rels {
+		if rels[i].ID == relationID {
+			rel = &rels[i]
+		}
+	}
+	if rel == nil {
+		http.Error(w, "relation not found", http.StatusNotFound)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	err = h.inTx(func(tx *BoardHandler) error {
+		if err := tx.Relations.DeleteRelation(rel.ID); err != nil {
+			return err
+		}
+		_, err := tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			CardID:  &card.ID,
+			UserID:  userID,
+			Action:  models.ActionRemoveRelation,
+			Details: "removed that this card " + relationPhrases[rel.Type] + " " + rel.Card.Title,
+			Refs:    map[string]int{"board": boardID, "card": card.ID, "related_card": rel.Card.ID},
+			Before:  map[string]interface{}{"relation_id": rel.ID, "type": rel.Type, "card_id": rel.Card.ID},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Relation deleted"})
+}
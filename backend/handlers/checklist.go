@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+// checklistForCard loads the {checklistId} route variable and checks it belongs to the card.
+func (h *BoardHandler) checklistForCard(w http.ResponseWriter, r *http.Request, card *models.Card) (*models.Checklist, bool) {
+	checklistID, err := strconv.Atoi(mux.Vars(r)["checklistId"])
+	if err != nil || checklistID <= 0 {
+		http.Error(w, "invalid checklist id", http.StatusBadRequest)
+		return nil, false
+	}
+	checklist, err := h.Checklists.GetChecklistByID(checklistID)
+	if err != nil || checklist.CardID != card.ID {
+		http.Error(w, "checklist not found", http.StatusNotFound)
+		return nil, false
+	}
+	return checklist, true
+}
+
+// parseOptionalDate reads an RFC3339 date; an empty string means no date.
+func parseOptionalDate(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// logChecklist records a change to a checklist of the card, or to one of its items when
+// itemID is not 0.
+func (h *BoardHandler) logChecklist(userID, boardID, cardID, checklistID, itemID int, action models.ActionType, details string, before, after interface{}) error {
+	refs := map[string]int{"board": boardID, "card": cardID, "checklist": checklistID}
+	if itemID != 0 {
+		refs["item"] = itemID
+	}
+	_, err := h.Activities.Log(models.ActivityEntry{
+		BoardID: &boardID,
+		CardID:  &cardID,
+		UserID:  userID,
+		Action:  action,
+		Details: details,
+		Refs:    refs,
+		Before:  before,
+		After:   after,
+	})
+	return err
+}
+
+// itemState is the part of a checklist item its edit activities record.
+func itemState(i *models.ChecklistItem) map[string]interface{} {
+	return map[string]interface{}{"item_id": i.ID, "text": i.Text, "position": i.Position, "assignee_id": i.AssigneeID, "due_date": i.DueDate}
+}
+
+func (h *BoardHandler) GetChecklists(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, _, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	checklists, err := h.Checklists.GetChecklistsByCard(card.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if checklists == nil {
+		checklists = []models.Checklist{}
+	}
+	json.NewEncoder(w).Encode(checklists)
+}
+
+func (h *BoardHandler) CreateChecklist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Title string `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Title) == "" {
+		http.Error(w, "title is required", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var checklist *models.Checklist
+	err := h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if checklist, err = tx.Checklists.CreateChecklist(card.ID, strings.TrimSpace(body.Title)); err != nil {
+			return err
+		}
+		return tx.logChecklist(userID, boardID, card.ID, checklist.ID, 0, models.ActionAddChecklist,
+			"added the checklist "+checklist.Title, nil, map[string]interface{}{"title": checklist.Title})
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(checklist)
+}
+
+func (h *BoardHandler) UpdateChecklist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	checklist, ok := h.checklistForCard(w, r, card)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Title    *string `json:"title"`
+		Position *int    `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	title := checklist.Title
+	if body.Title != nil && strings.TrimSpace(*body.Title) != "" {
+		title = strings.TrimSpace(*body.Title)
+	}
+	position := checklist.Position
+	if body.Position != nil {
+		siblings, err := h.Checklists.GetChecklistsByCard(card.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		position = clampPosition(*body.Position, len(siblings))
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var updated *models.Checklist
+	err := h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if updated, err = tx.Checklists.UpdateChecklist(checklist, title, position); err != nil {
+			return err
+		}
+		return tx.logChecklist(userID, boardID, card.ID, checklist.ID, 0, models.ActionEditChecklist, "edited the checklist "+updated.Title,
+			map[string]interface{}{"title": checklist.Title, "position": checklist.Position},
+			map[string]interface{}{"title": updated.Title, "position": updated.Position})
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *BoardHandler) DeleteChecklist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	checklist, ok := h.checklistForCard(w, r, card)
+	if !ok {
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	err := h.inTx(func(tx *BoardHandler) error {
+		if err := tx.Checklists.DeleteChecklist(checklist.ID); err != nil {
+			return err
+		}
+		return tx.logChecklist(userID, boardID, card.ID, checklist.ID, 0, models.ActionRemoveChecklist,
+			"removed the checklist "+checklist.Title+" and its "+strconv.Itoa(len(checklist.Items))+" items",
+			map[string]interface{}{"title": checklist.Title, "items": checklist.Items}, nil)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Checklist deleted"})
+}
+
+func (h *BoardHandler) AddChecklistItem(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	checklist, ok := h.checklistForCard(w, r, card)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Text       string `json:"text"`
+		AssigneeID *int   `json:"assignee_id"`
+		DueDate    string `json:"due_date"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Text) == "" {
+		http.Error(w, "text is required", http.StatusBadRequest)
+		return
+	}
+	due, err := parseOptionalDate(body.DueDate)
+	if err != nil {
+		http.Error(w, "due_date must be RFC3339", http.StatusBadRequest)
+		return
+	}
+	if body.AssigneeID != nil && !h.canAccessBoard(boardID, *body.AssigneeID) {
+		http.Error(w, "assignee is not a board member", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var item *models.ChecklistItem
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if item, err = tx.Checklists.AddItem(checklist.ID, strings.TrimSpace(body.Text), body.AssigneeID, due); err != nil {
+			return err
+		}
+		return tx.logChecklist(userID, boardID, card.ID, checklist.ID, item.ID, models.ActionAddChecklistItem,
+			"added \""+item.Text+"\" to "+checklist.Title, nil, itemState(item))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(item)
+}
+
+// UpdateChecklistItem is a partial update. assignee_id 0 and an empty due_date clear them;
+// flipping done logs check_item / uncheck_item.
+func (h *BoardHandler) UpdateChecklistItem(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	checklist, ok := h.checklistForCard(w, r, card)
+	if !ok {
+		return
+	}
+	itemID, err := strconv.Atoi(mux.Vars(r)["itemId"])
+	if err != nil || itemID <= 0 {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	existing, err := h.Checklists.GetItemByID(itemID)
+	if err != nil || existing.ChecklistID != checklist.ID {
+		http.Error(w, "item not found", http.StatusNotFound)
+		return
+	}
+	userID := r.Context().Value("userID").(int)
+
+	var body struct {
+		Text       *string `json:"text"`
+		Done       *bool   `json:"done"`
+		Position   *int    `json:"position"`
+		AssigneeID *int    `json:"assignee_id"`
+		DueDate    *string `json:"due_date"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	text := existing.Text
+	if body.Text != nil && strings.TrimSpace(*body.Text) != "" {
+		text = strings.TrimSpace(*body.Text)
+	}
+	done := existing.Done
+	if body.Done != nil {
+		done = *body.Done
+	}
+	position := existing.Position
+	if body.Position != nil {
+		position = clampPosition(*body.Position, len(checklist.Items))
+	}
+	assignee := existing.AssigneeID
+	if body.AssigneeID != nil {
+		assignee = nil
+		if *body.AssigneeID > 0 {
+			if !h.canAccessBoard(boardID, *body.AssigneeID) {
+				http.Error(w, "assignee is not a board member", http.StatusBadRequest)
+				return
+			}
+			assignee = body.AssigneeID
+		}
+	}
+	due := existing.DueDate
+	if body.DueDate != nil {
+		if due, err = parseOptionalDate(*body.DueDate); err != nil {
+			http.Error(w, "due_date must be RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var updated *models.ChecklistItem
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		updated, err = tx.Checklists.UpdateItem(existing, text, done, position, assignee, due, userID)
+		if err != nil {
+			return err
+		}
+		if updated.Done != existing.Done {
+			action, details := models.ActionCheckItem, "completed \""+updated.Text+"\" on "+checklist.Title
+			if !updated.Done {
+				action, details = models.ActionUncheckItem, "marked \""+updated.Text+"\" incomplete on "+checklist.Title
+			}
+			err := tx.logChecklist(userID, boardID, card.ID, checklist.ID, updated.ID, action, details,
+				map[string]interface{}{"item_id": updated.ID, "done": existing.Done},
+				map[string]interface{}{"item_id": updated.ID, "done": updated.Done})
+			if err != nil {
+				return err
+			}
+		}
+		if updated.Text == existing.Text && updated.Position == existing.Position &&
+			sameInt(updated.AssigneeID, existing.AssigneeID) && sameTime(updated.DueDate, existing.DueDate) {
+			return nil
+		}
+		return tx.logChecklist(userID, boardID, card.ID, checklist.ID, updated.ID, models.ActionEditChecklistItem,
+			"edited \""+updated.Text+"\" on "+checklist.Title, itemState(existing), itemState(updated))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *BoardHandler) DeleteChecklistItem(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	checklist, ok := h.checklistForCard(w, r, card)
+	if !ok {
+		return
+	}
+	itemID, err := strconv.Atoi(mux.Vars(r)["itemId"])
+	if err != nil || itemID <= 0 {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	item, err := h.Checklists.GetItemByID(itemID)
+	if err != nil || item.ChecklistID != checklist.ID {
+		http.Error(w, "item not found", http.StatusNotFound)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	err = h.inTx(func(tx *BoardHandler) error {
+		if err := tx.Checklists.DeleteItem(item.ID); err != nil {
+			return err
+		}
+		return tx.logChecklist(userID, boardID, card.ID, checklist.ID, item.ID, models.ActionRemoveChecklistItem,
+			"removed \""+item.Text+"\" from "+checklist.Title, itemState(item), nil)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Item deleted"})
+}
+
+// clampPosition keeps a requested position within [0, count-1].
+func clampPosition(position, count int) int {
+	if position >= count {
+		position = count - 1
+	}
+	if position < 0 {
+		position = 0
+	}
+	return position
+}
@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+// fieldForBoard loads the {fieldId} route variable and checks it belongs to the board.
+func (h *BoardHandler) fieldForBoard(w http.ResponseWriter, r *http.Request, boardID int) (*models.CustomField, bool) {
+	fieldID, err := strconv.Atoi(mux.Vars(r)["fieldId"])
+	if err != nil || fieldID <= 0 {
+		http.Error(w, "invalid field id", http.StatusBadRequest)
+		return nil, false
+	}
+	field, err := h.CustomFields.GetFieldByID(fieldID)
+	if err != nil || field.BoardID != boardID {
+		http.Error(w, "custom field not found", http.StatusNotFound)
+		return nil, false
+	}
+	return field, true
+}
+
+func (h *BoardHandler) ListCustomFields(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	fields, err := h.CustomFields.GetFieldsByBoard(board.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if fields == nil {
+		fields = []models.CustomField{}
+	}
+	json.NewEncoder(w).Encode(fields)
+}
+
+func (h *BoardHandler) CreateCustomField(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var field models.CustomField
+	if err := json.NewDecoder(r.Body).Decode(&field); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	field.BoardID = board.ID
+	if err := field.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var created *models.CustomField
+	err := h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if created, err = tx.CustomFields.CreateField(&field); err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionCreateCustomField,
+			Details: "added the custom field " + created.Name,
+			Refs:    map[string]int{"board": board.ID, "field": created.ID},
+			After:   map[string]interface{}{"name": created.Name, "type": created.Type, "options": created.Options},
+		})
+		return err
+	})
+	if err == models.ErrFieldExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// UpdateCustomField renames a field or changes its options. The type cannot change; removing
+// an option removes it from the cards that had it.
+func (h *BoardHandler) UpdateCustomField(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	field, ok := h.fieldForBoard(w, r, board.ID)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name    *string           `json:"name"`
+		Type    *models.FieldType `json:"type"`
+		Options *[]string         `json:"options"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	before := *field
+	if body.Type != nil && *body.Type != field.Type {
+		http.Error(w, "the type of a field cannot change", http.StatusBadRequest)
+		return
+	}
+	if body.Name != nil {
+		field.Name = *body.Name
+	}
+	if body.Options != nil {
+		field.Options = *body.Options
+	}
+	if err := field.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var updated *models.CustomField
+	err := h.inTx(func(tx *BoardHandler) error {
+		var cleared []int
+		var err error
+		if updated, cleared, err = tx.CustomFields.UpdateField(field); err != nil {
+			return err
+		}
+		details := "edited the custom field " + updated.Name
+		if removed := missingOptions(before.Options, updated.Options); len(removed) > 0 {
+			details += ", removing " + strings.Join(removed, ", ") + " from " + strconv.Itoa(len(cleared)) + " cards"
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionEditCustomField,
+			Details: details,
+			Refs:    map[string]int{"board": board.ID, "field": field.ID},
+			Before:  map[string]interface{}{"name": before.Name, "options": before.Options},
+			After:   map[string]interface{}{"name": updated.Name, "options": updated.Options, "cleared_card_ids": cleared},
+		})
+		return err
+	})
+	if err == models.ErrFieldExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *BoardHandler) DeleteCustomField(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	field, ok := h.fieldForBoard(w, r, board.ID)
+	if !ok {
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	err := h.inTx(func(tx *BoardHandler) error {
+		if err := tx.CustomFields.DeleteField(field.ID); err != nil {
+			return err
+		}
+		_, err := tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionDeleteCustomField,
+			Details: "deleted the custom field " + field.Name + " and its values",
+			Refs:    map[string]int{"board": board.ID, "field": field.ID},
+			Before:  map[string]interface{}{"name": field.Name, "type": field.Type, "options": field.Options},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Custom field deleted"})
+}
+
+// missingOptions lists the options of before that after no longer has.
+func missingOptions(before, after []string) []string {
+	kept := map[string]bool{}
+	for _, o := range after {
+		kept[o] = true
+	}
+	var removed []string
+	for _, o := range before {
+		if !kept[o] {
+			removed = append(removed, o)
+		}
+	}
+	return removed
+}
+
+// fieldChange is a validated custom field value from an UpdateCard body; Value is nil to clear.
+type fieldChange struct {
+	Field *models.CustomField
+	Value json.RawMessage
+}
+
+// parseFieldValues validates the custom_fields object of an UpdateCard body, keyed by field id,
+// against the fields of the card's board.
+func parseFieldValues(fields []models.CustomField, raw map[string]json.RawMessage) ([]fieldChange, error) {
+	byID := map[int]*models.CustomField{}
+	for i := range fields {
+		byID[fields[i].ID] = &fields[i]
+	}
+
+	var changes []fieldChange
+	for key, value := range raw {
+		id, err := strconv.Atoi(key)
+		field := byID[id]
+		if err != nil || field == nil {
+			return nil, fmt.Errorf("custom field %s is not on this board", key)
+		}
+		normalized, err := field.NormalizeValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("custom field %q: %v", field.Name, err)
+		}
+		changes = append(changes, fieldChange{Field: field, Value: normalized})
+	}
+	return changes, nil
+}
+
+// saveFieldValues stores the changes and logs one update_custom_field activity per value that
+// actually changed.
+func (h *BoardHandler) saveFieldValues(userID, boardID, cardID int, changes []fieldChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	current, err := h.CustomFields.GetValuesByCard(cardID)
+	if err != nil {
+		return err
+	}
+	before := map[int]json.RawMessage{}
+	for _, v := range current {
+		before[v.FieldID] = v.Value
+	}
+
+	for _, c := range changes {
+		old := before[c.Field.ID]
+		if bytes.Equal(compactJSON(old), compactJSON(c.Value)) {
+			continue
+		}
+		if err := h.CustomFields.SetValue(cardID, c.Field.ID, c.Value); err != nil {
+			return err
+		}
+		details := "cleared " + c.Field.Name
+		if c.Value != nil {
+			details = "set " + c.Field.Name + " to " + c.Field.FormatValue(c.Value)
+		}
+		_, err := h.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			CardID:  &cardID,
+			UserID:  userID,
+			Action:  models.ActionUpdateCustomField,
+			Details: details,
+			Refs:    map[string]int{"board": boardID, "card": cardID, "field": c.Field.ID},
+			Before:  map[string]interface{}{"field_id": c.Field.ID, "value": old},
+			After:   map[string]interface{}{"field_id": c.Field.ID, "value": c.Value},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compactJSON(raw json.RawMessage) []byte {
+	if raw == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return raw
+	}
+	return buf.Bytes()
+}
+
+// boardFieldQuery holds the custom field filters and sort of a GetBoard request:
+// cf.<fieldId>=<expr> keeps matching cards (see models.ParseFieldFilter) and
+// sort=cf.<fieldId> or sort=-cf.<fieldId> orders each list by the field.
+type boardFieldQuery struct {
+	Filters  []*models.FieldFilter
+	SortBy   *models.CustomField
+	SortDesc bool
+}
+
+func parseBoardFieldQuery(query url.Values, fields []models.CustomField) (*boardFieldQuery, error) {
+	byID := map[string]*models.CustomField{}
+	for i := range fields {
+		byID[strconv.Itoa(fields[i].ID)] = &fields[i]
+	}
+
+	q := &boardFieldQuery{}
+	for key, exprs := range query {
+		if !strings.HasPrefix(key, "cf.") {
+			continue
+		}
+		field := byID[strings.TrimPrefix(key, "cf.")]
+		if field == nil {
+			return nil, fmt.Errorf("%s: no such custom field on this board", key)
+		}
+		for _, expr := range exprs {
+			filter, err := models.ParseFieldFilter(field, expr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+			q.Filters = append(q.Filters, filter)
+		}
+	}
+
+	if s := query.Get("sort"); s != "" {
+		if strings.HasPrefix(s, "-") {
+			q.SortDesc, s = true, s[1:]
+		}
+		if !strings.HasPrefix(s, "cf.") || byID[strings.TrimPrefix(s, "cf.")] == nil {
+			return nil, fmt.Errorf("sort: %q is not a custom field of this board (use cf.<id> or -cf.<id>)", s)
+		}
+		q.SortBy = byID[strings.TrimPrefix(s, "cf.")]
+	}
+	return q, nil
+}
+
+// apply filters and sorts one list's cards, given every card's values on the board.
+func (q *boardFieldQuery) apply(cards []models.Card, values map[int][]models.CustomFieldValue) []models.Card {
+	valueOf := func(cardID, fieldID int) json.RawMessage {
+		for _, v := range values[cardID] {
+			if v.FieldID == fieldID {
+				return v.Value
+			}
+		}
+		return nil
+	}
+
+	kept := cards[:0]
+	for _, c := range cards {
+		ok := true
+		for _, f := range q.Filters {
+			if !f.Matches(valueOf(c.ID, f.Field.ID)) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			kept = append(kept, c)
+		}
+	}
+	if q.SortBy != nil {
+		sortValues := map[int]json.RawMessage{}
+		for _, c := range kept {
+			sortValues[c.ID] = valueOf(c.ID, q.SortBy.ID)
+		}
+		models.SortCards(kept, q.SortBy, sortValues, q.SortDesc)
+	}
+	return kept
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxMetricsDays bounds the date range of the flow metrics.
+const maxMetricsDays = 366
+
+// metricsRange reads the from and to days (YYYY-MM-DD, both included) of a metrics request, in
+// the tz time zone (UTC by default). It defaults to the last 30 days and returns the start of
+// every day in the range, then the end of the last one.
+func metricsRange(r *http.Request) ([]time.Time, time.Time, error) {
+	q := r.URL.Query()
+	loc := time.UTC
+	if tz := strings.TrimSpace(q.Get("tz")); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return nil, time.Time{}, errors.New("unknown time zone " + strconv.Quote(tz))
+		}
+	}
+	day := func(key string, fallback time.Time) (time.Time, error) {
+		raw := q.Get(key)
+		if raw == "" {
+			return fallback, nil
+		}
+		d, err := time.ParseInLocation("2006-01-02", raw, loc)
+		if err != nil {
+			return time.Time{}, errors.New(key + " must be a date such as 2006-01-02")
+		}
+		return d, nil
+	}
+
+	now := time.Now().In(loc)
+	to, err := day("to", time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	from, err := day("from", to.AddDate(0, 0, -29))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if to.Before(from) {
+		return nil, time.Time{}, errors.New("from must not be after to")
+	}
+
+	var days []time.Time
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if len(days) == maxMetricsDays {
+			return nil, time.Time{}, errors.New("the range cannot exceed " + strconv.Itoa(maxMetricsDays) + " days")
+		}
+		days = append(days, d)
+	}
+	return days, to.AddDate(0, 0, 1), nil
+}
+
+// GetCumulativeFlow returns, for each list of the board, how many cards it held at the end of
+// each day of the range.
+func (h *BoardHandler) GetCumulativeFlow(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	days, end, err := metricsRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dates := make([]string, len(days))
+	dayEnds := make([]time.Time, len(days))
+	for i, d := range days {
+		dates[i] = d.Format("2006-01-02")
+		if i+1 < len(days) {
+			dayEnds[i] = days[i+1]
+		} else {
+			dayEnds[i] = end
+		}
+	}
+	series, err := h.FlowMetrics.CumulativeFlow(board.ID, dayEnds)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":  dates[0],
+		"to":    dates[len(dates)-1],
+		"dates": dates,
+		"lists": series,
+	})
+}
+
+// GetCycleTimes returns lead and cycle time statistics of the board's cards done in the range.
+func (h *BoardHandler) GetCycleTimes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	days, end, err := metricsRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lead, cycle, err := h.FlowMetrics.LeadAndCycleTimes(board.ID, days[0], end)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":       days[0].Format("2006-01-02"),
+		"to":         days[len(days)-1].Format("2006-01-02"),
+		"lead_time":  lead,
+		"cycle_time": cycle,
+	})
+}
+
+// GetDwellTimes returns how long cards stayed in each list of the board, on average, over the
+// visits that started in the range.
+func (h *BoardHandler) GetDwellTimes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	days, end, err := metricsRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lists, err := h.FlowMetrics.DwellTimes(board.ID, days[0], end)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":  days[0].Format("2006-01-02"),
+		"to":    days[len(days)-1].Format("2006-01-02"),
+		"lists": lists,
+	})
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+// labelColors are the label colors the frontend knows how to draw.
+var labelColors = []string{"primary", "accent", "warning", "success", "destructive"}
+
+func isLabelColor(c string) bool {
+	for _, l := range labelColors {
+		if c == l {
+			return true
+		}
+	}
+	return false
+}
+
+// labelForBoard loads the {labelId} route variable and checks it belongs to the board.
+func (h *BoardHandler) labelForBoard(w http.ResponseWriter, r *http.Request, boardID int) (*models.Label, bool) {
+	labelID, err := strconv.Atoi(mux.Vars(r)["labelId"])
+	if err != nil || labelID <= 0 {
+		http.Error(w, "invalid label id", http.StatusBadRequest)
+		return nil, false
+	}
+	label, err := h.Labels.GetLabelByID(labelID)
+	if err != nil || label.BoardID != boardID {
+		http.Error(w, "label not found", http.StatusNotFound)
+		return nil, false
+	}
+	return label, true
+}
+
+func (h *BoardHandler) ListLabels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	labels, err := h.Labels.GetLabelsByBoard(board.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if labels == nil {
+		labels = []models.Label{}
+	}
+	json.NewEncoder(w).Encode(labels)
+}
+
+func (h *BoardHandler) CreateLabel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Name) == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if body.Color == "" {
+		body.Color = "primary"
+	}
+	if !isLabelColor(body.Color) {
+		http.Error(w, "color must be one of "+strings.Join(labelColors, ", "), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var label *models.Label
+	err := h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if label, err = tx.Labels.CreateLabel(board.ID, strings.TrimSpace(body.Name), body.Color); err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionCreateLabel,
+			Details: "added the label " + label.Name,
+			Refs:    map[string]int{"board": board.ID, "label": label.ID},
+			After:   map[string]interface{}{"name": label.Name, "color": label.Color},
+		})
+		return err
+	})
+	if err == models.ErrLabelExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(label)
+}
+
+// UpdateLabel renames or recolors a label; every card carrying it shows the change. A rename
+// is also applied to the board's automation rules that name the label.
+func (h *BoardHandler) UpdateLabel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	label, ok := h.labelForBoard(w, r, board.ID)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name  *string `json:"name"`
+		Color *string `json:"color"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	name, color := label.Name, label.Color
+	if body.Name != nil && strings.TrimSpace(*body.Name) != "" {
+		name = strings.TrimSpace(*body.Name)
+	}
+	if body.Color != nil {
+		if !isLabelColor(*body.Color) {
+			http.Error(w, "color must be one of "+strings.Join(labelColors, ", "), http.StatusBadRequest)
+			return
+		}
+		color = *body.Color
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var updated *models.Label
+	err := h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if updated, err = tx.Labels.UpdateLabel(label.ID, name, color); err != nil {
+			return err
+		}
+		if updated.Name != label.Name {
+			if err := tx.renameLabelInRules(board.ID, label.Name, updated.Name); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionEditLabel,
+			Details: "edited the label " + updated.Name,
+			Refs:    map[string]int{"board": board.ID, "label": label.ID},
+			Before:  map[string]interface{}{"name": label.Name, "color": label.Color},
+			After:   map[string]interface{}{"name": updated.Name, "color": updated.Color},
+		})
+		return err
+	})
+	if err == models.ErrLabelExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteLabel removes the label from the catalog and from every card of the board. It answers
+// 409 while an automation rule still names the label.
+func (h *BoardHandler) DeleteLabel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	label, ok := h.labelForBoard(w, r, board.ID)
+	if !ok {
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	err := h.inTx(func(tx *BoardHandler) error {
+		rules, err := tx.rulesUsingLabel(board.ID, label.Name)
+		if err != nil {
+			return err
+		}
+		if len(rules) > 0 {
+			return &labelInUseError{Rules: rules}
+		}
+		cardIDs, err := tx.Labels.DeleteLabel(label.ID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionDeleteLabel,
+			Details: "deleted the label " + label.Name + " and removed it from " + strconv.Itoa(len(cardIDs)) + " cards",
+			Refs:    map[string]int{"board": board.ID, "label": label.ID},
+			Before:  map[string]interface{}{"name": label.Name, "color": label.Color, "card_ids": cardIDs},
+		})
+		return err
+	})
+	var inUse *labelInUseError
+	if errors.As(err, &inUse) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Label deleted"})
+}
+
+// labelInUseError refuses to delete a label that automation rules still name: an add_tag
+// action would only create it again.
+type labelInUseError struct {
+	Rules []string
+}
+
+func (e *labelInUseError) Error() string {
+	return "label is used by automation rules " + strings.Join(e.Rules, ", ") + "; edit or delete them first"
+}
+
+// ruleTags returns the fields of a rule that name a label.
+func ruleTags(rule *models.AutomationRule) []*string {
+	tags := []*string{&rule.Trigger.Tag}
+	for j := range rule.Conditions {
+		tags = append(tags, &rule.Conditions[j].Tag)
+	}
+	for j := range rule.Actions {
+		tags = append(tags, &rule.Actions[j].Tag)
+	}
+	return tags
+}
+
+// rulesUsingLabel returns the quoted names of the board's automation rules that name the label.
+func (h *BoardHandler) rulesUsingLabel(boardID int, name string) ([]string, error) {
+	rules, err := h.Automations.GetRulesByBoard(boardID)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for i := range rules {
+		for _, tag := range ruleTags(&rules[i]) {
+			if strings.EqualFold(strings.TrimSpace(*tag), name) {
+				names = append(names, strconv.Quote(rules[i].Name))
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// renameLabelInRules points the board's automation rules that name oldName at newName.
+// Rules match labels by name, ignoring case.
+func (h *BoardHandler) renameLabelInRules(boardID int, oldName, newName string) error {
+	rules, err := h.Automations.GetRulesByBoard(boardID)
+	if err != nil {
+		return err
+	}
+	for i := range rules {
+		rule := &rules[i]
+		changed := false
+		for _, tag := range ruleTags(rule) {
+			if strings.EqualFold(strings.TrimSpace(*tag), oldName) {
+				*tag, changed = newName, true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if _, err := h.Automations.UpdateRule(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveCardLabels swaps the card's labels for the labels of the same names on toBoardID,
+// creating any it lacks, when a card moves to another board.
+func (h *BoardHandler) moveCardLabels(cardID, toBoardID int) error {
+	tags, err := h.CardTags.GetTagsByCard(cardID)
+	if err != nil {
+		return err
+	}
+	for _, t := range tags {
+		label, err := h.Labels.EnsureLabel(toBoardID, t.Name, t.Color)
+		if err != nil {
+			return err
+		}
+		if label.ID == t.ID {
+			continue
+		}
+		if err := h.CardTags.RemoveTag(cardID, t.ID); err != nil {
+			return err
+		}
+		if _, _, err := h.CardTags.AddTag(cardID, label.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cardChangedBoard follows up a card's move to toBoardID: its labels become the labels of the
+// same names there, and it loses its values for other boards' custom fields and its sprint.
+func (h *BoardHandler) cardChangedBoard(card *models.Card, toBoardID int) error {
+	if err := h.moveCardLabels(card.ID, toBoardID); err != nil {
+		return err
+	}
+	if err := h.CustomFields.DropValuesOffBoard(card.ID, toBoardID); err != nil {
+		return err
+	}
+	if card.SprintID == nil {
+		return nil
+	}
+	return h.Cards.SetPlanning(card.ID, nil, card.StoryPoints)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+// UpdateList renames a list, changes its accent or sets its WIP limit (null or 0 removes it).
+// Lowering the limit below the cards already in the list is allowed; it only stops new ones.
+func (h *BoardHandler) UpdateList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	listID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || listID <= 0 {
+		http.Error(w, "invalid list id", http.StatusBadRequest)
+		return
+	}
+	l, err := h.Lists.GetListByID(listID)
+	if err != nil {
+		http.Error(w, "list not found", http.StatusNotFound)
+		return
+	}
+	if !h.canAccessBoard(l.BoardID, r.Context().Value("userID").(int)) {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+
+	var body struct {
+		Title  *string `json:"title"`
+		Accent *string `json:"accent"`
+		// wip_limit null or 0 removes the limit.
+		WIPLimit json.RawMessage `json:"wip_limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	title, accent, limit := l.Title, l.Accent, l.WIPLimit
+	if body.Title != nil && strings.TrimSpace(*body.Title) != "" {
+		title = strings.TrimSpace(*body.Title)
+	}
+	if body.Accent != nil {
+		a := strings.TrimSpace(strings.ToLower(*body.Accent))
+		if !isPaletteColor(a) {
+			http.Error(w, "accent must be one of "+strings.Join(paletteColors, ", "), http.StatusBadRequest)
+			return
+		}
+		accent = a
+	}
+	if len(body.WIPLimit) > 0 {
+		limit = nil
+		if string(body.WIPLimit) != "null" {
+			var n int
+			if err := json.Unmarshal(body.WIPLimit, &n); err != nil || n < 0 {
+				http.Error(w, "wip_limit must be a positive whole number, or null", http.StatusBadRequest)
+				return
+			}
+			if n > 0 {
+				limit = &n
+			}
+		}
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var updated *models.List
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if updated, err = tx.Lists.UpdateList(l.ID, title, accent, limit); err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &l.BoardID,
+			UserID:  userID,
+			Action:  models.ActionEditList,
+			Details: "edited the list " + updated.Title,
+			Refs:    map[string]int{"board": l.BoardID, "list": l.ID},
+			Before:  map[string]interface{}{"title": l.Title, "accent": l.Accent, "wip_limit": l.WIPLimit},
+			After:   map[string]interface{}{"title": updated.Title, "accent": updated.Accent, "wip_limit": updated.WIPLimit},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+// UpdateBoardSettings changes the board's wip_policy: "block" answers 409 when a card would
+// go over a list's WIP limit, "warn" lets it in and flags the response.
+func (h *BoardHandler) UpdateBoardSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForOwner(w, r, "change board settings")
+	if !ok {
+		return
+	}
+
+	var body struct {
+		WIPPolicy *string `json:"wip_policy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if body.WIPPolicy == nil {
+		json.NewEncoder(w).Encode(board)
+		return
+	}
+	policy := strings.TrimSpace(strings.ToLower(*body.WIPPolicy))
+	if policy != models.WIPBlock && policy != models.WIPWarn {
+		http.Error(w, "wip_policy must be block or warn", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var updated *models.Board
+	err := h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if updated, err = tx.Boards.SetWIPPolicy(board.ID, policy); err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionUpdateSettings,
+			Details: "set the WIP policy to " + policy,
+			Refs:    map[string]int{"board": board.ID},
+			Before:  map[string]interface{}{"wip_policy": board.WIPPolicy},
+			After:   map[string]interface{}{"wip_policy": updated.WIPPolicy},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"trellomirror/backend/models"
+)
+
+// myCardGroup is a section of GetMyCards: a board, or a due date bucket.
+type myCardGroup struct {
+	Key     string                `json:"key"`
+	Title   string                `json:"title"`
+	BoardID int                   `json:"board_id,omitempty"`
+	Cards   []models.AssignedCard `json:"cards"`
+}
+
+// dueBuckets are the groups of GetMyCards?group=due, in order.
+var dueBuckets = []struct{ key, title string }{
+	{"overdue", "Overdue"},
+	{"today", "Today"},
+	{"this_week", "This week"},
+	{"later", "Later"},
+	{"no_date", "No due date"},
+	{"completed", "Completed"},
+}
+
+// weekBounds returns the start of today and of next Monday in loc.
+func weekBounds(now time.Time, loc *time.Location) (time.Time, time.Time) {
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	days := (8 - int(today.Weekday())) % 7
+	if days == 0 {
+		days = 7
+	}
+	return today, today.AddDate(0, 0, days)
+}
+
+// GetMyCards lists the cards the user is a member of across every board, grouped by board
+// (the default) or by due date. due=overdue|week|none keeps overdue cards, cards due between
+// now and the end of the week, or cards without a due date. Weeks start on Monday in tz
+// (UTC by default); completed cards are left out unless include_completed=true.
+func (h *BoardHandler) GetMyCards(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID := r.Context().Value("userID").(int)
+	q := r.URL.Query()
+
+	group := q.Get("group")
+	if group == "" {
+		group = "board"
+	}
+	if group != "board" && group != "due" {
+		http.Error(w, "group must be board or due", http.StatusBadRequest)
+		return
+	}
+	loc := time.UTC
+	if tz := strings.TrimSpace(q.Get("tz")); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			http.Error(w, "unknown time zone "+strconv.Quote(tz), http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now()
+	today, weekEnd := weekBounds(now, loc)
+	filter := models.AssignedCardFilter{IncludeCompleted: q.Get("include_completed") == "true"}
+	switch q.Get("due") {
+	case "":
+	case "overdue":
+		filter.DueBefore, filter.IncludeCompleted = &now, false
+	case "week":
+		filter.DueFrom, filter.DueBefore = &now, &weekEnd
+	case "none":
+		filter.NoDueDate = true
+	default:
+		http.Error(w, "due must be overdue, week or none", http.StatusBadRequest)
+		return
+	}
+
+	cards, err := h.CardMembers.CardsOfUser(userID, filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var groups []*myCardGroup
+	if group == "board" {
+		byBoard := map[int]*myCardGroup{}
+		for _, c := range cards {
+			g := byBoard[c.BoardID]
+			if g == nil {
+				g = &myCardGroup{Key: strconv.Itoa(c.BoardID), Title: c.BoardTitle, BoardID: c.BoardID}
+				byBoard[c.BoardID] = g
+				groups = append(groups, g)
+			}
+			g.Cards = append(g.Cards, c)
+		}
+		sort.SliceStable(groups, func(i, j int) bool {
+			return strings.ToLower(groups[i].Title) < strings.ToLower(groups[j].Title)
+		})
+	} else {
+		tomorrow := today.AddDate(0, 0, 1)
+		byKey := map[string]*myCardGroup{}
+		for _, b := range dueBuckets {
+			byKey[b.key] = &myCardGroup{Key: b.key, Title: b.title}
+		}
+		for _, c := range cards {
+			key := "later"
+			switch {
+			case c.Completed:
+				key = "completed"
+			case c.DueDate == nil:
+				key = "no_date"
+			case c.DueDate.Before(now):
+				key = "overdue"
+			case c.DueDate.Before(tomorrow):
+				key = "today"
+			case c.DueDate.Before(weekEnd):
+				key = "this_week"
+			}
+			byKey[key].Cards = append(byKey[key].Cards, c)
+		}
+		for _, b := range dueBuckets {
+			if g := byKey[b.key]; len(g.Cards) > 0 {
+				groups = append(groups, g)
+			}
+		}
+	}
+	if groups == nil {
+		groups = []*myCardGroup{}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"group":  group,
+		"groups": groups,
+		"total":  len(cards),
+	})
+}
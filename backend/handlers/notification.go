@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+type NotificationHandler struct {
+	Notifications *models.NotificationService
+}
+
+func NewNotificationHandler(db *sql.DB) *NotificationHandler {
+	return &NotificationHandler{
+		Notifications: &models.NotificationService{DB: db},
+	}
+}
+
+// queryInt reads a non-negative integer query parameter, falling back when absent or invalid.
+func queryInt(r *http.Request, key string, fallback int) int {
+	v, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil || v < 0 {
+		return fallback
+	}
+	return v
+}
+
+func (h *NotificationHandler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID := r.Context().Value("userID").(int)
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	limit := queryInt(r, "limit", 50)
+	if limit == 0 || limit > 200 {
+		limit = 50
+	}
+	offset := queryInt(r, "offset", 0)
+
+	notifications, err := h.Notifications.GetNotificationsByUser(userID, unreadOnly, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+	unread, err := h.Notifications.CountUnread(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifications,
+		"unread_count":  unread,
+	})
+}
+
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid notification id", http.StatusBadRequest)
+		return
+	}
+	userID := r.Context().Value("userID").(int)
+
+	found, err := h.Notifications.MarkRead(userID, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "notification not found", http.StatusNotFound)
+		return
+	}
+
+	unread, _ := h.Notifications.CountUnread(userID)
+	json.NewEncoder(w).Encode(map[string]int{"unread_count": unread})
+}
+
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID := r.Context().Value("userID").(int)
+
+	updated, err := h.Notifications.MarkAllRead(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]int{"updated": updated, "unread_count": 0})
+}
+
+func (h *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID := r.Context().Value("userID").(int)
+
+	prefs, err := h.Notifications.GetPreferences(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(prefs)
+}
+
+func (h *NotificationHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID := r.Context().Value("userID").(int)
+
+	prefs, err := h.Notifications.GetPreferences(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var body struct {
+		EmailEnabled    *bool   `json:"email_enabled"`
+		DigestFrequency *string `json:"digest_frequency"`
+		CardAssigned    *bool   `json:"card_assigned"`
+		BoardInvite     *bool   `json:"board_invite"`
+		CardComment     *bool   `json:"card_comment"`
+		DueReminder     *bool   `json:"due_reminder"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if body.EmailEnabled != nil {
+		prefs.EmailEnabled = *body.EmailEnabled
+	}
+	if body.DigestFrequency != nil {
+		if !models.ValidDigestFrequency(*body.DigestFrequency) {
+			http.Error(w, "digest_frequency must be one of off, hourly, daily", http.StatusBadRequest)
+			return
+		}
+		prefs.DigestFrequency = *body.DigestFrequency
+	}
+	if body.CardAssigned != nil {
+		prefs.CardAssigned = *body.CardAssigned
+	}
+	if body.BoardInvite != nil {
+		prefs.BoardInvite = *body.BoardInvite
+	}
+	if body.CardComment != nil {
+		prefs.CardComment = *body.CardComment
+	}
+	if body.DueReminder != nil {
+		prefs.DueReminder = *body.DueReminder
+	}
+
+	saved, err := h.Notifications.SavePreferences(*prefs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(saved)
+}
+
+// ConfirmUnsubscribe is public: it is reached from the link in digest emails.
+// Mail scanners and link previews follow GET links, so it only renders a form
+// that posts back to Unsubscribe.
+func (h *NotificationHandler) ConfirmUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := h.Notifications.ValidUnsubscribeToken(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid unsubscribe link", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(`<!DOCTYPE html><html><body style="font-family: sans-serif;">` +
+		`<form method="post" action="/api/unsubscribe?token=` + url.QueryEscape(token) + `">` +
+		`<p>Stop receiving email notifications? You can turn them back on in Settings.</p>` +
+		`<button type="submit">Unsubscribe</button>` +
+		`</form></body></html>`))
+}
+
+// Unsubscribe is public and turns email off. It serves both the confirmation
+// form and RFC 8058 one-click requests, which POST to the List-Unsubscribe URL.
+func (h *NotificationHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	found, err := h.Notifications.Unsubscribe(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "invalid unsubscribe link", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(`<!DOCTYPE html><html><body style="font-family: sans-serif;">` +
+		`<p>You have been unsubscribed from email notifications. You can turn them back on in Settings.</p>` +
+		`</body></html>`))
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+// cardForMember loads the card from the {id} route variable along with its board id, and
+// writes the error response itself when the card is missing or the caller cannot access it.
+func (h *BoardHandler) cardForMember(w http.ResponseWriter, r *http.Request) (*models.Card, int, bool) {
+	cardID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || cardID <= 0 {
+		http.Error(w, "invalid card id", http.StatusBadRequest)
+		return nil, 0, false
+	}
+	card, err := h.Cards.GetCardByID(cardID)
+	if err != nil {
+		http.Error(w, "card not found", http.StatusNotFound)
+		return nil, 0, false
+	}
+	boardID := h.cardBoardID(card)
+	if boardID == nil || !h.canAccessBoard(*boardID, r.Context().Value("userID").(int)) {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return nil, 0, false
+	}
+	return card, *boardID, true
+}
+
+func (h *BoardHandler) GetRecurrence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, _, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	rec, err := h.Recurrences.GetByCard(card.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "card does not recur", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(rec)
+}
+
+// SetRecurrence creates or replaces the card's recurrence rule.
+func (h *BoardHandler) SetRecurrence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(int)
+
+	var body struct {
+		TargetListID *int   `json:"target_list_id"`
+		Frequency    string `json:"frequency"`
+		Time         string `json:"time"`
+		Weekdays     []int  `json:"weekdays"`
+		MonthDay     int    `json:"month_day"`
+		Cron         string `json:"cron"`
+		Timezone     string `json:"timezone"`
+		Enabled      *bool  `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	rec := &models.CardRecurrence{
+		CardID:       card.ID,
+		TargetListID: card.ListID,
+		Frequency:    strings.TrimSpace(body.Frequency),
+		Time:         strings.TrimSpace(body.Time),
+		Weekdays:     body.Weekdays,
+		MonthDay:     body.MonthDay,
+		Cron:         strings.TrimSpace(body.Cron),
+		Timezone:     strings.TrimSpace(body.Timezone),
+		Enabled:      body.Enabled == nil || *body.Enabled,
+		CreatedBy:    userID,
+	}
+	if rec.Time == "" {
+		rec.Time = "09:00"
+	}
+	if rec.Timezone == "" {
+		rec.Timezone = "UTC"
+	}
+	if body.TargetListID != nil {
+		l, err := h.Lists.GetListByID(*body.TargetListID)
+		if err != nil || l.BoardID != boardID {
+			http.Error(w, "target list is not on this board", http.StatusBadRequest)
+			return
+		}
+		rec.TargetListID = l.ID
+	}
+	if err := rec.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var saved *models.CardRecurrence
+	err := h.inTx(func(tx *BoardHandler) error {
+		var before interface{}
+		if old, err := tx.Recurrences.GetByCard(card.ID); err == nil {
+			before = old
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+		var err error
+		if saved, err = tx.Recurrences.Save(rec); err != nil {
+			return err
+		}
+		details := "made this card recur " + saved.Frequency
+		if saved.Frequency == models.RecurCron {
+			details = "made this card recur on the schedule " + saved.Cron
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			CardID:  &card.ID,
+			UserID:  userID,
+			Action:  models.ActionSetRecurrence,
+			Details: details,
+			Refs:    map[string]int{"board": boardID, "card": card.ID, "list": saved.TargetListID},
+			Before:  before,
+			After:   saved,
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(saved)
+}
+
+func (h *BoardHandler) DeleteRecurrence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var deleted bool
+	err := h.inTx(func(tx *BoardHandler) error {
+		rec, err := tx.Recurrences.GetByCard(card.ID)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if deleted, err = tx.Recurrences.Delete(card.ID); err != nil || !deleted {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &boardID,
+			CardID:  &card.ID,
+			UserID:  userID,
+			Action:  models.ActionRemoveRecurrence,
+			Details: "stopped this card from recurring",
+			Refs:    map[string]int{"board": boardID, "card": card.ID},
+			Before:  rec,
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "card does not recur", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Recurrence removed"})
+}
+
+// PreviewRecurrence lists the next run times of the card's rule, in UTC and in the rule's timezone.
+func (h *BoardHandler) PreviewRecurrence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, _, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	rec, err := h.Recurrences.GetByCard(card.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "card does not recur", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	count := queryInt(r, "count", 5)
+	if count == 0 || count > 50 {
+		count = 5
+	}
+	times, err := rec.Occurrences(time.Now(), count)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	loc, _ := time.LoadLocation(rec.Timezone)
+
+	type occurrence struct {
+		At    time.Time `json:"at"`
+		Local string    `json:"local"`
+	}
+	out := make([]occurrence, len(times))
+	for i, t := range times {
+		out[i] = occurrence{At: t, Local: t.In(loc).Format(time.RFC3339)}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"timezone":    rec.Timezone,
+		"occurrences": out,
+	})
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/cardfilter"
+	"trellomirror/backend/models"
+)
+
+// boardFilterMatches applies the filter (a query) or filter_id (one of the user's saved filters
+// for the board) parameter of a board request. It returns the ids of the matching cards, or
+// nil when the request has no filter; on error it also returns the status to answer with.
+func (h *BoardHandler) boardFilterMatches(r *http.Request, boardID, userID int) (map[int]bool, int, error) {
+	query := r.URL.Query().Get("filter")
+	if raw := r.URL.Query().Get("filter_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return nil, http.StatusBadRequest, errors.New("invalid filter_id")
+		}
+		f, err := h.SavedFilters.GetFilterByID(id)
+		if err != nil || f.UserID != userID || f.BoardID != boardID {
+			return nil, http.StatusNotFound, errors.New("filter not found")
+		}
+		query = f.Query
+	}
+	n, err := cardfilter.Parse(query)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if n == nil {
+		return nil, 0, nil
+	}
+	cond, args := cardfilter.Compile(n, userID, time.Now())
+	matches, err := h.Cards.MatchingCardIDs(boardID, cond, args)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return matches, 0, nil
+}
+
+// filterForUser loads the {filterId} route variable and checks it is the user's filter for
+// the board.
+func (h *BoardHandler) filterForUser(w http.ResponseWriter, r *http.Request, boardID, userID int) (*models.SavedFilter, bool) {
+	filterID, err := strconv.Atoi(mux.Vars(r)["filterId"])
+	if err != nil || filterID <= 0 {
+		http.Error(w, "invalid filter id", http.StatusBadRequest)
+		return nil, false
+	}
+	f, err := h.SavedFilters.GetFilterByID(filterID)
+	if err != nil || f.BoardID != boardID || f.UserID != userID {
+		http.Error(w, "filter not found", http.StatusNotFound)
+		return nil, false
+	}
+	return f, true
+}
+
+func (h *BoardHandler) ListSavedFilters(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	filters, err := h.SavedFilters.GetFilters(r.Context().Value("userID").(int), board.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if filters == nil {
+		filters = []models.SavedFilter{}
+	}
+	json.NewEncoder(w).Encode(filters)
+}
+
+// CreateSavedFilter saves a filter query under a name. The query must parse, so a saved
+// filter never fails later for its syntax.
+func (h *BoardHandler) CreateSavedFilter(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name  string `json:"name"`
+		Query string `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Name) == "" || strings.TrimSpace(body.Query) == "" {
+		http.Error(w, "name and query are required", http.StatusBadRequest)
+		return
+	}
+	if _, err := cardfilter.Parse(body.Query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var f *models.SavedFilter
+	err := h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if f, err = tx.SavedFilters.CreateFilter(userID, board.ID, strings.TrimSpace(body.Name), strings.TrimSpace(body.Query)); err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionCreateFilter,
+			Details: "saved the filter " + f.Name,
+			Refs:    map[string]int{"board": board.ID, "filter": f.ID},
+			After:   map[string]interface{}{"name": f.Name, "query": f.Query},
+		})
+		return err
+	})
+	if err == models.ErrFilterExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(f)
+}
+
+func (h *BoardHandler) UpdateSavedFilter(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	f, ok := h.filterForUser(w, r, board.ID, r.Context().Value("userID").(int))
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name  *string `json:"name"`
+		Query *string `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	name, query := f.Name, f.Query
+	if body.Name != nil && strings.TrimSpace(*body.Name) != "" {
+		name = strings.TrimSpace(*body.Name)
+	}
+	if body.Query != nil {
+		if strings.TrimSpace(*body.Query) == "" {
+			http.Error(w, "query cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if _, err := cardfilter.Parse(*body.Query); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query = strings.TrimSpace(*body.Query)
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var updated *models.SavedFilter
+	err := h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if updated, err = tx.SavedFilters.UpdateFilter(f.ID, name, query); err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionEditFilter,
+			Details: "edited the filter " + updated.Name,
+			Refs:    map[string]int{"board": board.ID, "filter": f.ID},
+			Before:  map[string]interface{}{"name": f.Name, "query": f.Query},
+			After:   map[string]interface{}{"name": updated.Name, "query": updated.Query},
+		})
+		return err
+	})
+	if err == models.ErrFilterExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *BoardHandler) DeleteSavedFilter(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	f, ok := h.filterForUser(w, r, board.ID, r.Context().Value("userID").(int))
+	if !ok {
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	err := h.inTx(func(tx *BoardHandler) error {
+		if err := tx.SavedFilters.DeleteFilter(f.ID); err != nil {
+			return err
+		}
+		_, err := tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionDeleteFilter,
+			Details: "deleted the filter " + f.Name,
+			Refs:    map[string]int{"board": board.ID, "filter": f.ID},
+			Before:  map[string]interface{}{"name": f.Name, "query": f.Query},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Filter deleted"})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"trellomirror/backend/cardfilter"
+	"trellomirror/backend/models"
+)
+
+// SearchCards runs a full-text search over the titles, descriptions, comments and labels of
+// the cards the user can see, optionally on one board (board_id). A filter in the card
+// filter language narrows the results, or lists matching cards on its own when q is empty.
+func (h *BoardHandler) SearchCards(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID := r.Context().Value("userID").(int)
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	limit := queryInt(r, "limit", 20)
+	if limit == 0 || limit > 50 {
+		limit = 20
+	}
+	offset := queryInt(r, "offset", 0)
+	boardID := queryInt(r, "board_id", 0)
+	if boardID > 0 && !h.canAccessBoard(boardID, userID) {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+
+	filter, err := cardfilter.Parse(r.URL.Query().Get("filter"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cond, args := cardfilter.Compile(filter, userID, time.Now())
+
+	hits, total := []models.SearchHit{}, 0
+	if len(query) >= 2 || filter != nil {
+		if len(query) >= 2 {
+			hits, total, err = h.Search.SearchCards(userID, boardID, query, cond, args, limit, offset)
+		} else {
+			hits, total, err = h.Search.FilterCards(userID, boardID, cond, args, limit, offset)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if hits == nil {
+			hits = []models.SearchHit{}
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": hits,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
@@ -0,0 +1,464 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+// maxStoryPoints bounds a card estimate.
+const maxStoryPoints = 1000
+
+// parseCardPlanning works out the sprint and estimate of a card update. A card moving to another
+// board leaves its sprint, and only an open sprint of the target board can be chosen; a nil
+// sprintID or raw points keep the current values.
+func (h *BoardHandler) parseCardPlanning(existing *models.Card, targetBoardID, sprintID *int, rawPoints json.RawMessage) (*int, *float64, error) {
+	newSprintID := existing.SprintID
+	if from := h.cardBoardID(existing); from == nil || targetBoardID == nil || *from != *targetBoardID {
+		newSprintID = nil
+	}
+	if sprintID != nil {
+		newSprintID = nil
+		if *sprintID > 0 {
+			sp, err := h.Sprints.GetSprintByID(*sprintID)
+			if err != nil || targetBoardID == nil || sp.BoardID != *targetBoardID {
+				return nil, nil, errors.New("sprint must belong to the card's board")
+			}
+			if sp.State == models.SprintClosed {
+				return nil, nil, errors.New("sprint is closed")
+			}
+			newSprintID = &sp.ID
+		}
+	}
+
+	newPoints := existing.StoryPoints
+	if len(rawPoints) > 0 {
+		if string(rawPoints) == "null" {
+			newPoints = nil
+		} else {
+			var p float64
+			if err := json.Unmarshal(rawPoints, &p); err != nil || p < 0 || p > maxStoryPoints {
+				return nil, nil, errors.New("story_points must be a number between 0 and " + strconv.Itoa(maxStoryPoints))
+			}
+			p = math.Round(p*10) / 10
+			newPoints = &p
+		}
+	}
+	return newSprintID, newPoints, nil
+}
+
+// parseSprintDates checks the start and end days of a sprint (YYYY-MM-DD, both included).
+func parseSprintDates(start, end string) (string, string, error) {
+	s, err := time.Parse("2006-01-02", strings.TrimSpace(start))
+	if err != nil {
+		return "", "", errors.New("start_date must be a date such as 2006-01-02")
+	}
+	e, err := time.Parse("2006-01-02", strings.TrimSpace(end))
+	if err != nil {
+		return "", "", errors.New("end_date must be a date such as 2006-01-02")
+	}
+	if e.Before(s) {
+		return "", "", errors.New("end_date must not be before start_date")
+	}
+	return s.Format("2006-01-02"), e.Format("2006-01-02"), nil
+}
+
+// sprintForBoard loads the {sprintId} route variable and checks it is a sprint of the board.
+func (h *BoardHandler) sprintForBoard(w http.ResponseWriter, r *http.Request, boardID int) (*models.Sprint, bool) {
+	sprintID, err := strconv.Atoi(mux.Vars(r)["sprintId"])
+	if err != nil || sprintID <= 0 {
+		http.Error(w, "invalid sprint id", http.StatusBadRequest)
+		return nil, false
+	}
+	sp, err := h.Sprints.GetSprintByID(sprintID)
+	if err != nil || sp.BoardID != boardID {
+		http.Error(w, "sprint not found", http.StatusNotFound)
+		return nil, false
+	}
+	return sp, true
+}
+
+func (h *BoardHandler) ListSprints(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	sprints, err := h.Sprints.GetSprintsByBoard(board.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sprints == nil {
+		sprints = []models.Sprint{}
+	}
+	json.NewEncoder(w).Encode(sprints)
+}
+
+// CreateSprint plans a sprint; it starts only when asked to.
+func (h *BoardHandler) CreateSprint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name      string `json:"name"`
+		Goal      string `json:"goal"`
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Name) == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	start, end, err := parseSprintDates(body.StartDate, body.EndDate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var sp *models.Sprint
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if sp, err = tx.Sprints.CreateSprint(board.ID, strings.TrimSpace(body.Name), strings.TrimSpace(body.Goal), start, end); err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionCreateSprint,
+			Details: "planned " + sp.Name,
+			Refs:    map[string]int{"board": board.ID, "sprint": sp.ID},
+			After:   map[string]interface{}{"name": sp.Name, "goal": sp.Goal, "start_date": sp.StartDate, "end_date": sp.EndDate},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sp)
+}
+
+func (h *BoardHandler) UpdateSprint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	sp, ok := h.sprintForBoard(w, r, board.ID)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name      *string `json:"name"`
+		Goal      *string `json:"goal"`
+		StartDate *string `json:"start_date"`
+		EndDate   *string `json:"end_date"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	name, goal, start, end := sp.Name, sp.Goal, sp.StartDate, sp.EndDate
+	if body.Name != nil && strings.TrimSpace(*body.Name) != "" {
+		name = strings.TrimSpace(*body.Name)
+	}
+	if body.Goal != nil {
+		goal = strings.TrimSpace(*body.Goal)
+	}
+	if body.StartDate != nil {
+		start = *body.StartDate
+	}
+	if body.EndDate != nil {
+		end = *body.EndDate
+	}
+	start, end, err := parseSprintDates(start, end)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var updated *models.Sprint
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if updated, err = tx.Sprints.UpdateSprint(sp.ID, name, goal, start, end); err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionEditSprint,
+			Details: "edited " + updated.Name,
+			Refs:    map[string]int{"board": board.ID, "sprint": sp.ID},
+			Before:  map[string]interface{}{"name": sp.Name, "goal": sp.Goal, "start_date": sp.StartDate, "end_date": sp.EndDate},
+			After:   map[string]interface{}{"name": updated.Name, "goal": updated.Goal, "start_date": updated.StartDate, "end_date": updated.EndDate},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteSprint removes a sprint; its cards go back to the backlog.
+func (h *BoardHandler) DeleteSprint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	sp, ok := h.sprintForBoard(w, r, board.ID)
+	if !ok {
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	err := h.inTx(func(tx *BoardHandler) error {
+		if err := tx.Sprints.DeleteSprint(sp.ID); err != nil {
+			return err
+		}
+		_, err := tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionDeleteSprint,
+			Details: "deleted " + sp.Name,
+			Refs:    map[string]int{"board": board.ID, "sprint": sp.ID},
+			Before:  map[string]interface{}{"name": sp.Name, "state": sp.State, "start_date": sp.StartDate, "end_date": sp.EndDate},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Sprint deleted"})
+}
+
+// StartSprint makes a planned sprint the board's active one. A board runs one sprint at a time.
+func (h *BoardHandler) StartSprint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	sp, ok := h.sprintForBoard(w, r, board.ID)
+	if !ok {
+		return
+	}
+	if sp.State != models.SprintPlanned {
+		http.Error(w, "only a planned sprint can be started", http.StatusConflict)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var started *models.Sprint
+	err := h.inTx(func(tx *BoardHandler) error {
+		if err := tx.Sprints.SetState(sp.ID, models.SprintActive); err != nil {
+			return err
+		}
+		var err error
+		if started, err = tx.Sprints.GetSprintByID(sp.ID); err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionStartSprint,
+			Details: "started " + sp.Name,
+			Refs:    map[string]int{"board": board.ID, "sprint": sp.ID},
+			Before:  map[string]interface{}{"state": sp.State},
+			After:   map[string]interface{}{"state": started.State},
+		})
+		return err
+	})
+	if err == models.ErrSprintActive {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(started)
+}
+
+// CloseSprint ends the active sprint. Its unfinished cards move to next_sprint_id when given,
+// else to the board's next planned sprint, else back to the backlog.
+func (h *BoardHandler) CloseSprint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	sp, ok := h.sprintForBoard(w, r, board.ID)
+	if !ok {
+		return
+	}
+	if sp.State != models.SprintActive {
+		http.Error(w, "only the active sprint can be closed", http.StatusConflict)
+		return
+	}
+
+	var body struct {
+		NextSprintID *int `json:"next_sprint_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+	}
+	var next *models.Sprint
+	if body.NextSprintID != nil {
+		n, err := h.Sprints.GetSprintByID(*body.NextSprintID)
+		if err != nil || n.BoardID != board.ID || n.ID == sp.ID || n.State == models.SprintClosed {
+			http.Error(w, "next_sprint_id must be another open sprint of the board", http.StatusBadRequest)
+			return
+		}
+		next = n
+	} else {
+		n, err := h.Sprints.NextPlannedSprint(board.ID, sp.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		next = n
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var closed *models.Sprint
+	var carried []int
+	err := h.inTx(func(tx *BoardHandler) error {
+		var nextID *int
+		details := "closed " + sp.Name
+		if next != nil {
+			nextID = &next.ID
+		}
+		var err error
+		if carried, err = tx.Sprints.CarryOver(sp.ID, nextID); err != nil {
+			return err
+		}
+		if len(carried) > 0 {
+			dest := "the backlog"
+			if next != nil {
+				dest = next.Name
+			}
+			details += " and moved " + strconv.Itoa(len(carried)) + " unfinished cards to " + dest
+		}
+		if err := tx.Sprints.SetState(sp.ID, models.SprintClosed); err != nil {
+			return err
+		}
+		if closed, err = tx.Sprints.GetSprintByID(sp.ID); err != nil {
+			return err
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionCloseSprint,
+			Details: details,
+			Refs:    map[string]int{"board": board.ID, "sprint": sp.ID},
+			Before:  map[string]interface{}{"state": sp.State},
+			After:   map[string]interface{}{"state": closed.State, "carried_over": carried, "next_sprint_id": nextID},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if carried == nil {
+		carried = []int{}
+	}
+	if next != nil {
+		if n, err := h.Sprints.GetSprintByID(next.ID); err == nil {
+			next = n
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sprint":       closed,
+		"carried_over": carried,
+		"next_sprint":  next,
+	})
+}
+
+// GetSprintBurndown returns, for each day of the sprint in the tz time zone, the points and
+// cards done and remaining by the end of that day, next to an ideal line reaching zero on the
+// last day. Days still to come are null. The scope is the sprint's current cards.
+func (h *BoardHandler) GetSprintBurndown(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	sp, ok := h.sprintForBoard(w, r, board.ID)
+	if !ok {
+		return
+	}
+	loc := time.UTC
+	if tz := strings.TrimSpace(r.URL.Query().Get("tz")); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			http.Error(w, "unknown time zone "+strconv.Quote(tz), http.StatusBadRequest)
+			return
+		}
+	}
+
+	start, _ := time.ParseInLocation("2006-01-02", sp.StartDate, loc)
+	end, _ := time.ParseInLocation("2006-01-02", sp.EndDate, loc)
+	var dates []string
+	var dayEnds []time.Time
+	for d := start; !d.After(end) && len(dates) < maxMetricsDays; d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d.Format("2006-01-02"))
+		dayEnds = append(dayEnds, d.AddDate(0, 0, 1))
+	}
+
+	progress, err := h.Sprints.Progress(sp.ID, dayEnds)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	n := len(dates)
+	now := time.Now()
+	ideal := make([]float64, n)
+	remainingPoints, completedPoints := make([]*float64, n), make([]*float64, n)
+	remainingCards, completedCards := make([]*int, n), make([]*int, n)
+	for i := range dates {
+		ideal[i] = math.Round(progress.TotalPoints*(1-float64(i+1)/float64(n))*100) / 100
+		if dayEnds[i].AddDate(0, 0, -1).After(now) {
+			continue
+		}
+		done, left := progress.DonePoints[i], progress.TotalPoints-progress.DonePoints[i]
+		doneCards, leftCards := progress.DoneCards[i], progress.TotalCards-progress.DoneCards[i]
+		completedPoints[i], remainingPoints[i] = &done, &left
+		completedCards[i], remainingCards[i] = &doneCards, &leftCards
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sprint_id":        sp.ID,
+		"dates":            dates,
+		"total_points":     progress.TotalPoints,
+		"total_cards":      progress.TotalCards,
+		"ideal_points":     ideal,
+		"remaining_points": remainingPoints,
+		"completed_points": completedPoints,
+		"remaining_cards":  remainingCards,
+		"completed_cards":  completedCards,
+	})
+}
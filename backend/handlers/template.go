@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+// maxTemplateCards bounds the sample cards saved with a template.
+const maxTemplateCards = 100
+
+// templateForUser loads the {id} route variable and checks the user can see the template:
+// built-in or their own.
+func (h *BoardHandler) templateForUser(w http.ResponseWriter, r *http.Request) (*models.BoardTemplate, bool) {
+	templateID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || templateID <= 0 {
+		http.Error(w, "invalid template id", http.StatusBadRequest)
+		return nil, false
+	}
+	t, err := h.Templates.GetTemplateByID(templateID)
+	if err != nil || (t.UserID != nil && *t.UserID != r.Context().Value("userID").(int)) {
+		http.Error(w, "template not found", http.StatusNotFound)
+		return nil, false
+	}
+	return t, true
+}
+
+// applyTemplate fills a new board with the template's labels, lists and sample cards. Sample
+// cards skip the WIP check: they come with the board, as the template saved them, and a list
+// over its limit only refuses the cards added after.
+func (h *BoardHandler) applyTemplate(boardID int, content models.TemplateContent) error {
+	labels := map[string]int{}
+	ensure := func(name, color string) (int, error) {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if id, ok := labels[key]; ok {
+			return id, nil
+		}
+		if !isLabelColor(color) {
+			color = labelColors[0]
+		}
+		l, err := h.Labels.EnsureLabel(boardID, strings.TrimSpace(name), color)
+		if err != nil {
+			return 0, err
+		}
+		labels[key] = l.ID
+		return l.ID, nil
+	}
+	for _, l := range content.Labels {
+		if _, err := ensure(l.Name, l.Color); err != nil {
+			return err
+		}
+	}
+
+	for i, tl := range content.Lists {
+		list, err := h.Lists.CreateList(boardID, tl.Title, tl.Accent, i)
+		if err != nil {
+			return err
+		}
+		if tl.WIPLimit != nil && *tl.WIPLimit > 0 {
+			if list, err = h.Lists.UpdateList(list.ID, list.Title, list.Accent, tl.WIPLimit); err != nil {
+				return err
+			}
+		}
+		for pos, tc := range tl.Cards {
+			card, err := h.Cards.CreateCard(list.ID, tc.Title, "", normalizeCardColor("", *list), pos)
+			if err != nil {
+				return err
+			}
+			if tc.Description != "" {
+				if _, err := h.Cards.UpdateCard(card.ID, card.Title, tc.Description, card.Badge, card.Color, card.ListID, card.Position, nil); err != nil {
+					return err
+				}
+			}
+			for _, name := range tc.Labels {
+				labelID, err := ensure(name, "")
+				if err != nil {
+					return err
+				}
+				if _, _, err := h.CardTags.AddTag(card.ID, labelID); err != nil {
+					return err
+				}
+			}
+			for _, tcl := range tc.Checklists {
+				cl, err := h.Checklists.CreateChecklist(card.ID, tcl.Title)
+				if err != nil {
+					return err
+				}
+				for _, text := range tcl.Items {
+					if _, err := h.Checklists.AddItem(cl.ID, text, nil, nil); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// templateFromBoard describes the board as a template: its labels, its lists with their
+// accents and WIP limits and, when withCards is set, up to maxTemplateCards of its cards with
+// their descriptions, labels and checklist items (unchecked). Dates, members, comments and
+// attachments are left out.
+func (h *BoardHandler) templateFromBoard(boardID int, withCards bool) (models.TemplateContent, error) {
+	content := models.TemplateContent{Labels: []models.TemplateLabel{}, Lists: []models.TemplateList{}}
+	labels, err := h.Labels.GetLabelsByBoard(boardID)
+	if err != nil {
+		return content, err
+	}
+	for _, l := range labels {
+		content.Labels = append(content.Labels, models.TemplateLabel{Name: l.Name, Color: l.Color})
+	}
+
+	lists, err := h.Lists.GetListsByBoard(boardID)
+	if err != nil {
+		return content, err
+	}
+	saved := 0
+	for _, l := range lists {
+		tl := models.TemplateList{Title: l.Title, Accent: l.Accent, WIPLimit: l.WIPLimit, Cards: []models.TemplateCard{}}
+		if withCards {
+			cards, err := h.Cards.GetCardsByList(l.ID)
+			if err != nil {
+				return content, err
+			}
+			for _, c := range cards {
+				if saved == maxTemplateCards {
+					break
+				}
+				saved++
+				tc := models.TemplateCard{Title: c.Title, Description: c.Description}
+				tags, err := h.CardTags.GetTagsByCard(c.ID)
+				if err != nil {
+					return content, err
+				}
+				for _, t := range tags {
+					tc.Labels = append(tc.Labels, t.Name)
+				}
+				checklists, err := h.Checklists.GetChecklistsByCard(c.ID)
+				if err != nil {
+					return content, err
+				}
+				for _, cl := range checklists {
+					tcl := models.TemplateChecklist{Title: cl.Title, Items: []string{}}
+					for _, it := range cl.Items {
+						tcl.Items = append(tcl.Items, it.Text)
+					}
+					tc.Checklists = append(tc.Checklists, tcl)
+				}
+				tl.Cards = append(tl.Cards, tc)
+			}
+		}
+		content.Lists = append(content.Lists, tl)
+	}
+	return content, nil
+}
+
+// ListTemplates returns the built-in templates, then the user's own.
+func (h *BoardHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	templates, err := h.Templates.GetTemplates(r.Context().Value("userID").(int))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if templates == nil {
+		templates = []models.BoardTemplate{}
+	}
+	json.NewEncoder(w).Encode(templates)
+}
+
+func (h *BoardHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	t, ok := h.templateForUser(w, r)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(t)
+}
+
+// DeleteTemplate removes one of the user's templates. Built-in templates stay.
+func (h *BoardHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	t, ok := h.templateForUser(w, r)
+	if !ok {
+		return
+	}
+	if t.BuiltIn {
+		http.Error(w, "built-in templates cannot be deleted", http.StatusForbidden)
+		return
+	}
+
+	if err := h.Templates.DeleteTemplate(t.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Template deleted"})
+}
+
+// SaveBoardAsTemplate saves the board's structure as a template of the user. include_cards
+// (default true) keeps its cards as sample cards.
+func (h *BoardHandler) SaveBoardAsTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name         string `json:"name"`
+		Description  string `json:"description"`
+		IncludeCards *bool  `json:"include_cards"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+	}
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		name = board.Title
+	}
+
+	content, err := h.templateFromBoard(board.ID, body.IncludeCards == nil || *body.IncludeCards)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t, err := h.Templates.CreateTemplate(r.Context().Value("userID").(int), name, strings.TrimSpace(body.Description), content)
+	if err == models.ErrTemplateExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
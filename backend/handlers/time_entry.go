@@ -0,0 +1,465 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+// maxEntryDuration bounds a time entry entered by hand.
+const maxEntryDuration = 24 * time.Hour
+
+// timeEntryForCard loads the {entryId} route variable and checks it belongs to the card.
+func (h *BoardHandler) timeEntryForCard(w http.ResponseWriter, r *http.Request, card *models.Card) (*models.TimeEntry, bool) {
+	entryID, err := strconv.Atoi(mux.Vars(r)["entryId"])
+	if err != nil || entryID <= 0 {
+		http.Error(w, "invalid time entry id", http.StatusBadRequest)
+		return nil, false
+	}
+	e, err := h.TimeEntries.GetEntryByID(entryID)
+	if err != nil || e.CardID != card.ID {
+		http.Error(w, "time entry not found", http.StatusNotFound)
+		return nil, false
+	}
+	return e, true
+}
+
+// parseEntryTimes checks the bounds of a time entry: RFC3339, the end after the start and at
+// most a day apart.
+func parseEntryTimes(start, end string) (time.Time, time.Time, error) {
+	s, err := time.Parse(time.RFC3339, strings.TrimSpace(start))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("started_at must be an RFC3339 date such as 2006-01-02T15:04:05Z")
+	}
+	e, err := time.Parse(time.RFC3339, strings.TrimSpace(end))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("ended_at must be an RFC3339 date such as 2006-01-02T15:04:05Z")
+	}
+	if !e.After(s) {
+		return time.Time{}, time.Time{}, errors.New("ended_at must be after started_at")
+	}
+	if e.Sub(s) > maxEntryDuration {
+		return time.Time{}, time.Time{}, errors.New("a time entry cannot last more than 24 hours")
+	}
+	return s, e, nil
+}
+
+// entryState is the part of a time entry its activities record.
+func entryState(e *models.TimeEntry) map[string]interface{} {
+	return map[string]interface{}{"entry_id": e.ID, "started_at": e.StartedAt, "ended_at": e.EndedAt, "note": e.Note}
+}
+
+// hoursMinutes formats a duration in seconds as "45m" or "1h05m".
+func hoursMinutes(seconds int) string {
+	h, m := seconds/3600, seconds%3600/60
+	if h == 0 {
+		return strconv.Itoa(m) + "m"
+	}
+	return fmt.Sprintf("%dh%02dm", h, m)
+}
+
+// logTimeEntry records a change to a time entry of the card.
+func (h *BoardHandler) logTimeEntry(userID, boardID int, e *models.TimeEntry, action models.ActionType, details string, before, after interface{}) error {
+	_, err := h.Activities.Log(models.ActivityEntry{
+		BoardID: &boardID,
+		CardID:  &e.CardID,
+		UserID:  userID,
+		Action:  action,
+		Details: details,
+		Refs:    map[string]int{"board": boardID, "card": e.CardID, "time_entry": e.ID},
+		Before:  before,
+		After:   after,
+	})
+	return err
+}
+
+func (h *BoardHandler) GetTimeEntries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, _, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := h.TimeEntries.GetEntriesByCard(card.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []models.TimeEntry{}
+	}
+	total := 0
+	for _, e := range entries {
+		total += e.Seconds
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries":       entries,
+		"total_seconds": total,
+	})
+}
+
+// CreateTimeEntry records time spent on the card by hand, as started_at and either ended_at
+// or minutes.
+func (h *BoardHandler) CreateTimeEntry(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		StartedAt string `json:"started_at"`
+		EndedAt   string `json:"ended_at"`
+		Minutes   int    `json:"minutes"`
+		Note      string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if body.EndedAt == "" && body.Minutes > 0 {
+		if s, err := time.Parse(time.RFC3339, strings.TrimSpace(body.StartedAt)); err == nil {
+			body.EndedAt = s.Add(time.Duration(body.Minutes) * time.Minute).Format(time.RFC3339)
+		}
+	}
+	start, end, err := parseEntryTimes(body.StartedAt, body.EndedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var e *models.TimeEntry
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if e, err = tx.TimeEntries.CreateEntry(card.ID, userID, start, end, strings.TrimSpace(body.Note)); err != nil {
+			return err
+		}
+		return tx.logTimeEntry(userID, boardID, e, models.ActionLogTime, "logged "+hoursMinutes(e.Seconds)+" on this card", nil, entryState(e))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(e)
+}
+
+// UpdateTimeEntry edits one of the user's own entries. A running timer keeps running: its
+// end is set by stopping it.
+func (h *BoardHandler) UpdateTimeEntry(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	e, ok := h.timeEntryForCard(w, r, card)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(int)
+	if e.UserID != userID {
+		http.Error(w, "only the author can change a time entry", http.StatusForbidden)
+		return
+	}
+
+	var body struct {
+		StartedAt *string `json:"started_at"`
+		EndedAt   *string `json:"ended_at"`
+		Note      *string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	note := e.Note
+	if body.Note != nil {
+		note = strings.TrimSpace(*body.Note)
+	}
+	start, end := e.StartedAt, e.EndedAt
+	if e.EndedAt == nil {
+		if body.EndedAt != nil {
+			http.Error(w, "stop the timer to end it", http.StatusBadRequest)
+			return
+		}
+		if body.StartedAt != nil {
+			s, err := time.Parse(time.RFC3339, strings.TrimSpace(*body.StartedAt))
+			if err != nil || s.After(time.Now()) {
+				http.Error(w, "started_at must be an RFC3339 date in the past", http.StatusBadRequest)
+				return
+			}
+			// The timer would already have run longer than a hand-entered entry may last.
+			if time.Since(s) > maxEntryDuration {
+				http.Error(w, "a time entry cannot last more than 24 hours", http.StatusBadRequest)
+				return
+			}
+			start = s
+		}
+	} else if body.StartedAt != nil || body.EndedAt != nil {
+		rawStart, rawEnd := e.StartedAt.Format(time.RFC3339), e.EndedAt.Format(time.RFC3339)
+		if body.StartedAt != nil {
+			rawStart = *body.StartedAt
+		}
+		if body.EndedAt != nil {
+			rawEnd = *body.EndedAt
+		}
+		s, en, err := parseEntryTimes(rawStart, rawEnd)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		start, end = s, &en
+	}
+
+	var updated *models.TimeEntry
+	err := h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if updated, err = tx.TimeEntries.UpdateEntry(e.ID, start, end, note); err != nil {
+			return err
+		}
+		return tx.logTimeEntry(userID, boardID, updated, models.ActionEditTimeEntry, "edited a time entry on this card", entryState(e), entryState(updated))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *BoardHandler) DeleteTimeEntry(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+	e, ok := h.timeEntryForCard(w, r, card)
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(int)
+	if e.UserID != userID {
+		http.Error(w, "only the author can delete a time entry", http.StatusForbidden)
+		return
+	}
+
+	err := h.inTx(func(tx *BoardHandler) error {
+		if err := tx.TimeEntries.DeleteEntry(e.ID); err != nil {
+			return err
+		}
+		return tx.logTimeEntry(userID, boardID, e, models.ActionDeleteTimeEntry, "deleted a time entry of "+hoursMinutes(e.Seconds)+" on this card", entryState(e), nil)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Time entry deleted"})
+}
+
+// StartTimer starts the user's timer on the card; 409 when they already have one running,
+// on this card or another.
+func (h *BoardHandler) StartTimer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var e *models.TimeEntry
+	err := h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if e, err = tx.TimeEntries.StartTimer(card.ID, userID); err != nil {
+			return err
+		}
+		return tx.logTimeEntry(userID, boardID, e, models.ActionStartTimer, "started a timer on this card", nil, entryState(e))
+	})
+	if err == models.ErrTimerRunning {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(e)
+}
+
+// StopTimer stops the user's timer on the card.
+func (h *BoardHandler) StopTimer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	card, boardID, ok := h.cardForMember(w, r)
+	if !ok {
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	running, err := h.TimeEntries.RunningTimer(userID)
+	if err == sql.ErrNoRows || (err == nil && running.CardID != card.ID) {
+		http.Error(w, "no running timer on this card", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var e *models.TimeEntry
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if e, err = tx.TimeEntries.StopTimer(running.ID); err != nil {
+			return err
+		}
+		return tx.logTimeEntry(userID, boardID, e, models.ActionStopTimer, "stopped the timer on this card after "+hoursMinutes(e.Seconds), entryState(running), entryState(e))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(e)
+}
+
+// GetMyTimer returns the user's running timer, or null.
+func (h *BoardHandler) GetMyTimer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	running, err := h.TimeEntries.RunningTimer(r.Context().Value("userID").(int))
+	if err == sql.ErrNoRows {
+		json.NewEncoder(w).Encode(nil)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(running)
+}
+
+// timesheetTotal sums timesheet rows.
+type timesheetTotal struct {
+	Entries int     `json:"entries"`
+	Seconds int     `json:"seconds"`
+	Hours   float64 `json:"hours"`
+}
+
+func (t *timesheetTotal) add(row models.TimesheetRow) {
+	t.Entries += row.Entries
+	t.Seconds += row.Seconds
+	t.Hours = secondsToHours(t.Seconds)
+}
+
+type timesheetMember struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	timesheetTotal
+	Cards []timesheetCard `json:"cards,omitempty"`
+}
+
+type timesheetCard struct {
+	CardID    int    `json:"card_id"`
+	Title     string `json:"title"`
+	ListTitle string `json:"list_title"`
+	timesheetTotal
+	Members []timesheetMember `json:"members,omitempty"`
+}
+
+// secondsToHours rounds a duration to the hundredth of an hour.
+func secondsToHours(s int) float64 {
+	return math.Round(float64(s)/36) / 100
+}
+
+// csvText quotes a user-written cell starting with =, +, -, @, a tab or a carriage return with
+// a leading apostrophe, so spreadsheets show it as text instead of running it as a formula.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// GetTimesheet sums the time logged on the board's cards by member and by card (most time
+// first), over the entries started between the from and to days (see metricsRange).
+// format=csv downloads one line per member and card instead.
+func (h *BoardHandler) GetTimesheet(w http.ResponseWriter, r *http.Request) {
+	board, ok := h.boardForMember(w, r)
+	if !ok {
+		return
+	}
+	days, end, err := metricsRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to := days[0].Format("2006-01-02"), days[len(days)-1].Format("2006-01-02")
+
+	rows, err := h.TimeEntries.Timesheet(board.ID, days[0], end)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="timesheet-%d-%s-%s.csv"`, board.ID, from, to))
+		out := csv.NewWriter(w)
+		out.Write([]string{"member", "card_id", "card", "list", "entries", "hours"})
+		for _, row := range rows {
+			out.Write([]string{
+				csvText(row.Email), strconv.Itoa(row.CardID), csvText(row.CardTitle), csvText(row.ListTitle),
+				strconv.Itoa(row.Entries), strconv.FormatFloat(secondsToHours(row.Seconds), 'f', 2, 64),
+			})
+		}
+		out.Flush()
+		return
+	}
+
+	var total timesheetTotal
+	members := []timesheetMember{}
+	cards := []timesheetCard{}
+	cardIndex := map[int]int{}
+	for _, row := range rows {
+		total.add(row)
+
+		// Rows come ordered by member, so a member's rows are consecutive.
+		if len(members) == 0 || members[len(members)-1].UserID != row.UserID {
+			members = append(members, timesheetMember{UserID: row.UserID, Email: row.Email})
+		}
+		m := &members[len(members)-1]
+		m.add(row)
+		c := timesheetCard{CardID: row.CardID, Title: row.CardTitle, ListTitle: row.ListTitle}
+		c.add(row)
+		m.Cards = append(m.Cards, c)
+
+		i, seen := cardIndex[row.CardID]
+		if !seen {
+			i = len(cards)
+			cardIndex[row.CardID] = i
+			cards = append(cards, timesheetCard{CardID: row.CardID, Title: row.CardTitle, ListTitle: row.ListTitle})
+		}
+		cards[i].add(row)
+		tm := timesheetMember{UserID: row.UserID, Email: row.Email}
+		tm.add(row)
+		cards[i].Members = append(cards[i].Members, tm)
+	}
+
+	sort.SliceStable(cards, func(i, j int) bool { return cards[i].Seconds > cards[j].Seconds })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":    from,
+		"to":      to,
+		"total":   total,
+		"members": members,
+		"cards":   cards,
+	})
+}
@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+var (
+	errNotUndoable  = errors.New("this activity cannot be undone")
+	errUndoConflict = errors.New("the card has been modified since this activity")
+	errCardDeleted  = errors.New("the card has been deleted since this activity")
+)
+
+// undoState mirrors the keys written to activity before/after payloads by the card handlers.
+type undoState struct {
+	ListID      *int            `json:"list_id"`
+	Position    *int            `json:"position"`
+	Title       *string         `json:"title"`
+	Description *string         `json:"description"`
+	DueDate     json.RawMessage `json:"due_date"`
+	StartDate   json.RawMessage `json:"start_date"`
+	Priority    *string         `json:"priority"`
+	Completed   *bool           `json:"completed"`
+	Badge       *string         `json:"badge"`
+	Color       *string         `json:"color"`
+	TagID       *int            `json:"tag_id"`
+	LabelID     *int            `json:"label_id"`
+	Name        *string         `json:"name"`
+	UserID      *int            `json:"user_id"`
+
+	UndoneAction models.ActionType `json:"undone_action,omitempty"`
+}
+
+func decodeUndoState(raw json.RawMessage) (undoState, bool) {
+	var st undoState
+	if len(raw) == 0 {
+		return st, false
+	}
+	if err := json.Unmarshal(raw, &st); err != nil {
+		return st, false
+	}
+	return st, true
+}
+
+// undoAspect groups actions that touch the same part of a card; a later activity in the
+// same group (including an undo of it) means the original can no longer be reverted.
+func undoAspect(action models.ActionType) string {
+	switch action {
+	case models.ActionMoveCard:
+		return "list"
+	case models.ActionRenameCard:
+		return "title"
+	case models.ActionUpdateDescription:
+		return "description"
+	case models.ActionUpdateDueDate:
+		return "due_date"
+	case models.ActionUpdateStartDate:
+		return "start_date"
+	case models.ActionUpdatePriority:
+		return "priority"
+	case models.ActionCompleteCard, models.ActionReopenCard:
+		return "completion"
+	case models.ActionUpdateAppearance:
+		return "appearance"
+	case models.ActionAddTag, models.ActionRemoveTag:
+		return "tag"
+	case models.ActionAddCardMember, models.ActionRemoveCardMember:
+		return "member"
+	}
+	return ""
+}
+
+// undoKey narrows tag and member aspects to the label (or, for older activities, the tag
+// name) or user the activity is about.
+func undoKey(a *models.Activity) (string, string) {
+	if a.Payload == nil {
+		return "", ""
+	}
+	before, _ := decodeUndoState(a.Payload.Before)
+	after, hasAfter := decodeUndoState(a.Payload.After)
+
+	action := a.ActionType
+	if action == models.ActionUndo && hasAfter {
+		action = after.UndoneAction
+	}
+	aspect := undoAspect(action)
+
+	var key string
+	for _, st := range []undoState{before, after} {
+		if aspect == "tag" && st.LabelID != nil {
+			key = "label:" + strconv.Itoa(*st.LabelID)
+		} else if aspect == "tag" && st.Name != nil {
+			key = *st.Name
+		}
+		if aspect == "member" && st.UserID != nil {
+			key = strconv.Itoa(*st.UserID)
+		}
+	}
+	return aspect, key
+}
+
+func (h *BoardHandler) UndoActivity(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	activityID, err := strconv.Atoi(vars["id"])
+	if err != nil || activityID <= 0 {
+		http.Error(w, "invalid activity id", http.StatusBadRequest)
+		return
+	}
+	userID := r.Context().Value("userID").(int)
+
+	activity, err := h.Activities.GetActivityByID(activityID)
+	if err != nil {
+		http.Error(w, "activity not found", http.StatusNotFound)
+		return
+	}
+	if activity.BoardID == nil || !h.canAccessBoard(*activity.BoardID, userID) {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+	if activity.CardID == nil || activity.Payload == nil || undoAspect(activity.ActionType) == "" {
+		http.Error(w, errNotUndoable.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var undo *models.Activity
+	var wipWarning string
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		undo, wipWarning, err = tx.undo(activity, userID)
+		return err
+	})
+	var blocked *blockedError
+	var wipErr *models.WIPLimitError
+	switch {
+	case errors.As(err, &blocked):
+		http.Error(w, err.Error()+"; resolve them first or move the card by hand", http.StatusConflict)
+		return
+	case errors.As(err, &wipErr):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, errCardDeleted):
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	case errors.Is(err, errUndoConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, errNotUndoable):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	card, err := h.Cards.GetCardByID(*activity.CardID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if wipWarning != "" {
+		w.Header().Set("X-WIP-Limit-Exceeded", wipWarning)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"activity": undo, "card": card})
+}
+
+// undo reverts the activity a and logs it. Moving a card back returns the list's WIP warning,
+// if any (see EnterList).
+func (h *BoardHandler) undo(a *models.Activity, userID int) (*models.Activity, string, error) {
+	cardID := *a.CardID
+	if err := h.Cards.LockCard(cardID); err == sql.ErrNoRows {
+		return nil, "", errCardDeleted
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	aspect, key := undoKey(a)
+	later, err := h.Activities.GetActivitiesByCardSince(cardID, a.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range later {
+		if la, lk := undoKey(&later[i]); la == aspect && lk == key {
+			return nil, "", errUndoConflict
+		}
+	}
+
+	before, _ := decodeUndoState(a.Payload.Before)
+	after, _ := decodeUndoState(a.Payload.After)
+
+	card, err := h.Cards.GetCardByID(cardID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	title, description, badge, color := card.Title, card.Description, card.Badge, card.Color
+	listID, position, dueDate := card.ListID, card.Position, card.DueDate
+	priority, startDate, completed := card.Priority, card.StartDate, card.Completed
+	updateCard, updateSchedule := true, false
+	var wipWarning string
+
+	switch a.ActionType {
+	case models.ActionMoveCard:
+		if before.ListID == nil || after.ListID == nil || card.ListID != *after.ListID {
+			return nil, "", errUndoConflict
+		}
+		if _, err := h.Lists.GetListByID(*before.ListID); err != nil {
+			return nil, "", errUndoConflict
+		}
+		blockers, err := h.startBlockers(cardID, *before.ListID, card.Completed)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(blockers) > 0 {
+			return nil, "", &blockedError{blockers}
+		}
+		if wipWarning, err = h.Lists.EnterList(*before.ListID); err != nil {
+			return nil, "", err
+		}
+		listID = *before.ListID
+		if before.Position != nil {
+			position = *before.Position
+		}
+	case models.ActionRenameCard:
+		if before.Title == nil || after.Title == nil || card.Title != *after.Title {
+			return nil, "", errUndoConflict
+		}
+		title = *before.Title
+	case models.ActionUpdateDescription:
+		if before.Description == nil || after.Description == nil || card.Description != *after.Description {
+			return nil, "", errUndoConflict
+		}
+		description = *before.Description
+	case models.ActionUpdateDueDate:
+		var was, now *time.Time
+		if err := json.Unmarshal(before.DueDate, &was); err != nil {
+			return nil, "", errNotUndoable
+		}
+		if err := json.Unmarshal(after.DueDate, &now); err != nil {
+			return nil, "", errNotUndoable
+		}
+		if !sameTime(card.DueDate, now) {
+			return nil, "", errUndoConflict
+		}
+		dueDate = was
+	case models.ActionUpdateStartDate:
+		var was, now *time.Time
+		if err := json.Unmarshal(before.StartDate, &was); err != nil {
+			return nil, "", errNotUndoable
+		}
+		if err := json.Unmarshal(after.StartDate, &now); err != nil {
+			return nil, "", errNotUndoable
+		}
+		if !sameTime(card.StartDate, now) {
+			return nil, "", errUndoConflict
+		}
+		startDate, updateSchedule = was, true
+	case models.ActionUpdatePriority:
+		if before.Priority == nil || after.Priority == nil || string(card.Priority) != *after.Priority {
+			return nil, "", errUndoConflict
+		}
+		priority, updateSchedule = models.Priority(*before.Priority), true
+	case models.ActionCompleteCard, models.ActionReopenCard:
+		if before.Completed == nil || after.Completed == nil || card.Completed != *after.Completed {
+			return nil, "", errUndoConflict
+		}
+		completed, updateSchedule = *before.Completed, true
+	case models.ActionUpdateAppearance:
+		if before.Badge == nil || before.Color == nil || after.Badge == nil || after.Color == nil ||
+			card.Badge != *after.Badge || card.Color != *after.Color {
+			return nil, "", errUndoConflict
+		}
+		badge, color = *before.Badge, *before.Color
+	case models.ActionAddTag, models.ActionRemoveTag:
+		updateCard = false
+		if err := h.undoTag(a.ActionType, a.BoardID, cardID, before, after); err != nil {
+			return nil, "", err
+		}
+	case models.ActionAddCardMember, models.ActionRemoveCardMember:
+		updateCard = false
+		if err := h.undoMember(a.ActionType, cardID, before, after); err != nil {
+			return nil, "", err
+		}
+	default:
+		return nil, "", errNotUndoable
+	}
+
+	if startDate != nil && dueDate != nil && !startDate.Before(*dueDate) {
+		// The other date moved since; restoring this one would put the start after the due date.
+		return nil, "", errUndoConflict
+	}
+	if updateSchedule {
+		if err := h.Cards.SetSchedule(cardID, priority, startDate, completed); err != nil {
+			return nil, "", err
+		}
+	}
+	if updateCard {
+		updated, err := h.Cards.UpdateCard(cardID, title, description, badge, color, listID, position, dueDate)
+		if err != nil {
+			return nil, "", err
+		}
+		from, to := h.cardBoardID(card), h.cardBoardID(updated)
+		if from != nil && to != nil && *from != *to {
+			if err := h.cardChangedBoard(updated, *to); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	var restored map[string]interface{}
+	if len(a.Payload.Before) > 0 {
+		json.Unmarshal(a.Payload.Before, &restored)
+	}
+	if restored == nil {
+		restored = map[string]interface{}{}
+	}
+	restored["undone_action"] = a.ActionType
+
+	refs := map[string]int{"activity": a.ID, "card": cardID}
+	if a.BoardID != nil {
+		refs["board"] = *a.BoardID
+	}
+	entry := models.ActivityEntry{
+		BoardID: a.BoardID,
+		CardID:  &cardID,
+		UserID:  userID,
+		Action:  models.ActionUndo,
+		Details: "undid: " + a.Details,
+		Refs:    refs,
+		After:   restored,
+	}
+	if len(a.Payload.After) > 0 {
+		entry.Before = a.Payload.After
+	}
+	logged, err := h.Activities.Log(entry)
+	return logged, wipWarning, err
+}
+
+// undoTag reverts attaching or detaching a label. Activities from before the label catalog
+// only carry the tag name, which is looked up on the board; a label deleted since is
+// recreated with the recorded color.
+func (h *BoardHandler) undoTag(action models.ActionType, boardID *int, cardID int, before, after undoState) error {
+	st := after
+	if action == models.ActionRemoveTag {
+		st = before
+	}
+	if boardID == nil || st.Name == nil {
+		return errNotUndoable
+	}
+	var label *models.Label
+	var err error
+	if st.LabelID != nil {
+		label, err = h.Labels.GetLabelByID(*st.LabelID)
+	} else {
+		label, err = h.Labels.GetLabelByName(*boardID, *st.Name)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if label != nil && label.BoardID != *boardID {
+		label = nil
+	}
+
+	if action == models.ActionAddTag {
+		if label == nil {
+			return errUndoConflict
+		}
+		if _, err := h.CardTags.GetTag(cardID, label.ID); err == sql.ErrNoRows {
+			return errUndoConflict
+		} else if err != nil {
+			return err
+		}
+		return h.CardTags.RemoveTag(cardID, label.ID)
+	}
+
+	if label == nil {
+		color := "primary"
+		if st.Color != nil {
+			color = *st.Color
+		}
+		if label, err = h.Labels.EnsureLabel(*boardID, *st.Name, color); err != nil {
+			return err
+		}
+	}
+	_, added, err := h.CardTags.AddTag(cardID, label.ID)
+	if err == nil && !added {
+		return errUndoConflict
+	}
+	return err
+}
+
+func (h *BoardHandler) undoMember(action models.ActionType, cardID int, before, after undoState) error {
+	if action == models.ActionAddCardMember {
+		if after.UserID == nil {
+			return errNotUndoable
+		}
+		removed, err := h.CardMembers.RemoveMember(cardID, *after.UserID)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return errUndoConflict
+		}
+		return nil
+	}
+
+	if before.UserID == nil {
+		return errNotUndoable
+	}
+	added, err := h.CardMembers.AddMember(cardID, *before.UserID)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return errUndoConflict
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"trellomirror/backend/models"
+)
+
+// boardForOwner loads the board from the {id} route variable and writes the error response
+// itself when the board is missing or the caller is not its owner.
+func (h *BoardHandler) boardForOwner(w http.ResponseWriter, r *http.Request, action string) (*models.Board, bool) {
+	boardID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || boardID <= 0 {
+		http.Error(w, "invalid board id", http.StatusBadRequest)
+		return nil, false
+	}
+	userID := r.Context().Value("userID").(int)
+
+	board, err := h.Boards.GetBoardByID(boardID)
+	if err != nil {
+		http.Error(w, "board not found", http.StatusNotFound)
+		return nil, false
+	}
+	if board.UserID != userID {
+		http.Error(w, "only the board owner can "+action, http.StatusForbidden)
+		return nil, false
+	}
+	return board, true
+}
+
+func (h *BoardHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForOwner(w, r, "manage webhooks")
+	if !ok {
+		return
+	}
+
+	hooks, err := h.Webhooks.GetWebhooksByBoard(board.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hooks == nil {
+		hooks = []models.Webhook{}
+	}
+	json.NewEncoder(w).Encode(hooks)
+}
+
+func (h *BoardHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForOwner(w, r, "manage webhooks")
+	if !ok {
+		return
+	}
+	userID := r.Context().Value("userID").(int)
+
+	var body struct {
+		URL    string              `json:"url"`
+		Secret string              `json:"secret"`
+		Events []models.ActionType `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	target, err := url.Parse(strings.TrimSpace(body.URL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		http.Error(w, "url must be an absolute http(s) URL", http.StatusBadRequest)
+		return
+	}
+	for _, e := range body.Events {
+		if !models.ValidActionType(e) {
+			http.Error(w, "unknown event type: "+string(e), http.StatusBadRequest)
+			return
+		}
+	}
+	if body.Events == nil {
+		body.Events = []models.ActionType{}
+	}
+
+	var hook *models.Webhook
+	err = h.inTx(func(tx *BoardHandler) error {
+		var err error
+		if hook, err = tx.Webhooks.CreateWebhook(board.ID, userID, target.String(), body.Secret, body.Events); err != nil {
+			return err
+		}
+		// Only the host is logged: webhook URLs often carry a token.
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionCreateWebhook,
+			Details: "added a webhook to " + target.Host,
+			Refs:    map[string]int{"board": board.ID, "webhook": hook.ID},
+			After:   map[string]interface{}{"host": target.Host, "events": hook.Events},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+func (h *BoardHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForOwner(w, r, "manage webhooks")
+	if !ok {
+		return
+	}
+	hookID, err := strconv.Atoi(mux.Vars(r)["webhookId"])
+	if err != nil || hookID <= 0 {
+		http.Error(w, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	var deleted bool
+	err = h.inTx(func(tx *BoardHandler) error {
+		hook, err := tx.Webhooks.GetWebhookByID(hookID)
+		if err == sql.ErrNoRows || (err == nil && hook.BoardID != board.ID) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if deleted, err = tx.Webhooks.DeleteWebhook(board.ID, hookID); err != nil || !deleted {
+			return err
+		}
+		host := hook.URL
+		if u, err := url.Parse(hook.URL); err == nil {
+			host = u.Host
+		}
+		_, err = tx.Activities.Log(models.ActivityEntry{
+			BoardID: &board.ID,
+			UserID:  userID,
+			Action:  models.ActionDeleteWebhook,
+			Details: "removed the webhook to " + host,
+			Refs:    map[string]int{"board": board.ID, "webhook": hookID},
+			Before:  map[string]interface{}{"host": host, "events": hook.Events},
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Webhook deleted"})
+}
+
+func (h *BoardHandler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	board, ok := h.boardForOwner(w, r, "manage webhooks")
+	if !ok {
+		return
+	}
+	hookID, err := strconv.Atoi(mux.Vars(r)["webhookId"])
+	if err != nil || hookID <= 0 {
+		http.Error(w, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+	hook, err := h.Webhooks.GetWebhookByID(hookID)
+	if err != nil || hook.BoardID != board.ID {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	limit := queryInt(r, "limit", 50)
+	if limit == 0 || limit > 200 {
+		limit = 50
+	}
+	deliveries, err := h.Webhooks.GetDeliveriesByWebhook(hookID, limit, queryInt(r, "offset", 0))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+	json.NewEncoder(w).Encode(deliveries)
+}
@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"trellomirror/backend/models"
+)
+
+// AutomationWorker fires due_date_reached automation rules for cards whose due date passed.
+type AutomationWorker struct {
+	DB       *sql.DB
+	Fire     func(models.DueTrigger)
+	Interval time.Duration
+	Batch    int
+}
+
+func NewAutomationWorker(db *sql.DB, fire func(models.DueTrigger)) *AutomationWorker {
+	return &AutomationWorker{
+		DB:       db,
+		Fire:     fire,
+		Interval: envDuration("AUTOMATION_INTERVAL", time.Minute),
+		Batch:    100,
+	}
+}
+
+func (w *AutomationWorker) Run(ctx context.Context) {
+	runEvery(ctx, "automation", w.Interval, w.RunOnce)
+}
+
+// RunOnce claims due dates that passed within overdueWindow, then fires the rules once the
+// claim has committed, so a slow rule never holds the card locks.
+func (w *AutomationWorker) RunOnce() error {
+	for {
+		var claimed []models.DueTrigger
+		now := time.Now()
+		err := models.WithTx(w.DB, func(tx *sql.Tx) error {
+			var err error
+			claimed, err = (&models.AutomationService{DB: tx}).ClaimDueTriggers(now.Add(-overdueWindow), now, w.Batch)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, t := range claimed {
+			w.Fire(t)
+		}
+		if len(claimed) < w.Batch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+	"time"
+
+	"trellomirror/backend/mailer"
+	"trellomirror/backend/models"
+)
+
+// DigestWorker batches each user's unread notifications into a periodic email.
+type DigestWorker struct {
+	DB       *sql.DB
+	Mailer   mailer.Mailer
+	BaseURL  string
+	Interval time.Duration
+}
+
+func NewDigestWorker(db *sql.DB, m mailer.Mailer) *DigestWorker {
+	return &DigestWorker{
+		DB:       db,
+		Mailer:   m,
+		BaseURL:  strings.TrimRight(getEnv("APP_BASE_URL", "http://localhost:3000"), "/"),
+		Interval: envDuration("DIGEST_CHECK_INTERVAL", 5*time.Minute),
+	}
+}
+
+func (w *DigestWorker) Run(ctx context.Context) {
+	runEvery(ctx, "digest", w.Interval, w.RunOnce)
+}
+
+func (w *DigestWorker) RunOnce() error {
+	notifications := &models.NotificationService{DB: w.DB}
+	userIDs, err := notifications.DueDigestUsers()
+	if err != nil {
+		return err
+	}
+	for _, id := range userIDs {
+		if err := w.sendDigest(id); err != nil {
+			log.Printf("digest worker: user %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// sendDigest holds the user's preferences row lock while sending so that concurrent
+// workers never email the same notifications twice.
+func (w *DigestWorker) sendDigest(userID int) error {
+	return models.WithTx(w.DB, func(tx *sql.Tx) error {
+		notifications := &models.NotificationService{DB: tx}
+		users := &models.UserService{DB: tx}
+
+		due, err := notifications.LockDueDigest(userID)
+		if err != nil || !due {
+			return err
+		}
+		pending, err := notifications.GetUndigested(userID)
+		if err != nil || len(pending) == 0 {
+			return err
+		}
+		user, err := users.GetUserByID(userID)
+		if err != nil {
+			return err
+		}
+		token, err := notifications.UnsubscribeToken(userID)
+		if err != nil {
+			return err
+		}
+
+		msg, err := w.buildDigest(user, pending, token)
+		if err != nil {
+			return err
+		}
+		if err := w.Mailer.Send(msg); err != nil {
+			return err
+		}
+		return notifications.MarkDigested(userID, pending[len(pending)-1].ID)
+	})
+}
+
+type digestItem struct {
+	Actor   string
+	Message string
+	When    string
+}
+
+var digestHTML = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, Segoe UI, Helvetica, Arial, sans-serif; color: #0f172a;">
+  <h2 style="margin-bottom: 4px;">You have {{len .Items}} unread notification{{if ne (len .Items) 1}}s{{end}}</h2>
+  <ul style="padding-left: 18px;">
+    {{range .Items}}<li style="margin: 6px 0;"><strong>{{.Actor}}</strong> {{.Message}} <span style="color: #94a3b8;">({{.When}})</span></li>
+    {{end}}
+  </ul>
+  <p><a href="{{.BoardsURL}}">Open your boards</a></p>
+  <p style="font-size: 12px; color: #94a3b8;">You receive this digest because email notifications are enabled.
+    <a href="{{.UnsubscribeURL}}">Unsubscribe</a></p>
+</body>
+</html>
+`))
+
+func (w *DigestWorker) buildDigest(user *models.User, pending []models.Notification, token string) (mailer.Message, error) {
+	boardsURL := w.BaseURL + "/user/boards"
+	unsubscribeURL := w.BaseURL + "/api/unsubscribe?token=" + token
+
+	items := make([]digestItem, 0, len(pending))
+	var text strings.Builder
+	fmt.Fprintf(&text, "You have %d unread notification(s):\n\n", len(pending))
+	for _, n := range pending {
+		actor := "Someone"
+		if n.ActorEmail != "" {
+			actor = strings.Split(n.ActorEmail, "@")[0]
+		}
+		when := n.CreatedAt.Format("Jan 2, 15:04")
+		items = append(items, digestItem{Actor: actor, Message: n.Message, When: when})
+		fmt.Fprintf(&text, "- %s %s (%s)\n", actor, n.Message, when)
+	}
+	fmt.Fprintf(&text, "\nOpen your boards: %s\n\nUnsubscribe: %s\n", boardsURL, unsubscribeURL)
+
+	var html bytes.Buffer
+	err := digestHTML.Execute(&html, map[string]interface{}{
+		"Items":          items,
+		"BoardsURL":      boardsURL,
+		"UnsubscribeURL": unsubscribeURL,
+	})
+	if err != nil {
+		return mailer.Message{}, err
+	}
+
+	return mailer.Message{
+		To:      user.Email,
+		Subject: fmt.Sprintf("[TrelloMirror] %d unread notification(s)", len(pending)),
+		Text:    text.String(),
+		HTML:    html.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// runEvery calls fn immediately and then on every tick until ctx is cancelled. Errors are
+// logged rather than returned so one failed pass does not stop the worker.
+func runEvery(ctx context.Context, name string, interval time.Duration, fn func() error) {
+	log.Printf("%s worker started (every %s)", name, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := fn(); err != nil {
+			log.Printf("%s worker: %v", name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func getEnv(key, fallback string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
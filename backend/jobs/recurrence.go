@@ -0,0 +1,115 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"trellomirror/backend/models"
+)
+
+// RecurrenceWorker clones recurring template cards into their target list when they are due.
+type RecurrenceWorker struct {
+	DB       *sql.DB
+	Interval time.Duration
+	Batch    int
+}
+
+func NewRecurrenceWorker(db *sql.DB) *RecurrenceWorker {
+	return &RecurrenceWorker{
+		DB:       db,
+		Interval: envDuration("RECURRENCE_INTERVAL", time.Minute),
+		Batch:    50,
+	}
+}
+
+func (w *RecurrenceWorker) Run(ctx context.Context) {
+	runEvery(ctx, "recurrence", w.Interval, w.RunOnce)
+}
+
+// RunOnce creates one clone per due rule, even if several runs were missed while the server
+// was down, and schedules the next run from now. Each clone runs under its own savepoint: a
+// rule that fails is logged and skips to its next run, without holding back the others.
+func (w *RecurrenceWorker) RunOnce() error {
+	for {
+		var claimedCount int
+		err := models.WithTx(w.DB, func(tx *sql.Tx) error {
+			recurrences := &models.RecurrenceService{DB: tx}
+
+			now := time.Now()
+			claimed, err := recurrences.ClaimDue(now, w.Batch)
+			if err != nil {
+				return err
+			}
+			claimedCount = len(claimed)
+
+			for _, d := range claimed {
+				if _, err := tx.Exec("SAVEPOINT recurrence"); err != nil {
+					return err
+				}
+				var cloneID *int
+				clone, err := cloneRecurring(tx, d)
+				if err != nil {
+					log.Printf("recurrence worker: recurrence %d of card %d: %v", d.ID, d.CardID, err)
+					if _, err := tx.Exec("ROLLBACK TO SAVEPOINT recurrence"); err != nil {
+						return err
+					}
+				} else {
+					cloneID = &clone.ID
+					if _, err := tx.Exec("RELEASE SAVEPOINT recurrence"); err != nil {
+						return err
+					}
+				}
+
+				var next *time.Time
+				if t, err := d.Next(now); err == nil {
+					next = &t
+				} else {
+					log.Printf("recurrence worker: disabling recurrence %d: %v", d.ID, err)
+				}
+				if err := recurrences.MarkRun(d.ID, cloneID, next); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if claimedCount < w.Batch {
+			return nil
+		}
+	}
+}
+
+// cloneRecurring clones the recurrence's card into its target list and logs the new card.
+// A target list at its WIP limit on a blocking board fails the run, which RunOnce skips.
+func cloneRecurring(tx *sql.Tx, d models.DueRecurrence) (*models.Card, error) {
+	wipWarning, err := (&models.ListService{DB: tx}).EnterList(d.TargetListID)
+	if err != nil {
+		return nil, err
+	}
+	if wipWarning != "" {
+		log.Printf("recurrence worker: recurrence %d puts list %d over its WIP limit (%s)", d.ID, d.TargetListID, wipWarning)
+	}
+	clone, err := (&models.CardService{DB: tx}).CloneCard(d.CardID, d.TargetListID)
+	if err != nil {
+		return nil, err
+	}
+	actor := d.CreatedBy
+	if actor == 0 {
+		actor = d.BoardOwnerID
+	}
+	boardID := d.BoardID
+	_, err = (&models.ActivityService{DB: tx}).Log(models.ActivityEntry{
+		BoardID: &boardID,
+		CardID:  &clone.ID,
+		UserID:  actor,
+		Action:  models.ActionCreateCard,
+		Details: "created this card from the recurring card \"" + d.CardTitle + "\"",
+		Refs:    map[string]int{"board": boardID, "list": clone.ListID, "card": clone.ID, "template": d.CardID},
+		After:   map[string]interface{}{"title": clone.Title, "list_id": clone.ListID, "position": clone.Position},
+	})
+	return clone, err
+}
@@ -0,0 +1,210 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"trellomirror/backend/mailer"
+	"trellomirror/backend/models"
+)
+
+// overdueWindow bounds how far back the overdue reminder looks, so enabling the scheduler
+// on an old database does not flood members with reminders for long-forgotten cards.
+const overdueWindow = 24 * time.Hour
+
+// DueReminderWorker notifies card members when a due date is near or has passed.
+type DueReminderWorker struct {
+	DB       *sql.DB
+	Mailer   mailer.Mailer
+	BaseURL  string
+	Offsets  []time.Duration
+	Interval time.Duration
+	Batch    int
+}
+
+func NewDueReminderWorker(db *sql.DB, m mailer.Mailer) *DueReminderWorker {
+	offsets, err := parseOffsets(getEnv("DUE_REMINDER_OFFSETS", "24h,1h"))
+	if err != nil {
+		log.Printf("invalid DUE_REMINDER_OFFSETS (%v), using 24h,1h", err)
+		offsets = []time.Duration{time.Hour, 24 * time.Hour}
+	}
+	return &DueReminderWorker{
+		DB:       db,
+		Mailer:   m,
+		BaseURL:  strings.TrimRight(getEnv("APP_BASE_URL", "http://localhost:3000"), "/"),
+		Offsets:  offsets,
+		Interval: envDuration("DUE_REMINDER_INTERVAL", time.Minute),
+		Batch:    100,
+	}
+}
+
+// parseOffsets reads a comma separated list of durations and returns them ascending.
+func parseOffsets(raw string) ([]time.Duration, error) {
+	var out []time.Duration
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("offset %s must be positive", part)
+		}
+		out = append(out, d)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no offsets")
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, nil
+}
+
+func (w *DueReminderWorker) Run(ctx context.Context) {
+	runEvery(ctx, "due reminder", w.Interval, w.RunOnce)
+}
+
+// RunOnce sends one pass of reminders. Each offset only covers the slice of time up to the
+// next smaller offset, so a card first seen 30 minutes before its due date gets the 1h
+// reminder but not also the 24h one.
+func (w *DueReminderWorker) RunOnce() error {
+	now := time.Now()
+	if err := w.claimAndNotify(0, now.Add(-overdueWindow), now); err != nil {
+		return err
+	}
+	lower := time.Duration(0)
+	for _, offset := range w.Offsets {
+		if err := w.claimAndNotify(int(offset/time.Minute), now.Add(lower), now.Add(offset)); err != nil {
+			return err
+		}
+		lower = offset
+	}
+	return nil
+}
+
+type pendingReminderEmail struct {
+	to  string
+	msg mailer.Message
+}
+
+func (w *DueReminderWorker) claimAndNotify(offsetMinutes int, from, to time.Time) error {
+	for {
+		var emails []pendingReminderEmail
+		var claimedCount int
+		err := models.WithTx(w.DB, func(tx *sql.Tx) error {
+			reminders := &models.DueReminderService{DB: tx}
+			members := &models.CardMemberService{DB: tx}
+			notifications := &models.NotificationService{DB: tx}
+
+			claimed, err := reminders.ClaimWindow(offsetMinutes, from, to, w.Batch)
+			if err != nil {
+				return err
+			}
+			claimedCount = len(claimed)
+
+			for _, d := range claimed {
+				cardMembers, err := members.GetMembersByCard(d.CardID)
+				if err != nil {
+					return err
+				}
+				notifType, message := reminderMessage(d)
+				for _, m := range cardMembers {
+					prefs, err := notifications.GetPreferences(m.UserID)
+					if err != nil {
+						return err
+					}
+					if !prefs.Allows(notifType) {
+						continue
+					}
+					email := w.Mailer != nil && prefs.EmailEnabled
+					boardID, cardID := d.BoardID, d.CardID
+					err = notifications.Notify(models.Notification{
+						UserID:          m.UserID,
+						Type:            notifType,
+						BoardID:         &boardID,
+						CardID:          &cardID,
+						Message:         message,
+						EmailedDirectly: email,
+					})
+					if err != nil {
+						return err
+					}
+					if email {
+						token, err := notifications.UnsubscribeToken(m.UserID)
+						if err != nil {
+							return err
+						}
+						emails = append(emails, pendingReminderEmail{to: m.UserEmail, msg: w.reminderEmail(m.UserEmail, d, message, token)})
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Emails go out after commit so SMTP latency never holds card locks.
+		for _, e := range emails {
+			if err := w.Mailer.Send(e.msg); err != nil {
+				log.Printf("due reminder worker: email to %s: %v", e.to, err)
+			}
+		}
+		if claimedCount < w.Batch {
+			return nil
+		}
+	}
+}
+
+func reminderMessage(d models.DueReminder) (models.NotificationType, string) {
+	if d.OffsetMinutes == 0 {
+		return models.NotificationOverdue, "\"" + d.CardTitle + "\" is overdue"
+	}
+	return models.NotificationDueSoon, "\"" + d.CardTitle + "\" is due in " + humanizeOffset(d.OffsetMinutes)
+}
+
+func humanizeOffset(minutes int) string {
+	switch {
+	case minutes%(24*60) == 0:
+		return plural(minutes/(24*60), "day")
+	case minutes%60 == 0:
+		return plural(minutes/60, "hour")
+	}
+	return plural(minutes, "minute")
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+func (w *DueReminderWorker) reminderEmail(to string, d models.DueReminder, message, token string) mailer.Message {
+	boardURL := fmt.Sprintf("%s/user/boards/%d", w.BaseURL, d.BoardID)
+	unsubscribeURL := w.BaseURL + "/api/unsubscribe?token=" + token
+	due := d.DueDate.UTC().Format("Mon Jan 2, 15:04 MST")
+	text := fmt.Sprintf("%s.\n\nDue: %s\nOpen the board: %s\n\nUnsubscribe: %s\n", message, due, boardURL, unsubscribeURL)
+	body := fmt.Sprintf(`<!DOCTYPE html><html><body style="font-family: sans-serif; color: #0f172a;">`+
+		`<p>%s.</p><p>Due: %s</p><p><a href="%s">Open the board</a></p>`+
+		`<p style="font-size: 12px; color: #94a3b8;"><a href="%s">Unsubscribe</a></p></body></html>`,
+		html.EscapeString(message), html.EscapeString(due), boardURL, unsubscribeURL)
+	return mailer.Message{
+		To:      to,
+		Subject: "[TrelloMirror] " + message,
+		Text:    text,
+		HTML:    body,
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}
+}
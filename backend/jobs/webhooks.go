@@ -0,0 +1,153 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"trellomirror/backend/models"
+)
+
+const (
+	webhookMaxAttempts = 8
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = 6 * time.Hour
+	webhookDrainSize   = 2048
+)
+
+// WebhookWorker drains the webhook_deliveries queue.
+type WebhookWorker struct {
+	DB       *sql.DB
+	Client   *http.Client
+	Interval time.Duration
+	Batch    int
+}
+
+func NewWebhookWorker(db *sql.DB) *WebhookWorker {
+	return &WebhookWorker{
+		DB:       db,
+		Client:   webhookClient(),
+		Interval: envDuration("WEBHOOK_INTERVAL", 5*time.Second),
+		Batch:    50,
+	}
+}
+
+func (w *WebhookWorker) Run(ctx context.Context) {
+	runEvery(ctx, "webhook", w.Interval, w.RunOnce)
+}
+
+func (w *WebhookWorker) RunOnce() error {
+	webhooks := &models.WebhookService{DB: w.DB}
+	// The lease outlives one HTTP timeout per delivery, so a crashed worker's claims expire.
+	deliveries, err := webhooks.ClaimDue(w.Batch, time.Duration(w.Batch)*w.Client.Timeout+time.Minute)
+	if err != nil {
+		return err
+	}
+	for _, d := range deliveries {
+		if err := w.deliver(webhooks, d); err != nil {
+			log.Printf("webhook worker: delivery %d: %v", d.ID, err)
+		}
+	}
+	return nil
+}
+
+// webhookClient only connects to public addresses and never follows redirects,
+// so a board owner cannot use a webhook to reach the backend's own network.
+// The check runs on the resolved IP at dial time, which also covers DNS names
+// pointing inward.
+func webhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: refuseNonPublic}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // a proxy would be the only address the dialer sees
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func refuseNonPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("refusing to connect to non-public address %s", host)
+	}
+	return nil
+}
+
+// Sign returns the signature sent in X-TrelloMirror-Signature: hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff doubles the wait after each failed attempt, capped at webhookMaxBackoff.
+func backoff(attempts int) time.Duration {
+	d := webhookBaseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return d
+}
+
+func (w *WebhookWorker) deliver(webhooks *models.WebhookService, d models.WebhookDelivery) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return webhooks.MarkFailed(d.ID, nil, err.Error(), nil)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TrelloMirror-Webhooks/1.0")
+	req.Header.Set("X-TrelloMirror-Event", string(d.Event))
+	req.Header.Set("X-TrelloMirror-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set("X-TrelloMirror-Timestamp", timestamp)
+	req.Header.Set("X-TrelloMirror-Signature", Sign(d.Secret, timestamp, d.Payload))
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return w.fail(webhooks, d, nil, err.Error())
+	}
+	defer resp.Body.Close()
+	// The body is not stored (it may echo internal data); a short read lets the connection be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookDrainSize))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return webhooks.MarkDelivered(d.ID, resp.StatusCode)
+	}
+	code := resp.StatusCode
+	return w.fail(webhooks, d, &code, fmt.Sprintf("unexpected status %d", code))
+}
+
+func (w *WebhookWorker) fail(webhooks *models.WebhookService, d models.WebhookDelivery, code *int, errMsg string) error {
+	attempts := d.Attempts + 1
+	if attempts >= webhookMaxAttempts {
+		return webhooks.MarkFailed(d.ID, code, errMsg, nil)
+	}
+	next := time.Now().Add(backoff(attempts))
+	return webhooks.MarkFailed(d.ID, code, errMsg, &next)
+}
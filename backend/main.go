@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	// Recurrence timezones must resolve in the alpine image, which ships without zoneinfo.
+	_ "time/tzdata"
 
 	"github.com/gorilla/mux"
 	"trellomirror/backend/handlers"
+	"trellomirror/backend/jobs"
+	"trellomirror/backend/mailer"
 	"trellomirror/backend/middleware"
 	"trellomirror/backend/models"
+	"trellomirror/backend/storage"
 )
 
 func main() {
@@ -20,6 +26,23 @@ func main() {
 
 	authHandler := handlers.NewAuthHandler(db)
 	boardHandler := handlers.NewBoardHandler(db)
+	boardHandler.Blobs, err = storage.FromEnv()
+	if err != nil {
+		log.Fatal("Failed to initialize attachment storage:", err)
+	}
+	notificationHandler := handlers.NewNotificationHandler(db)
+
+	ctx := context.Background()
+	m := mailer.FromEnv()
+	if m != nil {
+		go jobs.NewDigestWorker(db, m).Run(ctx)
+	} else {
+		log.Println("SMTP_HOST not set, email digests disabled")
+	}
+	go jobs.NewDueReminderWorker(db, m).Run(ctx)
+	go jobs.NewWebhookWorker(db).Run(ctx)
+	go jobs.NewAutomationWorker(db, boardHandler.FireDueDateAutomations).Run(ctx)
+	go jobs.NewRecurrenceWorker(db).Run(ctx)
 
 	r := mux.NewRouter()
 
@@ -27,17 +50,64 @@ func main() {
 
 	r.HandleFunc("/api/register", authHandler.Register).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/login", authHandler.Login).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/unsubscribe", notificationHandler.ConfirmUnsubscribe).Methods("GET")
+	r.HandleFunc("/api/unsubscribe", notificationHandler.Unsubscribe).Methods("POST")
+	// Thumbnail URLs are signed, so that they work as <img src> without the Authorization header.
+	r.HandleFunc("/api/attachments/{id}/thumbnail", boardHandler.GetAttachmentThumbnail).Methods("GET")
 
 	protected := r.PathPrefix("/api").Subrouter()
 	protected.Use(middleware.AuthMiddleware)
 	protected.HandleFunc("/me", authHandler.GetMe).Methods("GET")
+	protected.HandleFunc("/me/cards", boardHandler.GetMyCards).Methods("GET")
+	protected.HandleFunc("/me/timer", boardHandler.GetMyTimer).Methods("GET")
 	protected.HandleFunc("/boards", boardHandler.ListBoards).Methods("GET")
 	protected.HandleFunc("/boards", boardHandler.CreateBoard).Methods("POST")
 	protected.HandleFunc("/boards/{id}", boardHandler.GetBoard).Methods("GET")
+	protected.HandleFunc("/boards/{id}/settings", boardHandler.UpdateBoardSettings).Methods("PATCH", "PUT")
+	protected.HandleFunc("/boards/{id}/save-as-template", boardHandler.SaveBoardAsTemplate).Methods("POST")
+	protected.HandleFunc("/templates", boardHandler.ListTemplates).Methods("GET")
+	protected.HandleFunc("/templates/{id}", boardHandler.GetTemplate).Methods("GET")
+	protected.HandleFunc("/templates/{id}", boardHandler.DeleteTemplate).Methods("DELETE")
 	protected.HandleFunc("/boards/{id}/members", boardHandler.GetBoardMembers).Methods("GET")
 	protected.HandleFunc("/boards/{id}/members", boardHandler.InviteMember).Methods("POST")
 	protected.HandleFunc("/boards/{id}/members/{userId}", boardHandler.RemoveMember).Methods("DELETE")
+	protected.HandleFunc("/boards/{id}/webhooks", boardHandler.ListWebhooks).Methods("GET")
+	protected.HandleFunc("/boards/{id}/webhooks", boardHandler.CreateWebhook).Methods("POST")
+	protected.HandleFunc("/boards/{id}/webhooks/{webhookId}", boardHandler.DeleteWebhook).Methods("DELETE")
+	protected.HandleFunc("/boards/{id}/webhooks/{webhookId}/deliveries", boardHandler.ListWebhookDeliveries).Methods("GET")
+	protected.HandleFunc("/boards/{id}/automations", boardHandler.ListAutomations).Methods("GET")
+	protected.HandleFunc("/boards/{id}/automations", boardHandler.CreateAutomation).Methods("POST")
+	protected.HandleFunc("/boards/{id}/automations/runs", boardHandler.ListAutomationRuns).Methods("GET")
+	protected.HandleFunc("/boards/{id}/automations/{ruleId}", boardHandler.UpdateAutomation).Methods("PUT")
+	protected.HandleFunc("/boards/{id}/automations/{ruleId}", boardHandler.DeleteAutomation).Methods("DELETE")
+	protected.HandleFunc("/boards/{id}/labels", boardHandler.ListLabels).Methods("GET")
+	protected.HandleFunc("/boards/{id}/labels", boardHandler.CreateLabel).Methods("POST")
+	protected.HandleFunc("/boards/{id}/labels/{labelId}", boardHandler.UpdateLabel).Methods("PATCH", "PUT")
+	protected.HandleFunc("/boards/{id}/labels/{labelId}", boardHandler.DeleteLabel).Methods("DELETE")
+	protected.HandleFunc("/boards/{id}/filters", boardHandler.ListSavedFilters).Methods("GET")
+	protected.HandleFunc("/boards/{id}/filters", boardHandler.CreateSavedFilter).Methods("POST")
+	protected.HandleFunc("/boards/{id}/filters/{filterId}", boardHandler.UpdateSavedFilter).Methods("PATCH", "PUT")
+	protected.HandleFunc("/boards/{id}/filters/{filterId}", boardHandler.DeleteSavedFilter).Methods("DELETE")
+	protected.HandleFunc("/boards/{id}/analytics", boardHandler.GetBoardAnalytics).Methods("GET")
+	protected.HandleFunc("/boards/{id}/metrics/cumulative-flow", boardHandler.GetCumulativeFlow).Methods("GET")
+	protected.HandleFunc("/boards/{id}/metrics/cycle-time", boardHandler.GetCycleTimes).Methods("GET")
+	protected.HandleFunc("/boards/{id}/metrics/dwell-time", boardHandler.GetDwellTimes).Methods("GET")
+	protected.HandleFunc("/boards/{id}/sprints", boardHandler.ListSprints).Methods("GET")
+	protected.HandleFunc("/boards/{id}/sprints", boardHandler.CreateSprint).Methods("POST")
+	protected.HandleFunc("/boards/{id}/sprints/{sprintId}", boardHandler.UpdateSprint).Methods("PATCH", "PUT")
+	protected.HandleFunc("/boards/{id}/sprints/{sprintId}", boardHandler.DeleteSprint).Methods("DELETE")
+	protected.HandleFunc("/boards/{id}/sprints/{sprintId}/start", boardHandler.StartSprint).Methods("POST")
+	protected.HandleFunc("/boards/{id}/sprints/{sprintId}/close", boardHandler.CloseSprint).Methods("POST")
+	protected.HandleFunc("/boards/{id}/sprints/{sprintId}/burndown", boardHandler.GetSprintBurndown).Methods("GET")
+	protected.HandleFunc("/boards/{id}/timesheet", boardHandler.GetTimesheet).Methods("GET")
+	protected.HandleFunc("/boards/{id}/custom-fields", boardHandler.ListCustomFields).Methods("GET")
+	protected.HandleFunc("/boards/{id}/custom-fields", boardHandler.CreateCustomField).Methods("POST")
+	protected.HandleFunc("/boards/{id}/custom-fields/{fieldId}", boardHandler.UpdateCustomField).Methods("PATCH", "PUT")
+	protected.HandleFunc("/boards/{id}/custom-fields/{fieldId}", boardHandler.DeleteCustomField).Methods("DELETE")
 	protected.HandleFunc("/users/search", boardHandler.SearchUsers).Methods("GET")
+	protected.HandleFunc("/search", boardHandler.SearchCards).Methods("GET")
+	protected.HandleFunc("/analytics/overview", boardHandler.GetAnalyticsOverview).Methods("GET")
+	protected.HandleFunc("/lists/{id}", boardHandler.UpdateList).Methods("PATCH", "PUT")
 	protected.HandleFunc("/lists/{id}/cards", boardHandler.CreateCard).Methods("POST")
 	protected.HandleFunc("/cards/{id}", boardHandler.GetCard).Methods("GET")
 	protected.HandleFunc("/cards/{id}", boardHandler.UpdateCard).Methods("PATCH", "PUT")
@@ -47,7 +117,40 @@ func main() {
 	protected.HandleFunc("/cards/{id}/comments", boardHandler.AddCardComment).Methods("POST")
 	protected.HandleFunc("/cards/{id}/members", boardHandler.AddCardMember).Methods("POST")
 	protected.HandleFunc("/cards/{id}/members/{userId}", boardHandler.RemoveCardMember).Methods("DELETE")
+	protected.HandleFunc("/cards/{id}/attachments", boardHandler.GetCardAttachments).Methods("GET")
+	protected.HandleFunc("/cards/{id}/attachments", boardHandler.UploadAttachment).Methods("POST")
+	protected.HandleFunc("/attachments/{id}/download", boardHandler.DownloadAttachment).Methods("GET")
+	protected.HandleFunc("/attachments/{id}", boardHandler.DeleteAttachment).Methods("DELETE")
+	protected.HandleFunc("/cards/{id}/relations", boardHandler.GetCardRelations).Methods("GET")
+	protected.HandleFunc("/cards/{id}/relations", boardHandler.AddCardRelation).Methods("POST")
+	protected.HandleFunc("/cards/{id}/relations/{relationId}", boardHandler.RemoveCardRelation).Methods("DELETE")
+	protected.HandleFunc("/cards/{id}/children", boardHandler.GetCardChildren).Methods("GET")
+	protected.HandleFunc("/cards/{id}/children", boardHandler.AttachCardChild).Methods("POST")
+	protected.HandleFunc("/cards/{id}/children/{childId}", boardHandler.DetachCardChild).Methods("DELETE")
+	protected.HandleFunc("/cards/{id}/checklists", boardHandler.GetChecklists).Methods("GET")
+	protected.HandleFunc("/cards/{id}/checklists", boardHandler.CreateChecklist).Methods("POST")
+	protected.HandleFunc("/cards/{id}/checklists/{checklistId}", boardHandler.UpdateChecklist).Methods("PATCH", "PUT")
+	protected.HandleFunc("/cards/{id}/checklists/{checklistId}", boardHandler.DeleteChecklist).Methods("DELETE")
+	protected.HandleFunc("/cards/{id}/checklists/{checklistId}/items", boardHandler.AddChecklistItem).Methods("POST")
+	protected.HandleFunc("/cards/{id}/checklists/{checklistId}/items/{itemId}", boardHandler.UpdateChecklistItem).Methods("PATCH", "PUT")
+	protected.HandleFunc("/cards/{id}/checklists/{checklistId}/items/{itemId}", boardHandler.DeleteChecklistItem).Methods("DELETE")
+	protected.HandleFunc("/cards/{id}/recurrence", boardHandler.GetRecurrence).Methods("GET")
+	protected.HandleFunc("/cards/{id}/recurrence", boardHandler.SetRecurrence).Methods("PUT")
+	protected.HandleFunc("/cards/{id}/recurrence", boardHandler.DeleteRecurrence).Methods("DELETE")
+	protected.HandleFunc("/cards/{id}/recurrence/preview", boardHandler.PreviewRecurrence).Methods("GET")
 	protected.HandleFunc("/cards/{id}/activities", boardHandler.GetCardActivities).Methods("GET")
+	protected.HandleFunc("/cards/{id}/time-entries", boardHandler.GetTimeEntries).Methods("GET")
+	protected.HandleFunc("/cards/{id}/time-entries", boardHandler.CreateTimeEntry).Methods("POST")
+	protected.HandleFunc("/cards/{id}/time-entries/{entryId}", boardHandler.UpdateTimeEntry).Methods("PATCH", "PUT")
+	protected.HandleFunc("/cards/{id}/time-entries/{entryId}", boardHandler.DeleteTimeEntry).Methods("DELETE")
+	protected.HandleFunc("/cards/{id}/timer/start", boardHandler.StartTimer).Methods("POST")
+	protected.HandleFunc("/cards/{id}/timer/stop", boardHandler.StopTimer).Methods("POST")
+	protected.HandleFunc("/activities/{id}/undo", boardHandler.UndoActivity).Methods("POST")
+	protected.HandleFunc("/notifications", notificationHandler.ListNotifications).Methods("GET")
+	protected.HandleFunc("/notifications/read-all", notificationHandler.MarkAllRead).Methods("POST")
+	protected.HandleFunc("/notifications/preferences", notificationHandler.GetPreferences).Methods("GET")
+	protected.HandleFunc("/notifications/preferences", notificationHandler.UpdatePreferences).Methods("PUT")
+	protected.HandleFunc("/notifications/{id}/read", notificationHandler.MarkRead).Methods("POST")
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -2,34 +2,216 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+type ActionType string
+
+const (
+	ActionCreateBoard         ActionType = "create_board"
+	ActionInviteMember        ActionType = "invite_member"
+	ActionRemoveBoardMember   ActionType = "remove_board_member"
+	ActionCreateCard          ActionType = "create_card"
+	ActionMoveCard            ActionType = "move_card"
+	ActionRenameCard          ActionType = "rename_card"
+	ActionUpdateDescription   ActionType = "update_description"
+	ActionUpdateDueDate       ActionType = "update_due_date"
+	ActionUpdateAppearance    ActionType = "update_appearance"
+	ActionAddTag              ActionType = "add_tag"
+	ActionRemoveTag           ActionType = "remove_tag"
+	ActionAddComment          ActionType = "add_comment"
+	ActionAddCardMember       ActionType = "add_member"
+	ActionRemoveCardMember    ActionType = "remove_member"
+	ActionUndo                ActionType = "undo"
+	ActionCheckItem           ActionType = "check_item"
+	ActionUncheckItem         ActionType = "uncheck_item"
+	ActionAddAttachment       ActionType = "add_attachment"
+	ActionRemoveAttachment    ActionType = "remove_attachment"
+	ActionUpdateCustomField   ActionType = "update_custom_field"
+	ActionUpdatePriority      ActionType = "update_priority"
+	ActionUpdateStartDate     ActionType = "update_start_date"
+	ActionCompleteCard        ActionType = "complete_card"
+	ActionReopenCard          ActionType = "reopen_card"
+	ActionAddRelation         ActionType = "add_relation"
+	ActionRemoveRelation      ActionType = "remove_relation"
+	ActionAttachChild         ActionType = "attach_child"
+	ActionDetachChild         ActionType = "detach_child"
+	ActionUpdateSprint        ActionType = "update_sprint"
+	ActionUpdateEstimate      ActionType = "update_estimate"
+	ActionStartSprint         ActionType = "start_sprint"
+	ActionCloseSprint         ActionType = "close_sprint"
+	ActionCreateSprint        ActionType = "create_sprint"
+	ActionEditSprint          ActionType = "edit_sprint"
+	ActionDeleteSprint        ActionType = "delete_sprint"
+	ActionCreateLabel         ActionType = "create_label"
+	ActionEditLabel           ActionType = "edit_label"
+	ActionDeleteLabel         ActionType = "delete_label"
+	ActionEditList            ActionType = "edit_list"
+	ActionUpdateSettings      ActionType = "update_board_settings"
+	ActionCreateCustomField   ActionType = "create_custom_field"
+	ActionEditCustomField     ActionType = "edit_custom_field"
+	ActionDeleteCustomField   ActionType = "delete_custom_field"
+	ActionCreateFilter        ActionType = "create_saved_filter"
+	ActionEditFilter          ActionType = "edit_saved_filter"
+	ActionDeleteFilter        ActionType = "delete_saved_filter"
+	ActionCreateWebhook       ActionType = "create_webhook"
+	ActionDeleteWebhook       ActionType = "delete_webhook"
+	ActionCreateAutomation    ActionType = "create_automation"
+	ActionEditAutomation      ActionType = "edit_automation"
+	ActionDeleteAutomation    ActionType = "delete_automation"
+	ActionSetRecurrence       ActionType = "set_recurrence"
+	ActionRemoveRecurrence    ActionType = "remove_recurrence"
+	ActionAddChecklist        ActionType = "add_checklist"
+	ActionEditChecklist       ActionType = "edit_checklist"
+	ActionRemoveChecklist     ActionType = "remove_checklist"
+	ActionAddChecklistItem    ActionType = "add_checklist_item"
+	ActionEditChecklistItem   ActionType = "edit_checklist_item"
+	ActionRemoveChecklistItem ActionType = "remove_checklist_item"
+	ActionLogTime             ActionType = "log_time"
+	ActionEditTimeEntry       ActionType = "edit_time_entry"
+	ActionDeleteTimeEntry     ActionType = "delete_time_entry"
+	ActionStartTimer          ActionType = "start_timer"
+	ActionStopTimer           ActionType = "stop_timer"
+)
+
+// ActionTypes is the full catalogue, used to validate webhook event filters.
+var ActionTypes = []ActionType{
+	ActionCreateBoard, ActionInviteMember, ActionRemoveBoardMember,
+	ActionCreateCard, ActionMoveCard, ActionRenameCard, ActionUpdateDescription, ActionUpdateDueDate,
+	ActionUpdateAppearance, ActionAddTag, ActionRemoveTag, ActionAddComment,
+	ActionAddCardMember, ActionRemoveCardMember, ActionUndo,
+	ActionCheckItem, ActionUncheckItem, ActionAddAttachment, ActionRemoveAttachment,
+	ActionUpdateCustomField, ActionUpdatePriority, ActionUpdateStartDate, ActionCompleteCard, ActionReopenCard,
+	ActionAddRelation, ActionRemoveRelation, ActionAttachChild, ActionDetachChild,
+	ActionUpdateSprint, ActionUpdateEstimate, ActionStartSprint, ActionCloseSprint,
+	ActionCreateSprint, ActionEditSprint, ActionDeleteSprint,
+	ActionCreateLabel, ActionEditLabel, ActionDeleteLabel, ActionEditList, ActionUpdateSettings,
+	ActionCreateCustomField, ActionEditCustomField, ActionDeleteCustomField,
+	ActionCreateFilter, ActionEditFilter, ActionDeleteFilter, ActionCreateWebhook, ActionDeleteWebhook,
+	ActionCreateAutomation, ActionEditAutomation, ActionDeleteAutomation,
+	ActionSetRecurrence, ActionRemoveRecurrence,
+	ActionAddChecklist, ActionEditChecklist, ActionRemoveChecklist,
+	ActionAddChecklistItem, ActionEditChecklistItem, ActionRemoveChecklistItem,
+	ActionLogTime, ActionEditTimeEntry, ActionDeleteTimeEntry, ActionStartTimer, ActionStopTimer,
+}
+
+func ValidActionType(t ActionType) bool {
+	for _, a := range ActionTypes {
+		if a == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ActivityPayload is the structured record stored alongside the human readable details.
+// Refs maps entity kinds ("board", "list", "card", "user", "tag", "comment") to ids.
+type ActivityPayload struct {
+	ActorID int             `json:"actor_id"`
+	Refs    map[string]int  `json:"refs,omitempty"`
+	Before  json.RawMessage `json:"before,omitempty"`
+	After   json.RawMessage `json:"after,omitempty"`
+}
+
 type Activity struct {
-	ID         int       `json:"id"`
-	CardID     *int      `json:"card_id"`
-	UserID     int       `json:"user_id"`
-	UserEmail  string    `json:"user_email"`
-	ActionType string    `json:"action_type"`
-	Details    string    `json:"details"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID         int              `json:"id"`
+	BoardID    *int             `json:"board_id"`
+	CardID     *int             `json:"card_id"`
+	UserID     int              `json:"user_id"`
+	UserEmail  string           `json:"user_email"`
+	ActionType ActionType       `json:"action_type"`
+	Details    string           `json:"details"`
+	Payload    *ActivityPayload `json:"payload,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+// ActivityEntry describes a mutation to record. Before and After are marshalled to JSON as-is.
+type ActivityEntry struct {
+	BoardID *int
+	CardID  *int
+	UserID  int
+	Action  ActionType
+	Details string
+	Refs    map[string]int
+	Before  interface{}
+	After   interface{}
 }
 
 type ActivityService struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func (s *ActivityService) LogActivity(cardID *int, userID int, actionType, details string) error {
-	_, err := s.DB.Exec(
-		"INSERT INTO activities (card_id, user_id, action_type, details) VALUES ($1, $2, $3, $4)",
-		cardID, userID, actionType, details,
-	)
-	return err
+func (s *ActivityService) Log(e ActivityEntry) (*Activity, error) {
+	payload := ActivityPayload{ActorID: e.UserID, Refs: e.Refs}
+	if e.Before != nil {
+		raw, err := json.Marshal(e.Before)
+		if err != nil {
+			return nil, err
+		}
+		payload.Before = raw
+	}
+	if e.After != nil {
+		raw, err := json.Marshal(e.After)
+		if err != nil {
+			return nil, err
+		}
+		payload.After = raw
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	a := Activity{
+		BoardID:    e.BoardID,
+		CardID:     e.CardID,
+		UserID:     e.UserID,
+		ActionType: e.Action,
+		Details:    e.Details,
+		Payload:    &payload,
+	}
+	err = s.DB.QueryRow(
+		`INSERT INTO activities (board_id, card_id, user_id, action_type, details, payload)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		e.BoardID, e.CardID, e.UserID, string(e.Action), e.Details, raw,
+	).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Webhook deliveries are queued in the same transaction as the activity, so an event
+	// is published if and only if the change it describes was committed.
+	webhooks := &WebhookService{DB: s.DB}
+	if err := webhooks.Enqueue(&a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+const activityColumns = `a.id, a.board_id, a.card_id, a.user_id, u.email, a.action_type, COALESCE(a.details,''), a.payload, a.created_at`
+
+func scanActivity(row interface{ Scan(...interface{}) error }) (*Activity, error) {
+	var a Activity
+	var boardID, cardID sql.NullInt64
+	var payload []byte
+	if err := row.Scan(&a.ID, &boardID, &cardID, &a.UserID, &a.UserEmail, &a.ActionType, &a.Details, &payload, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	a.BoardID = nullIntPtr(boardID)
+	a.CardID = nullIntPtr(cardID)
+	if len(payload) > 0 {
+		var p ActivityPayload
+		if err := json.Unmarshal(payload, &p); err == nil {
+			a.Payload = &p
+		}
+	}
+	return &a, nil
 }
 
 func (s *ActivityService) GetActivitiesByCard(cardID int) ([]Activity, error) {
 	rows, err := s.DB.Query(`
-		SELECT a.id, a.card_id, a.user_id, u.email, a.action_type, a.details, a.created_at
+		SELECT `+activityColumns+`
 		FROM activities a
 		JOIN users u ON a.user_id = u.id
 		WHERE a.card_id = $1
@@ -42,11 +224,46 @@ func (s *ActivityService) GetActivitiesByCard(cardID int) ([]Activity, error) {
 
 	var activities []Activity
 	for rows.Next() {
-		var a Activity
-		if err := rows.Scan(&a.ID, &a.CardID, &a.UserID, &a.UserEmail, &a.ActionType, &a.Details, &a.CreatedAt); err != nil {
+		a, err := scanActivity(rows)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, *a)
+	}
+	return activities, rows.Err()
+}
+
+func (s *ActivityService) GetActivityByID(id int) (*Activity, error) {
+	row := s.DB.QueryRow(`
+		SELECT `+activityColumns+`
+		FROM activities a
+		JOIN users u ON a.user_id = u.id
+		WHERE a.id = $1
+	`, id)
+	return scanActivity(row)
+}
+
+// GetActivitiesByCardSince returns activities recorded on a card after the given activity id, oldest first.
+func (s *ActivityService) GetActivitiesByCardSince(cardID, afterID int) ([]Activity, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+activityColumns+`
+		FROM activities a
+		JOIN users u ON a.user_id = u.id
+		WHERE a.card_id = $1 AND a.id > $2
+		ORDER BY a.id ASC
+	`, cardID, afterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []Activity
+	for rows.Next() {
+		a, err := scanActivity(rows)
+		if err != nil {
 			return nil, err
 		}
-		activities = append(activities, a)
+		activities = append(activities, *a)
 	}
 	return activities, rows.Err()
 }
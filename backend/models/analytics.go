@@ -0,0 +1,269 @@
+package models
+
+import (
+	"math"
+)
+
+// CardCounts counts cards, how many are done (completed, or in a list titled Done) and how
+// many are overdue (past their due date and not done).
+type CardCounts struct {
+	Cards             int `json:"cards"`
+	Done              int `json:"done"`
+	Overdue           int `json:"overdue"`
+	CompletionPercent int `json:"completion_percent"`
+}
+
+func (c *CardCounts) add(o CardCounts) {
+	c.Cards += o.Cards
+	c.Done += o.Done
+	c.Overdue += o.Overdue
+	c.complete()
+}
+
+// complete fills CompletionPercent from the counts.
+func (c *CardCounts) complete() {
+	c.CompletionPercent = 0
+	if c.Cards > 0 {
+		c.CompletionPercent = int(math.Round(float64(c.Done) * 100 / float64(c.Cards)))
+	}
+}
+
+type ListStats struct {
+	ListID   int    `json:"list_id"`
+	Title    string `json:"title"`
+	Position int    `json:"position"`
+	CardCounts
+}
+
+type BoardStats struct {
+	BoardID int    `json:"board_id"`
+	Title   string `json:"title"`
+	Lists   int    `json:"lists"`
+	CardCounts
+}
+
+// MemberStats counts the cards a user is a member of.
+type MemberStats struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	CardCounts
+}
+
+// LabelStats counts the cards carrying a label. Across boards, labels are counted by name,
+// ignoring case, and have no id or color.
+type LabelStats struct {
+	LabelID int    `json:"label_id,omitempty"`
+	Name    string `json:"name"`
+	Color   string `json:"color,omitempty"`
+	CardCounts
+}
+
+// BoardAnalytics sums up one board.
+type BoardAnalytics struct {
+	BoardID int `json:"board_id"`
+	CardCounts
+	Unassigned int           `json:"unassigned"`
+	Lists      []ListStats   `json:"lists"`
+	Members    []MemberStats `json:"members"`
+	Labels     []LabelStats  `json:"labels"`
+}
+
+// AnalyticsOverview sums up every board a user can open.
+type AnalyticsOverview struct {
+	TotalBoards int `json:"total_boards"`
+	TotalLists  int `json:"total_lists"`
+	CardCounts
+	Unassigned int           `json:"unassigned"`
+	Boards     []BoardStats  `json:"boards"`
+	Members    []MemberStats `json:"members"`
+	Labels     []LabelStats  `json:"labels"`
+}
+
+type AnalyticsService struct{ DB DBTX }
+
+// The analytics queries start from a scope CTE, the ids of the boards counted, and a facts CTE
+// with one row per card of those boards.
+const (
+	boardScope = `scope AS (SELECT $1::int AS id)`
+	userScope  = `scope AS (
+	    SELECT b.id FROM boards b
+	    WHERE b.user_id = $1 OR EXISTS (SELECT 1 FROM board_members m WHERE m.board_id = b.id AND m.user_id = $1)
+	)`
+	analyticsFacts = `facts AS (
+	    SELECT c.id, c.list_id, l.board_id,
+	           c.completed OR LOWER(TRIM(l.title)) = 'done' AS done,
+	           c.due_date < NOW() AND NOT c.completed AND LOWER(TRIM(l.title)) <> 'done' AS overdue
+	    FROM cards c JOIN lists l ON l.id = c.list_id JOIN scope s ON s.id = l.board_id
+	)`
+	// countColumns aggregates the facts rows f of a group.
+	countColumns = `COUNT(f.id), COUNT(f.id) FILTER (WHERE f.done), COUNT(f.id) FILTER (WHERE f.overdue)`
+)
+
+// BoardAnalytics counts the board's cards per list, member and label.
+func (s *AnalyticsService) BoardAnalytics(boardID int) (*BoardAnalytics, error) {
+	out := &BoardAnalytics{BoardID: boardID, Lists: []ListStats{}}
+	rows, err := s.DB.Query(`
+		WITH `+boardScope+`, `+analyticsFacts+`
+		SELECT l.id, l.title, l.position, `+countColumns+`
+		FROM lists l
+		LEFT JOIN facts f ON f.list_id = l.id
+		WHERE l.board_id = $1
+		GROUP BY l.id
+		ORDER BY l.position, l.id
+	`, boardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l ListStats
+		if err := rows.Scan(&l.ListID, &l.Title, &l.Position, &l.Cards, &l.Done, &l.Overdue); err != nil {
+			return nil, err
+		}
+		l.complete()
+		out.CardCounts.add(l.CardCounts)
+		out.Lists = append(out.Lists, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if out.Unassigned, err = s.unassigned(boardScope, boardID); err != nil {
+		return nil, err
+	}
+	if out.Members, err = s.members(boardScope, boardID); err != nil {
+		return nil, err
+	}
+	out.Labels, err = s.labels(`
+		WITH `+boardScope+`, `+analyticsFacts+`
+		SELECT bl.id, bl.name, bl.color, `+countColumns+`
+		FROM board_labels bl
+		LEFT JOIN card_labels cl ON cl.label_id = bl.id
+		LEFT JOIN facts f ON f.id = cl.card_id
+		WHERE bl.board_id = $1
+		GROUP BY bl.id
+		ORDER BY COUNT(f.id) DESC, lower(bl.name), bl.id
+	`, boardID)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Overview counts the cards of every board the user owns or is a member of, per board, member
+// and label name.
+func (s *AnalyticsService) Overview(userID int) (*AnalyticsOverview, error) {
+	out := &AnalyticsOverview{Boards: []BoardStats{}}
+	rows, err := s.DB.Query(`
+		WITH `+userScope+`, `+analyticsFacts+`
+		SELECT b.id, b.title, (SELECT COUNT(*) FROM lists WHERE board_id = b.id), `+countColumns+`
+		FROM boards b
+		JOIN scope s ON s.id = b.id
+		LEFT JOIN facts f ON f.board_id = b.id
+		GROUP BY b.id
+		ORDER BY b.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b BoardStats
+		if err := rows.Scan(&b.BoardID, &b.Title, &b.Lists, &b.Cards, &b.Done, &b.Overdue); err != nil {
+			return nil, err
+		}
+		b.complete()
+		out.TotalBoards++
+		out.TotalLists += b.Lists
+		out.CardCounts.add(b.CardCounts)
+		out.Boards = append(out.Boards, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if out.Unassigned, err = s.unassigned(userScope, userID); err != nil {
+		return nil, err
+	}
+	if out.Members, err = s.members(userScope, userID); err != nil {
+		return nil, err
+	}
+	out.Labels, err = s.labels(`
+		WITH `+userScope+`, `+analyticsFacts+`
+		SELECT 0, MIN(bl.name), '', `+countColumns+`
+		FROM board_labels bl
+		JOIN scope s ON s.id = bl.board_id
+		LEFT JOIN card_labels cl ON cl.label_id = bl.id
+		LEFT JOIN facts f ON f.id = cl.card_id
+		GROUP BY lower(bl.name)
+		ORDER BY COUNT(f.id) DESC, lower(bl.name)
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// unassigned counts the cards in scope without members.
+func (s *AnalyticsService) unassigned(scope string, arg int) (int, error) {
+	var n int
+	err := s.DB.QueryRow(`
+		WITH `+scope+`, `+analyticsFacts+`
+		SELECT COUNT(*) FROM facts f WHERE NOT EXISTS (SELECT 1 FROM card_members cm WHERE cm.card_id = f.id)
+	`, arg).Scan(&n)
+	return n, err
+}
+
+// members counts the cards in scope per user, for every member of the boards and anyone
+// still assigned to one of their cards.
+func (s *AnalyticsService) members(scope string, arg int) ([]MemberStats, error) {
+	rows, err := s.DB.Query(`
+		WITH `+scope+`, `+analyticsFacts+`,
+		people AS (
+		    SELECT bm.user_id FROM board_members bm JOIN scope s ON s.id = bm.board_id
+		    UNION
+		    SELECT cm.user_id FROM card_members cm JOIN facts f ON f.id = cm.card_id
+		)
+		SELECT u.id, u.email, `+countColumns+`
+		FROM people p
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN card_members cm ON cm.user_id = u.id
+		LEFT JOIN facts f ON f.id = cm.card_id
+		GROUP BY u.id
+		ORDER BY COUNT(f.id) DESC, u.email
+	`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []MemberStats{}
+	for rows.Next() {
+		var m MemberStats
+		if err := rows.Scan(&m.UserID, &m.Email, &m.Cards, &m.Done, &m.Overdue); err != nil {
+			return nil, err
+		}
+		m.complete()
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func (s *AnalyticsService) labels(query string, arg int) ([]LabelStats, error) {
+	rows, err := s.DB.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []LabelStats{}
+	for rows.Next() {
+		var l LabelStats
+		if err := rows.Scan(&l.LabelID, &l.Name, &l.Color, &l.Cards, &l.Done, &l.Overdue); err != nil {
+			return nil, err
+		}
+		l.complete()
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
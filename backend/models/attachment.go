@@ -0,0 +1,91 @@
+package models
+
+import "time"
+
+type Attachment struct {
+	ID            int       `json:"id"`
+	CardID        int       `json:"card_id"`
+	UploaderID    int       `json:"uploader_id"`
+	UploaderEmail string    `json:"uploader_email"`
+	Filename      string    `json:"filename"`
+	MimeType      string    `json:"mime_type"`
+	Size          int64     `json:"size"`
+	ContentHash   string    `json:"content_hash"`
+	CreatedAt     time.Time `json:"created_at"`
+	// ThumbnailURL is filled in by the handlers for image types that get thumbnails.
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+type AttachmentService struct {
+	DB DBTX
+}
+
+const attachmentColumns = `a.id, a.card_id, COALESCE(a.uploader_id, 0), COALESCE(u.email, ''), a.filename, a.mime_type, a.size_bytes, a.content_hash, a.created_at`
+
+func scanAttachment(row interface{ Scan(...interface{}) error }) (*Attachment, error) {
+	var a Attachment
+	err := row.Scan(&a.ID, &a.CardID, &a.UploaderID, &a.UploaderEmail, &a.Filename, &a.MimeType, &a.Size, &a.ContentHash, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *AttachmentService) CreateAttachment(a *Attachment) (*Attachment, error) {
+	var id int
+	err := s.DB.QueryRow(
+		`INSERT INTO attachments (card_id, uploader_id, filename, mime_type, size_bytes, content_hash)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		a.CardID, a.UploaderID, a.Filename, a.MimeType, a.Size, a.ContentHash,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetAttachmentByID(id)
+}
+
+func (s *AttachmentService) GetAttachmentByID(id int) (*Attachment, error) {
+	return scanAttachment(s.DB.QueryRow(
+		"SELECT "+attachmentColumns+" FROM attachments a LEFT JOIN users u ON u.id = a.uploader_id WHERE a.id = $1", id,
+	))
+}
+
+func (s *AttachmentService) GetAttachmentsByCard(cardID int) ([]Attachment, error) {
+	rows, err := s.DB.Query(
+		"SELECT "+attachmentColumns+" FROM attachments a LEFT JOIN users u ON u.id = a.uploader_id WHERE a.card_id = $1 ORDER BY a.id",
+		cardID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *a)
+	}
+	return out, rows.Err()
+}
+
+func (s *AttachmentService) DeleteAttachment(id int) error {
+	_, err := s.DB.Exec("DELETE FROM attachments WHERE id = $1", id)
+	return err
+}
+
+// HashInUse reports whether any attachment still points at the blob with this content hash.
+func (s *AttachmentService) HashInUse(hash string) (bool, error) {
+	var inUse bool
+	err := s.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM attachments WHERE content_hash = $1)", hash).Scan(&inUse)
+	return inUse, err
+}
+
+// LockHash serialises uploads and deletions of one blob for the rest of the transaction, so
+// a blob is never removed while another upload is about to reference it.
+func (s *AttachmentService) LockHash(hash string) error {
+	_, err := s.DB.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", hash)
+	return err
+}
@@ -0,0 +1,422 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type TriggerType string
+
+const (
+	TriggerCardMoved      TriggerType = "card_moved"
+	TriggerTagAdded       TriggerType = "tag_added"
+	TriggerDueDateReached TriggerType = "due_date_reached"
+	TriggerCardCreated    TriggerType = "card_created"
+)
+
+const (
+	ConditionInList        = "in_list"
+	ConditionNotInList     = "not_in_list"
+	ConditionHasTag        = "has_tag"
+	ConditionLacksTag      = "lacks_tag"
+	ConditionHasMember     = "has_member"
+	ConditionNoMembers     = "no_members"
+	ConditionHasDueDate    = "has_due_date"
+	ConditionNoDueDate     = "no_due_date"
+	ConditionTitleContains = "title_contains"
+)
+
+const (
+	AutomationMoveToList   = "move_to_list"
+	AutomationAssignMember = "assign_member"
+	AutomationRemoveMember = "remove_member"
+	AutomationAddTag       = "add_tag"
+	AutomationRemoveTag    = "remove_tag"
+	AutomationAddComment   = "add_comment"
+	AutomationSetDueDate   = "set_due_date"
+)
+
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	RunSkipped   = "skipped"
+)
+
+// AutomationTrigger fires on one event type. ListID narrows card_moved and card_created to a
+// destination list, Tag narrows tag_added to one tag name.
+type AutomationTrigger struct {
+	Type   TriggerType `json:"type"`
+	ListID *int        `json:"list_id,omitempty"`
+	Tag    string      `json:"tag,omitempty"`
+}
+
+type AutomationCondition struct {
+	Type   string `json:"type"`
+	ListID *int   `json:"list_id,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+	UserID *int   `json:"user_id,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+// AutomationAction is one step of a rule. remove_member without a user removes every member;
+// set_due_date with an empty DueIn clears the due date.
+type AutomationAction struct {
+	Type   string `json:"type"`
+	ListID *int   `json:"list_id,omitempty"`
+	UserID *int   `json:"user_id,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Text   string `json:"text,omitempty"`
+	DueIn  string `json:"due_in,omitempty"`
+}
+
+type AutomationRule struct {
+	ID         int                   `json:"id"`
+	BoardID    int                   `json:"board_id"`
+	Name       string                `json:"name"`
+	Trigger    AutomationTrigger     `json:"trigger"`
+	Conditions []AutomationCondition `json:"conditions"`
+	Actions    []AutomationAction    `json:"actions"`
+	Enabled    bool                  `json:"enabled"`
+	CreatedBy  int                   `json:"created_by"`
+	CreatedAt  time.Time             `json:"created_at"`
+	UpdatedAt  time.Time             `json:"updated_at"`
+}
+
+// AutomationRun is one entry of a board's execution log.
+type AutomationRun struct {
+	ID        int         `json:"id"`
+	RuleID    *int        `json:"rule_id"`
+	RuleName  string      `json:"rule_name"`
+	BoardID   int         `json:"board_id"`
+	CardID    *int        `json:"card_id"`
+	Trigger   TriggerType `json:"trigger"`
+	Status    string      `json:"status"`
+	Depth     int         `json:"depth"`
+	Actions   []string    `json:"actions"`
+	Error     string      `json:"error,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// DueTrigger is a card whose due date was claimed for due_date_reached rules.
+type DueTrigger struct {
+	CardID       int
+	BoardID      int
+	BoardOwnerID int
+}
+
+// ParseDueIn reads the set_due_date offset: a Go duration ("36h") or a number of days ("3d").
+func ParseDueIn(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid due_in %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid due_in %q", s)
+	}
+	return d, nil
+}
+
+// Validate checks the shape of the rule. Whether referenced lists and users belong to the
+// board is checked by the handler.
+func (r *AutomationRule) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch r.Trigger.Type {
+	case TriggerCardMoved, TriggerCardCreated, TriggerTagAdded, TriggerDueDateReached:
+	default:
+		return fmt.Errorf("unknown trigger type %q", r.Trigger.Type)
+	}
+
+	for _, c := range r.Conditions {
+		switch c.Type {
+		case ConditionInList, ConditionNotInList:
+			if c.ListID == nil {
+				return fmt.Errorf("condition %s requires list_id", c.Type)
+			}
+		case ConditionHasTag, ConditionLacksTag:
+			if strings.TrimSpace(c.Tag) == "" {
+				return fmt.Errorf("condition %s requires tag", c.Type)
+			}
+		case ConditionTitleContains:
+			if strings.TrimSpace(c.Value) == "" {
+				return fmt.Errorf("condition %s requires value", c.Type)
+			}
+		case ConditionHasMember, ConditionNoMembers, ConditionHasDueDate, ConditionNoDueDate:
+		default:
+			return fmt.Errorf("unknown condition type %q", c.Type)
+		}
+	}
+
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+	for _, a := range r.Actions {
+		switch a.Type {
+		case AutomationMoveToList:
+			if a.ListID == nil {
+				return fmt.Errorf("action %s requires list_id", a.Type)
+			}
+		case AutomationAssignMember:
+			if a.UserID == nil {
+				return fmt.Errorf("action %s requires user_id", a.Type)
+			}
+		case AutomationAddTag, AutomationRemoveTag:
+			if strings.TrimSpace(a.Tag) == "" {
+				return fmt.Errorf("action %s requires tag", a.Type)
+			}
+		case AutomationAddComment:
+			if strings.TrimSpace(a.Text) == "" {
+				return fmt.Errorf("action %s requires text", a.Type)
+			}
+		case AutomationSetDueDate:
+			if a.DueIn != "" {
+				if _, err := ParseDueIn(a.DueIn); err != nil {
+					return err
+				}
+			}
+		case AutomationRemoveMember:
+		default:
+			return fmt.Errorf("unknown action type %q", a.Type)
+		}
+	}
+	return nil
+}
+
+type AutomationService struct {
+	DB DBTX
+}
+
+const automationRuleColumns = `id, board_id, name, trigger, conditions, actions, enabled, COALESCE(created_by, 0), created_at, updated_at`
+
+func scanAutomationRule(row interface{ Scan(...interface{}) error }) (*AutomationRule, error) {
+	var r AutomationRule
+	var trigger, conditions, actions []byte
+	err := row.Scan(&r.ID, &r.BoardID, &r.Name, &trigger, &conditions, &actions, &r.Enabled, &r.CreatedBy, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(trigger, &r.Trigger); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(conditions, &r.Conditions); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(actions, &r.Actions); err != nil {
+		return nil, err
+	}
+	if r.Conditions == nil {
+		r.Conditions = []AutomationCondition{}
+	}
+	return &r, nil
+}
+
+func marshalRule(r *AutomationRule) (trigger, conditions, actions []byte, err error) {
+	if r.Conditions == nil {
+		r.Conditions = []AutomationCondition{}
+	}
+	if trigger, err = json.Marshal(r.Trigger); err != nil {
+		return
+	}
+	if conditions, err = json.Marshal(r.Conditions); err != nil {
+		return
+	}
+	actions, err = json.Marshal(r.Actions)
+	return
+}
+
+func (s *AutomationService) CreateRule(r *AutomationRule) (*AutomationRule, error) {
+	trigger, conditions, actions, err := marshalRule(r)
+	if err != nil {
+		return nil, err
+	}
+	var id int
+	err = s.DB.QueryRow(
+		`INSERT INTO automation_rules (board_id, name, trigger_type, trigger, conditions, actions, enabled, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		r.BoardID, r.Name, string(r.Trigger.Type), trigger, conditions, actions, r.Enabled, r.CreatedBy,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetRuleByID(id)
+}
+
+func (s *AutomationService) UpdateRule(r *AutomationRule) (*AutomationRule, error) {
+	trigger, conditions, actions, err := marshalRule(r)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.DB.Exec(
+		`UPDATE automation_rules SET name = $2, trigger_type = $3, trigger = $4, conditions = $5, actions = $6,
+		   enabled = $7, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1`,
+		r.ID, r.Name, string(r.Trigger.Type), trigger, conditions, actions, r.Enabled,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetRuleByID(r.ID)
+}
+
+func (s *AutomationService) GetRuleByID(id int) (*AutomationRule, error) {
+	return scanAutomationRule(s.DB.QueryRow("SELECT "+automationRuleColumns+" FROM automation_rules WHERE id = $1", id))
+}
+
+func (s *AutomationService) queryRules(query string, args ...interface{}) ([]AutomationRule, error) {
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AutomationRule
+	for rows.Next() {
+		r, err := scanAutomationRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *r)
+	}
+	return out, rows.Err()
+}
+
+func (s *AutomationService) GetRulesByBoard(boardID int) ([]AutomationRule, error) {
+	return s.queryRules("SELECT "+automationRuleColumns+" FROM automation_rules WHERE board_id = $1 ORDER BY id", boardID)
+}
+
+// GetEnabledRules returns the board's enabled rules for one trigger type, in creation order.
+func (s *AutomationService) GetEnabledRules(boardID int, trigger TriggerType) ([]AutomationRule, error) {
+	return s.queryRules(
+		"SELECT "+automationRuleColumns+" FROM automation_rules WHERE board_id = $1 AND trigger_type = $2 AND enabled ORDER BY id",
+		boardID, string(trigger),
+	)
+}
+
+func (s *AutomationService) DeleteRule(boardID, id int) (bool, error) {
+	res, err := s.DB.Exec("DELETE FROM automation_rules WHERE id = $1 AND board_id = $2", id, boardID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *AutomationService) LogRun(run AutomationRun) error {
+	if run.Actions == nil {
+		run.Actions = []string{}
+	}
+	actions, err := json.Marshal(run.Actions)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(
+		`INSERT INTO automation_runs (rule_id, rule_name, board_id, card_id, trigger_type, status, depth, actions, error)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))`,
+		run.RuleID, run.RuleName, run.BoardID, run.CardID, string(run.Trigger), run.Status, run.Depth, actions, run.Error,
+	)
+	return err
+}
+
+// GetRunsByBoard returns the execution log newest first, optionally narrowed to one rule.
+func (s *AutomationService) GetRunsByBoard(boardID int, ruleID *int, limit, offset int) ([]AutomationRun, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, rule_id, rule_name, board_id, card_id, trigger_type, status, depth, actions, COALESCE(error, ''), created_at
+		FROM automation_runs
+		WHERE board_id = $1 AND ($2::int IS NULL OR rule_id = $2)
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4
+	`, boardID, ruleID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AutomationRun
+	for rows.Next() {
+		var run AutomationRun
+		var ruleIDVal, cardID sql.NullInt64
+		var actions []byte
+		err := rows.Scan(&run.ID, &ruleIDVal, &run.RuleName, &run.BoardID, &cardID, &run.Trigger, &run.Status,
+			&run.Depth, &actions, &run.Error, &run.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		run.RuleID = nullIntPtr(ruleIDVal)
+		run.CardID = nullIntPtr(cardID)
+		if err := json.Unmarshal(actions, &run.Actions); err != nil {
+			return nil, err
+		}
+		out = append(out, run)
+	}
+	return out, rows.Err()
+}
+
+// ClaimDueTriggers locks cards whose due date fell in (from, to] on boards with an enabled
+// due_date_reached rule, and records the due date as handled. It must run inside a
+// transaction; rows locked by another replica are skipped so each due date fires once.
+func (s *AutomationService) ClaimDueTriggers(from, to time.Time, limit int) ([]DueTrigger, error) {
+	rows, err := s.DB.Query(`
+		SELECT c.id, c.due_date, b.id, b.user_id
+		FROM cards c
+		JOIN lists l ON l.id = c.list_id
+		JOIN boards b ON b.id = l.board_id
+		WHERE c.due_date > $1 AND c.due_date <= $2
+		  AND EXISTS (
+		    SELECT 1 FROM automation_rules ar
+		    WHERE ar.board_id = b.id AND ar.enabled AND ar.trigger_type = $3
+		  )
+		  AND NOT EXISTS (
+		    SELECT 1 FROM automation_due_triggers t WHERE t.card_id = c.id AND t.due_date = c.due_date
+		  )
+		ORDER BY c.due_date
+		LIMIT $4
+		FOR UPDATE OF c SKIP LOCKED
+	`, from, to, string(TriggerDueDateReached), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type candidate struct {
+		trigger DueTrigger
+		dueDate time.Time
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.trigger.CardID, &c.dueDate, &c.trigger.BoardID, &c.trigger.BoardOwnerID); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var claimed []DueTrigger
+	for _, c := range candidates {
+		res, err := s.DB.Exec(
+			`INSERT INTO automation_due_triggers (card_id, due_date) VALUES ($1, $2)
+			 ON CONFLICT (card_id, due_date) DO NOTHING`,
+			c.trigger.CardID, c.dueDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			claimed = append(claimed, c.trigger)
+		}
+	}
+	return claimed, nil
+}
@@ -1,7 +1,6 @@
 package models
 
 import (
-    "database/sql"
     "time"
 )
 
@@ -9,11 +8,19 @@ type Board struct {
     ID        int       `json:"id"`
     UserID    int       `json:"user_id"`
     Title     string    `json:"title"`
+    // WIPPolicy is what happens when a card enters a list at its WIP limit: "block" refuses
+    // the card, "warn" lets it in with a warning.
+    WIPPolicy string    `json:"wip_policy"`
     CreatedAt time.Time `json:"created_at"`
 }
 
+const (
+    WIPBlock = "block"
+    WIPWarn  = "warn"
+)
+
 type BoardService struct {
-    DB *sql.DB
+    DB DBTX
 }
 
 func (bs *BoardService) CreateBoard(userID int, title string) (*Board, error) {
@@ -30,7 +37,7 @@ func (bs *BoardService) CreateBoard(userID int, title string) (*Board, error) {
 
 func (bs *BoardService) GetBoardsByUser(userID int) ([]Board, error) {
     rows, err := bs.DB.Query(
-        "SELECT id, user_id, title, created_at FROM boards WHERE user_id = $1 ORDER BY created_at DESC",
+        "SELECT id, user_id, title, wip_policy, created_at FROM boards WHERE user_id = $1 ORDER BY created_at DESC",
         userID,
     )
     if err != nil {
@@ -41,7 +48,7 @@ func (bs *BoardService) GetBoardsByUser(userID int) ([]Board, error) {
     var boards []Board
     for rows.Next() {
         var b Board
-        if err := rows.Scan(&b.ID, &b.UserID, &b.Title, &b.CreatedAt); err != nil {
+        if err := rows.Scan(&b.ID, &b.UserID, &b.Title, &b.WIPPolicy, &b.CreatedAt); err != nil {
             return nil, err
         }
         boards = append(boards, b)
@@ -55,12 +62,19 @@ func (bs *BoardService) GetBoardsByUser(userID int) ([]Board, error) {
 func (bs *BoardService) GetBoardByID(id int) (*Board, error) {
     var b Board
     err := bs.DB.QueryRow(
-        "SELECT id, user_id, title, created_at FROM boards WHERE id = $1",
+        "SELECT id, user_id, title, wip_policy, created_at FROM boards WHERE id = $1",
         id,
-    ).Scan(&b.ID, &b.UserID, &b.Title, &b.CreatedAt)
+    ).Scan(&b.ID, &b.UserID, &b.Title, &b.WIPPolicy, &b.CreatedAt)
     if err != nil {
         return nil, err
     }
     return &b, nil
 }
 
+func (bs *BoardService) SetWIPPolicy(id int, policy string) (*Board, error) {
+    _, err := bs.DB.Exec("UPDATE boards SET wip_policy = $2 WHERE id = $1", id, policy)
+    if err != nil {
+        return nil, err
+    }
+    return bs.GetBoardByID(id)
+}
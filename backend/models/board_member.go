@@ -1,7 +1,6 @@
 package models
 
 import (
-	"database/sql"
 	"time"
 )
 
@@ -15,7 +14,7 @@ type BoardMember struct {
 }
 
 type BoardMemberService struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (bms *BoardMemberService) AddMember(boardID, userID int, role string) (*BoardMember, error) {
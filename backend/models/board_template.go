@@ -0,0 +1,235 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// BoardTemplate is a blueprint for new boards. Built-in templates have no owner and are
+// shared by everyone; the others belong to the user who saved them.
+type BoardTemplate struct {
+	ID          int             `json:"id"`
+	UserID      *int            `json:"user_id"`
+	Key         string          `json:"key,omitempty"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	BuiltIn     bool            `json:"built_in"`
+	Content     TemplateContent `json:"content"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// TemplateContent is what a template creates: labels first, then lists in order with their
+// sample cards. Cards name their labels, which are matched to the template's by name.
+type TemplateContent struct {
+	Labels []TemplateLabel `json:"labels"`
+	Lists  []TemplateList  `json:"lists"`
+}
+
+type TemplateLabel struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type TemplateList struct {
+	Title    string         `json:"title"`
+	Accent   string         `json:"accent"`
+	WIPLimit *int           `json:"wip_limit,omitempty"`
+	Cards    []TemplateCard `json:"cards"`
+}
+
+type TemplateCard struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Labels      []string            `json:"labels,omitempty"`
+	Checklists  []TemplateChecklist `json:"checklists,omitempty"`
+}
+
+type TemplateChecklist struct {
+	Title string   `json:"title"`
+	Items []string `json:"items"`
+}
+
+// ErrTemplateExists is returned when the user already has a template with the name, ignoring case.
+var ErrTemplateExists = errors.New("you already have a template with this name")
+
+// DefaultTemplateKey is the built-in template of boards created without one.
+const DefaultTemplateKey = "kanban"
+
+func intPtr(n int) *int { return &n }
+
+// builtinTemplates are written to board_templates at startup, keyed by Key, so changes here
+// reach existing databases.
+var builtinTemplates = []BoardTemplate{
+	{
+		Key:         "kanban",
+		Name:        "Kanban",
+		Description: "Ideas → In Progress → Review → Done",
+		Content: TemplateContent{
+			Labels: []TemplateLabel{},
+			Lists: []TemplateList{
+				{Title: "Ideas", Accent: "accent", Cards: []TemplateCard{}},
+				{Title: "In Progress", Accent: "primary", Cards: []TemplateCard{}},
+				{Title: "Review", Accent: "warning", Cards: []TemplateCard{}},
+				{Title: "Done", Accent: "success", Cards: []TemplateCard{}},
+			},
+		},
+	},
+	{
+		Key:         "scrum",
+		Name:        "Scrum",
+		Description: "Backlog → In Progress → Review → Done",
+		Content: TemplateContent{
+			Labels: []TemplateLabel{{Name: "Story", Color: "primary"}, {Name: "Bug", Color: "destructive"}, {Name: "Chore", Color: "accent"}},
+			Lists: []TemplateList{
+				{Title: "Backlog", Accent: "accent", Cards: []TemplateCard{
+					{
+						Title:       "Plan the first sprint",
+						Description: "Pick the stories for the sprint, estimate them and agree on a sprint goal.",
+						Labels:      []string{"Chore"},
+						Checklists: []TemplateChecklist{{Title: "Sprint planning", Items: []string{
+							"Order the backlog", "Estimate the top stories", "Write the sprint goal", "Create the sprint",
+						}}},
+					},
+				}},
+				{Title: "In Progress", Accent: "primary", WIPLimit: intPtr(5), Cards: []TemplateCard{}},
+				{Title: "Review", Accent: "warning", Cards: []TemplateCard{}},
+				{Title: "Done", Accent: "success", Cards: []TemplateCard{}},
+			},
+		},
+	},
+	{
+		Key:         "personal",
+		Name:        "Personal Tasks",
+		Description: "To do → Doing → Done",
+		Content: TemplateContent{
+			Labels: []TemplateLabel{{Name: "Home", Color: "success"}, {Name: "Work", Color: "primary"}, {Name: "Urgent", Color: "destructive"}},
+			Lists: []TemplateList{
+				{Title: "To do", Accent: "accent", Cards: []TemplateCard{
+					{Title: "Weekly review", Labels: []string{"Home"}, Checklists: []TemplateChecklist{{Title: "Review", Items: []string{
+						"Clear the inbox", "Look at next week's calendar", "Pick three priorities",
+					}}}},
+				}},
+				{Title: "Doing", Accent: "primary", WIPLimit: intPtr(3), Cards: []TemplateCard{}},
+				{Title: "Done", Accent: "success", Cards: []TemplateCard{}},
+			},
+		},
+	},
+	{
+		Key:         "bugs",
+		Name:        "Bug Tracker",
+		Description: "New → Investigating → Fix → QA → Closed",
+		Content: TemplateContent{
+			Labels: []TemplateLabel{{Name: "Critical", Color: "destructive"}, {Name: "Major", Color: "warning"}, {Name: "Minor", Color: "accent"}},
+			Lists: []TemplateList{
+				{Title: "New", Accent: "accent", Cards: []TemplateCard{
+					{
+						Title:       "Example: login fails with an expired session",
+						Description: "Steps to reproduce, expected and actual behaviour, and the version affected.",
+						Labels:      []string{"Major"},
+						Checklists: []TemplateChecklist{{Title: "Triage", Items: []string{
+							"Reproduce", "Set the severity", "Find the owner",
+						}}},
+					},
+				}},
+				{Title: "Investigating", Accent: "primary", Cards: []TemplateCard{}},
+				{Title: "Fix in Progress", Accent: "primary", Cards: []TemplateCard{}},
+				{Title: "QA", Accent: "warning", Cards: []TemplateCard{}},
+				{Title: "Closed", Accent: "success", Cards: []TemplateCard{}},
+			},
+		},
+	},
+}
+
+// seedBoardTemplates writes the built-in templates, replacing their previous versions.
+func seedBoardTemplates(db *sql.DB) error {
+	for _, t := range builtinTemplates {
+		content, err := json.Marshal(t.Content)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`
+			INSERT INTO board_templates (builtin_key, name, description, content) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (builtin_key) DO UPDATE SET name = EXCLUDED.name, description = EXCLUDED.description, content = EXCLUDED.content
+		`, t.Key, t.Name, t.Description, content)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type TemplateService struct{ DB DBTX }
+
+const templateColumns = `id, user_id, COALESCE(builtin_key, ''), name, description, content, created_at`
+
+func scanTemplate(row interface{ Scan(...interface{}) error }) (*BoardTemplate, error) {
+	var t BoardTemplate
+	var owner sql.NullInt64
+	var content []byte
+	if err := row.Scan(&t.ID, &owner, &t.Key, &t.Name, &t.Description, &content, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &t.Content); err != nil {
+		return nil, err
+	}
+	t.UserID = nullIntPtr(owner)
+	t.BuiltIn = t.UserID == nil
+	return &t, nil
+}
+
+func (s *TemplateService) CreateTemplate(userID int, name, description string, content TemplateContent) (*BoardTemplate, error) {
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	var id int
+	err = s.DB.QueryRow(
+		"INSERT INTO board_templates (user_id, name, description, content) VALUES ($1, $2, $3, $4) ON CONFLICT (user_id, lower(name)) DO NOTHING RETURNING id",
+		userID, name, description, raw,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrTemplateExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTemplateByID(id)
+}
+
+func (s *TemplateService) GetTemplateByID(id int) (*BoardTemplate, error) {
+	return scanTemplate(s.DB.QueryRow("SELECT "+templateColumns+" FROM board_templates WHERE id = $1", id))
+}
+
+// GetTemplateByKey returns the built-in template with the key.
+func (s *TemplateService) GetTemplateByKey(key string) (*BoardTemplate, error) {
+	return scanTemplate(s.DB.QueryRow("SELECT "+templateColumns+" FROM board_templates WHERE builtin_key = $1", key))
+}
+
+// GetTemplates lists the built-in templates, then the user's own by name.
+func (s *TemplateService) GetTemplates(userID int) ([]BoardTemplate, error) {
+	rows, err := s.DB.Query(
+		"SELECT "+templateColumns+" FROM board_templates WHERE user_id IS NULL OR user_id = $1 ORDER BY user_id NULLS FIRST, CASE WHEN user_id IS NULL THEN id END, lower(name)",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []BoardTemplate
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+func (s *TemplateService) DeleteTemplate(id int) error {
+	_, err := s.DB.Exec("DELETE FROM board_templates WHERE id = $1", id)
+	return err
+}
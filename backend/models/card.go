@@ -16,9 +16,58 @@ type Card struct {
 	DueDate     *time.Time   `json:"due_date"`
 	Tags        []CardTag    `json:"tags,omitempty"`
 	Members     []CardMember `json:"members,omitempty"`
+
+	// CoverAttachmentID is an image attachment shown on top of the card; CoverColor is a
+	// palette color used when there is no image, or while it loads.
+	CoverAttachmentID *int   `json:"cover_attachment_id"`
+	CoverColor        string `json:"cover_color"`
+
+	// StartDate, when set with DueDate, is before it. CompletedAt is when the card was last
+	// marked completed and is cleared when it is reopened.
+	Priority    Priority   `json:"priority"`
+	StartDate   *time.Time `json:"start_date"`
+	Completed   bool       `json:"completed"`
+	CompletedAt *time.Time `json:"completed_at"`
+
+	// ParentCardID is the epic the card belongs to, on any list or board.
+	ParentCardID *int `json:"parent_card_id"`
+
+	// SprintID is a sprint of the card's board; StoryPoints is the card's estimate.
+	SprintID    *int     `json:"sprint_id"`
+	StoryPoints *float64 `json:"story_points"`
 }
 
-type CardService struct{ DB *sql.DB }
+// ChildProgress counts a card's children and how many of them are done: completed, or in a
+// list titled Done.
+type ChildProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// Priority is a card's urgency, from PriorityNone to PriorityUrgent.
+type Priority string
+
+const (
+	PriorityNone   Priority = "none"
+	PriorityLow    Priority = "low"
+	PriorityMedium Priority = "medium"
+	PriorityHigh   Priority = "high"
+	PriorityUrgent Priority = "urgent"
+)
+
+// Priorities lists the priorities in increasing order of urgency.
+var Priorities = []Priority{PriorityNone, PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent}
+
+func ValidPriority(p Priority) bool {
+	for _, v := range Priorities {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
+
+type CardService struct{ DB DBTX }
 
 func (s *CardService) CreateCard(listID int, title, badge, color string, position int) (*Card, error) {
 	var id int
@@ -29,32 +78,60 @@ func (s *CardService) CreateCard(listID int, title, badge, color string, positio
 	if err != nil {
 		return nil, err
 	}
+	if err := s.recordTransition(id, nil, listID); err != nil {
+		return nil, err
+	}
 	return s.GetCardByID(id)
 }
 
-func (s *CardService) GetCardByID(id int) (*Card, error) {
+const cardColumns = `id, list_id, title, COALESCE(description,''), badge, color, position, due_date, cover_attachment_id, cover_color,
+	priority, start_date, completed, completed_at, parent_card_id, sprint_id, story_points`
+
+func scanCard(row interface{ Scan(...interface{}) error }) (*Card, error) {
 	var c Card
-	var dueDate sql.NullTime
-	err := s.DB.QueryRow("SELECT id, list_id, title, COALESCE(description,''), badge, color, position, due_date FROM cards WHERE id=$1", id).
-		Scan(&c.ID, &c.ListID, &c.Title, &c.Description, &c.Badge, &c.Color, &c.Position, &dueDate)
+	var dueDate, startDate, completedAt sql.NullTime
+	var cover, parent, sprint sql.NullInt64
+	var points sql.NullFloat64
+	err := row.Scan(&c.ID, &c.ListID, &c.Title, &c.Description, &c.Badge, &c.Color, &c.Position, &dueDate, &cover, &c.CoverColor,
+		&c.Priority, &startDate, &c.Completed, &completedAt, &parent, &sprint, &points)
 	if err != nil {
 		return nil, err
 	}
 	if dueDate.Valid {
 		c.DueDate = &dueDate.Time
 	}
-	
+	if startDate.Valid {
+		c.StartDate = &startDate.Time
+	}
+	if completedAt.Valid {
+		c.CompletedAt = &completedAt.Time
+	}
+	c.CoverAttachmentID = nullIntPtr(cover)
+	c.ParentCardID = nullIntPtr(parent)
+	c.SprintID = nullIntPtr(sprint)
+	if points.Valid {
+		c.StoryPoints = &points.Float64
+	}
+	return &c, nil
+}
+
+func (s *CardService) GetCardByID(id int) (*Card, error) {
+	c, err := scanCard(s.DB.QueryRow("SELECT "+cardColumns+" FROM cards WHERE id=$1", id))
+	if err != nil {
+		return nil, err
+	}
+
 	memberService := &CardMemberService{DB: s.DB}
 	members, err := memberService.GetMembersByCard(id)
 	if err == nil {
 		c.Members = members
 	}
 
-	return &c, nil
+	return c, nil
 }
 
 func (s *CardService) GetCardsByList(listID int) ([]Card, error) {
-	rows, err := s.DB.Query("SELECT id, list_id, title, COALESCE(description,''), badge, color, position, due_date FROM cards WHERE list_id=$1 ORDER BY position, id", listID)
+	rows, err := s.DB.Query("SELECT "+cardColumns+" FROM cards WHERE list_id=$1 ORDER BY position, id", listID)
 	if err != nil {
 		return nil, err
 	}
@@ -63,32 +140,233 @@ func (s *CardService) GetCardsByList(listID int) ([]Card, error) {
 	memberService := &CardMemberService{DB: s.DB}
 
 	for rows.Next() {
-		var c Card
-		var dueDate sql.NullTime
-		if err := rows.Scan(&c.ID, &c.ListID, &c.Title, &c.Description, &c.Badge, &c.Color, &c.Position, &dueDate); err != nil {
+		c, err := scanCard(rows)
+		if err != nil {
 			return nil, err
 		}
-		if dueDate.Valid {
-			c.DueDate = &dueDate.Time
-		}
-		
+
 		members, err := memberService.GetMembersByCard(c.ID)
 		if err == nil {
 			c.Members = members
 		}
-		
-		out = append(out, c)
+
+		out = append(out, *c)
 	}
 	return out, rows.Err()
 }
 
+// UpdateCard saves the card's fields, recording a transition when it changes list.
 func (s *CardService) UpdateCard(id int, title, description, badge, color string, listID int, position int, dueDate *time.Time) (*Card, error) {
+	var fromListID int
+	err := s.DB.QueryRow(`
+		UPDATE cards c SET title=$1, description=$2, badge=$3, color=$4, list_id=$5, position=$6, due_date=$7
+		FROM (SELECT id, list_id FROM cards WHERE id=$8 FOR UPDATE) old
+		WHERE c.id = old.id
+		RETURNING old.list_id
+	`, title, description, badge, color, listID, position, dueDate, id).Scan(&fromListID)
+	if err != nil {
+		return nil, err
+	}
+	if fromListID != listID {
+		if err := s.recordTransition(id, &fromListID, listID); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetCardByID(id)
+}
+
+// recordTransition notes that the card entered toListID, coming from fromListID or, when it is
+// nil, being created there.
+func (s *CardService) recordTransition(cardID int, fromListID *int, toListID int) error {
 	_, err := s.DB.Exec(
-		"UPDATE cards SET title=$1, description=$2, badge=$3, color=$4, list_id=$5, position=$6, due_date=$7 WHERE id=$8",
-		title, description, badge, color, listID, position, dueDate, id,
+		"INSERT INTO card_transitions (card_id, board_id, from_list_id, to_list_id) SELECT $1, board_id, $2, $3 FROM lists WHERE id = $3",
+		cardID, fromListID, toListID,
 	)
+	return err
+}
+
+// SetCover sets the card's cover image and color; a nil attachmentID removes the image.
+func (s *CardService) SetCover(id int, attachmentID *int, color string) error {
+	_, err := s.DB.Exec("UPDATE cards SET cover_attachment_id=$2, cover_color=$3 WHERE id=$1", id, attachmentID, color)
+	return err
+}
+
+// SetSchedule sets the card's priority, start date and completion. completed_at is stamped
+// when the card becomes completed and cleared when it is reopened.
+func (s *CardService) SetSchedule(id int, priority Priority, startDate *time.Time, completed bool) error {
+	_, err := s.DB.Exec(`
+		UPDATE cards SET priority=$2, start_date=$3, completed=$4,
+		       completed_at = CASE WHEN NOT $4 THEN NULL WHEN completed THEN completed_at ELSE NOW() END
+		WHERE id=$1
+	`, id, string(priority), startDate, completed)
+	return err
+}
+
+// SetPlanning puts the card in a sprint (or the backlog, when sprintID is nil) and sets its
+// estimate.
+func (s *CardService) SetPlanning(id int, sprintID *int, storyPoints *float64) error {
+	_, err := s.DB.Exec("UPDATE cards SET sprint_id=$2, story_points=$3 WHERE id=$1", id, sprintID, storyPoints)
+	return err
+}
+
+// SetParent makes the card a child of parentID, or detaches it when parentID is nil.
+func (s *CardService) SetParent(id int, parentID *int) error {
+	_, err := s.DB.Exec("UPDATE cards SET parent_card_id=$2 WHERE id=$1", id, parentID)
+	return err
+}
+
+// LockHierarchy serialises parent changes for the rest of the enclosing transaction, so two
+// concurrent attachments cannot make a loop that neither sees alone.
+func (s *CardService) LockHierarchy() error {
+	_, err := s.DB.Exec("SELECT pg_advisory_xact_lock(hashtext('card_parents'))")
+	return err
+}
+
+// IsAncestor reports whether ancestorID is the card itself or one of its parents, grandparents
+// and so on. Attaching an ancestor as a child would make a loop.
+func (s *CardService) IsAncestor(ancestorID, id int) (bool, error) {
+	var found bool
+	err := s.DB.QueryRow(`
+		WITH RECURSIVE up(id) AS (
+		    SELECT $2::int
+		    UNION
+		    SELECT c.parent_card_id FROM cards c JOIN up ON c.id = up.id WHERE c.parent_card_id IS NOT NULL
+		)
+		SELECT EXISTS (SELECT 1 FROM up WHERE id = $1)
+	`, ancestorID, id).Scan(&found)
+	return found, err
+}
+
+// GetChildren lists the card's children in board, list and card order.
+func (s *CardService) GetChildren(id int) ([]RelatedCard, error) {
+	rows, err := s.DB.Query(`
+		SELECT c.id, c.title, c.list_id, l.title, l.board_id, c.completed OR LOWER(TRIM(l.title)) = 'done'
+		FROM cards c
+		JOIN lists l ON l.id = c.list_id
+		WHERE c.parent_card_id = $1
+		ORDER BY l.board_id, l.position, c.position, c.id
+	`, id)
 	if err != nil {
 		return nil, err
 	}
-	return s.GetCardByID(id)
+	defer rows.Close()
+
+	var out []RelatedCard
+	for rows.Next() {
+		var c RelatedCard
+		if err := rows.Scan(&c.ID, &c.Title, &c.ListID, &c.ListTitle, &c.BoardID, &c.Resolved); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// ChildProgressByBoard returns child progress for every card of the board that has children,
+// wherever the children are.
+func (s *CardService) ChildProgressByBoard(boardID int) (map[int]ChildProgress, error) {
+	rows, err := s.DB.Query(`
+		SELECT ch.parent_card_id,
+		       COUNT(*) FILTER (WHERE ch.completed OR LOWER(TRIM(chl.title)) = 'done'), COUNT(*)
+		FROM cards ch
+		JOIN lists chl ON chl.id = ch.list_id
+		JOIN cards p ON p.id = ch.parent_card_id
+		JOIN lists pl ON pl.id = p.list_id
+		WHERE pl.board_id = $1
+		GROUP BY ch.parent_card_id
+	`, boardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int]ChildProgress{}
+	for rows.Next() {
+		var parentID int
+		var p ChildProgress
+		if err := rows.Scan(&parentID, &p.Done, &p.Total); err != nil {
+			return nil, err
+		}
+		out[parentID] = p
+	}
+	return out, rows.Err()
+}
+
+// MatchingCardIDs returns the ids of the board's cards that match cond, an SQL condition over
+// cards c and lists l with parameters from $1 on, as compiled by the cardfilter package.
+func (s *CardService) MatchingCardIDs(boardID int, cond string, args []interface{}) (map[int]bool, error) {
+	rows, err := s.DB.Query(
+		"SELECT c.id FROM cards c JOIN lists l ON l.id = c.list_id WHERE l.board_id = $1 AND ("+shiftParams(cond, 1)+")",
+		append([]interface{}{boardID}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out[id] = true
+	}
+	return out, rows.Err()
+}
+
+// LockCard takes a row lock on the card for the rest of the enclosing transaction.
+func (s *CardService) LockCard(id int) error {
+	var locked int
+	return s.DB.QueryRow("SELECT id FROM cards WHERE id=$1 FOR UPDATE", id).Scan(&locked)
+}
+
+// CloneCard copies a card's title, description, badge, color, cover color, priority, parent,
+// estimate, labels, members and custom field values to the end of listID. The dates,
+// completion, sprint and cover image are not copied. The labels are those of the same names
+// on listID's board, created when missing, and values of other boards' fields are left out,
+// so a card that moved boards since still clones cleanly.
+func (s *CardService) CloneCard(id, listID int) (*Card, error) {
+	var boardID int
+	if err := s.DB.QueryRow("SELECT board_id FROM lists WHERE id = $1", listID).Scan(&boardID); err != nil {
+		return nil, err
+	}
+	var cloneID int
+	err := s.DB.QueryRow(`
+		INSERT INTO cards (list_id, title, description, badge, color, cover_color, priority, parent_card_id, story_points, position)
+		SELECT $2, title, description, badge, color, cover_color, priority, parent_card_id, story_points, COALESCE((SELECT MAX(position) + 1 FROM cards WHERE list_id = $2), 0)
+		FROM cards WHERE id = $1
+		RETURNING id
+	`, id, listID).Scan(&cloneID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.recordTransition(cloneID, nil, listID); err != nil {
+		return nil, err
+	}
+	tagService, labelService := &CardTagService{DB: s.DB}, &LabelService{DB: s.DB}
+	tags, err := tagService.GetTagsByCard(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		label, err := labelService.EnsureLabel(boardID, t.Name, t.Color)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, err := tagService.AddTag(cloneID, label.ID); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.DB.Exec("INSERT INTO card_members (card_id, user_id) SELECT $2, user_id FROM card_members WHERE card_id = $1", id, cloneID); err != nil {
+		return nil, err
+	}
+	_, err = s.DB.Exec(`
+		INSERT INTO card_field_values (card_id, field_id, value)
+		SELECT $2, v.field_id, v.value FROM card_field_values v JOIN custom_fields f ON f.id = v.field_id
+		WHERE v.card_id = $1 AND f.board_id = $3`, id, cloneID, boardID)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetCardByID(cloneID)
 }
@@ -1,7 +1,6 @@
 package models
 
 import (
-	"database/sql"
 	"time"
 )
 
@@ -14,7 +13,7 @@ type CardComment struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
-type CardCommentService struct{ DB *sql.DB }
+type CardCommentService struct{ DB DBTX }
 
 func (s *CardCommentService) GetCommentsByCard(cardID int) ([]CardComment, error) {
 	rows, err := s.DB.Query(
@@ -1,7 +1,6 @@
 package models
 
 import (
-	"database/sql"
 	"time"
 )
 
@@ -14,23 +13,33 @@ type CardMember struct {
 }
 
 type CardMemberService struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func (s *CardMemberService) AddMember(cardID, userID int) error {
-	_, err := s.DB.Exec(
+// AddMember reports whether a new assignment was created.
+func (s *CardMemberService) AddMember(cardID, userID int) (bool, error) {
+	res, err := s.DB.Exec(
 		"INSERT INTO card_members (card_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
 		cardID, userID,
 	)
-	return err
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
 }
 
-func (s *CardMemberService) RemoveMember(cardID, userID int) error {
-	_, err := s.DB.Exec(
+// RemoveMember reports whether an assignment was actually deleted.
+func (s *CardMemberService) RemoveMember(cardID, userID int) (bool, error) {
+	res, err := s.DB.Exec(
 		"DELETE FROM card_members WHERE card_id=$1 AND user_id=$2",
 		cardID, userID,
 	)
-	return err
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
 }
 
 func (s *CardMemberService) GetMembersByCard(cardID int) ([]CardMember, error) {
@@ -55,3 +64,66 @@ func (s *CardMemberService) GetMembersByCard(cardID int) ([]CardMember, error) {
 	}
 	return members, rows.Err()
 }
+
+// AssignedCard is a card a user is a member of, with the board and list it is on.
+type AssignedCard struct {
+	Card
+	BoardID    int    `json:"board_id"`
+	BoardTitle string `json:"board_title"`
+	ListTitle  string `json:"list_title"`
+}
+
+// AssignedCardFilter narrows CardsOfUser. DueFrom and DueBefore bound the due date, and
+// NoDueDate keeps only cards without one. Completed cards are left out unless
+// IncludeCompleted is set.
+type AssignedCardFilter struct {
+	DueFrom          *time.Time
+	DueBefore        *time.Time
+	NoDueDate        bool
+	IncludeCompleted bool
+}
+
+// CardsOfUser returns the cards the user is a member of on every board they can still open,
+// soonest due first and then in board, list and card order.
+func (s *CardMemberService) CardsOfUser(userID int, f AssignedCardFilter) ([]AssignedCard, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+cardColumns+`, board_id, board_title, list_title
+		FROM (
+		    SELECT c.*, l.board_id, b.title AS board_title, l.title AS list_title, l.position AS list_position
+		    FROM cards c
+		    JOIN card_members cm ON cm.card_id = c.id AND cm.user_id = $1
+		    JOIN lists l ON l.id = c.list_id
+		    JOIN boards b ON b.id = l.board_id
+		    WHERE b.user_id = $1 OR EXISTS (SELECT 1 FROM board_members m WHERE m.board_id = b.id AND m.user_id = $1)
+		) mine
+		WHERE ($2 OR NOT completed)
+		  AND ($3::timestamptz IS NULL OR due_date >= $3)
+		  AND ($4::timestamptz IS NULL OR due_date < $4)
+		  AND (NOT $5 OR due_date IS NULL)
+		ORDER BY due_date NULLS LAST, lower(board_title), board_id, list_position, position, id
+	`, userID, f.IncludeCompleted, f.DueFrom, f.DueBefore, f.NoDueDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AssignedCard
+	for rows.Next() {
+		var a AssignedCard
+		c, err := scanCard(scanFunc(func(dest ...interface{}) error {
+			return rows.Scan(append(dest, &a.BoardID, &a.BoardTitle, &a.ListTitle)...)
+		}))
+		if err != nil {
+			return nil, err
+		}
+		a.Card = *c
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// scanFunc adapts a function to the row interface of the scan helpers, so extra columns can
+// be read alongside theirs.
+type scanFunc func(dest ...interface{}) error
+
+func (f scanFunc) Scan(dest ...interface{}) error { return f(dest...) }
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RelationType is how a card relates to another. Only blocks, relates_to and duplicates are
+// stored; blocked_by and duplicated_by are the same links seen from the other card.
+type RelationType string
+
+const (
+	RelationBlocks       RelationType = "blocks"
+	RelationBlockedBy    RelationType = "blocked_by"
+	RelationRelatesTo    RelationType = "relates_to"
+	RelationDuplicates   RelationType = "duplicates"
+	RelationDuplicatedBy RelationType = "duplicated_by"
+)
+
+var RelationTypes = []RelationType{RelationBlocks, RelationBlockedBy, RelationRelatesTo, RelationDuplicates, RelationDuplicatedBy}
+
+func ValidRelationType(t RelationType) bool {
+	for _, v := range RelationTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// StoredRelation turns "card relates to other as t" into the stored link: inverse types swap
+// the cards and relates_to, being symmetric, always points from the lower id.
+func StoredRelation(t RelationType, cardID, otherID int) (RelationType, int, int) {
+	switch t {
+	case RelationBlockedBy:
+		return RelationBlocks, otherID, cardID
+	case RelationDuplicatedBy:
+		return RelationDuplicates, otherID, cardID
+	case RelationRelatesTo:
+		if otherID < cardID {
+			return t, otherID, cardID
+		}
+	}
+	return t, cardID, otherID
+}
+
+// RelationLink is a stored relation row.
+type RelationLink struct {
+	ID         int          `json:"id"`
+	FromCardID int          `json:"from_card_id"`
+	ToCardID   int          `json:"to_card_id"`
+	Type       RelationType `json:"type"`
+	CreatedBy  *int         `json:"created_by"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// CardRelation is a relation seen from one card: Type is from that card's point of view.
+type CardRelation struct {
+	ID        int          `json:"id"`
+	Type      RelationType `json:"type"`
+	Card      RelatedCard  `json:"card"`
+	CreatedBy *int         `json:"created_by"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// RelatedCard summarises the other card of a relation, or a child card. Resolved is true once
+// it is completed or sits in a list titled Done, which is when it stops blocking.
+type RelatedCard struct {
+	ID        int    `json:"id"`
+	Title     string `json:"title"`
+	ListID    int    `json:"list_id"`
+	ListTitle string `json:"list_title"`
+	BoardID   int    `json:"board_id"`
+	Resolved  bool   `json:"resolved"`
+}
+
+type CardRelationService struct{ DB DBTX }
+
+// LockRelations serialises relation changes for the rest of the enclosing transaction, so two
+// concurrent links cannot close a cycle that neither sees alone.
+func (s *CardRelationService) LockRelations() error {
+	_, err := s.DB.Exec("SELECT pg_advisory_xact_lock(hashtext('card_relations'))")
+	return err
+}
+
+// Reaches reports whether following links of type t from fromCardID leads to toCardID.
+func (s *CardRelationService) Reaches(fromCardID, toCardID int, t RelationType) (bool, error) {
+	var found bool
+	err := s.DB.QueryRow(`
+		WITH RECURSIVE reach(card_id) AS (
+		    SELECT to_card_id FROM card_relations WHERE from_card_id = $1 AND type = $3
+		    UNION
+		    SELECT r.to_card_id FROM card_relations r JOIN reach ON r.from_card_id = reach.card_id WHERE r.type = $3
+		)
+		SELECT EXISTS (SELECT 1 FROM reach WHERE card_id = $2)
+	`, fromCardID, toCardID, string(t)).Scan(&found)
+	return found, err
+}
+
+// AddRelation stores a link; added is false when the same link already exists.
+func (s *CardRelationService) AddRelation(fromCardID, toCardID int, t RelationType, createdBy int) (*RelationLink, bool, error) {
+	var id int
+	err := s.DB.QueryRow(`
+		INSERT INTO card_relations (from_card_id, to_card_id, type, created_by) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (from_card_id, to_card_id, type) DO NOTHING
+		RETURNING id
+	`, fromCardID, toCardID, string(t), createdBy).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	link, err := s.GetRelationByID(id)
+	return link, err == nil, err
+}
+
+func (s *CardRelationService) GetRelationByID(id int) (*RelationLink, error) {
+	var l RelationLink
+	var createdBy sql.NullInt64
+	err := s.DB.QueryRow("SELECT id, from_card_id, to_card_id, type, created_by, created_at FROM card_relations WHERE id = $1", id).
+		Scan(&l.ID, &l.FromCardID, &l.ToCardID, &l.Type, &createdBy, &l.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	l.CreatedBy = nullIntPtr(createdBy)
+	return &l, nil
+}
+
+// GetRelationsByCard lists every relation of the card, from the card's point of view.
+func (s *CardRelationService) GetRelationsByCard(cardID int) ([]CardRelation, error) {
+	rows, err := s.DB.Query(`
+		SELECT r.id,
+		       CASE WHEN r.from_card_id = $1 THEN r.type
+		            WHEN r.type = 'blocks' THEN 'blocked_by'
+		            WHEN r.type = 'duplicates' THEN 'duplicated_by'
+		            ELSE r.type END,
+		       c.id, c.title, c.list_id, l.title, l.board_id,
+		       c.completed OR LOWER(TRIM(l.title)) = 'done',
+		       r.created_by, r.created_at
+		FROM card_relations r
+		JOIN cards c ON c.id = CASE WHEN r.from_card_id = $1 THEN r.to_card_id ELSE r.from_card_id END
+		JOIN lists l ON l.id = c.list_id
+		WHERE r.from_card_id = $1 OR r.to_card_id = $1
+		ORDER BY r.id
+	`, cardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []CardRelation
+	for rows.Next() {
+		var rel CardRelation
+		var createdBy sql.NullInt64
+		c := &rel.Card
+		if err := rows.Scan(&rel.ID, &rel.Type, &c.ID, &c.Title, &c.ListID, &c.ListTitle, &c.BoardID, &c.Resolved, &createdBy, &rel.CreatedAt); err != nil {
+			return nil, err
+		}
+		rel.CreatedBy = nullIntPtr(createdBy)
+		out = append(out, rel)
+	}
+	return out, rows.Err()
+}
+
+// OpenBlockers returns the unresolved cards that block the card.
+func (s *CardRelationService) OpenBlockers(cardID int) ([]RelatedCard, error) {
+	rels, err := s.GetRelationsByCard(cardID)
+	if err != nil {
+		return nil, err
+	}
+	var out []RelatedCard
+	for _, r := range rels {
+		if r.Type == RelationBlockedBy && !r.Card.Resolved {
+			out = append(out, r.Card)
+		}
+	}
+	return out, nil
+}
+
+func (s *CardRelationService) DeleteRelation(id int) error {
+	_, err := s.DB.Exec("DELETE FROM card_relations WHERE id = $1", id)
+	return err
+}
@@ -1,7 +1,6 @@
 package models
 
-import "database/sql"
-
+// CardTag is a board label as attached to a card. ID is the label's id.
 type CardTag struct {
 	ID     int    `json:"id"`
 	CardID int    `json:"card_id"`
@@ -9,10 +8,15 @@ type CardTag struct {
 	Color  string `json:"color"`
 }
 
-type CardTagService struct{ DB *sql.DB }
+type CardTagService struct{ DB DBTX }
 
 func (s *CardTagService) GetTagsByCard(cardID int) ([]CardTag, error) {
-	rows, err := s.DB.Query("SELECT id, card_id, name, color FROM card_tags WHERE card_id=$1 ORDER BY id", cardID)
+	rows, err := s.DB.Query(`
+		SELECT bl.id, cl.card_id, bl.name, bl.color
+		FROM card_labels cl
+		JOIN board_labels bl ON bl.id = cl.label_id
+		WHERE cl.card_id=$1
+		ORDER BY cl.created_at, bl.id`, cardID)
 	if err != nil {
 		return nil, err
 	}
@@ -28,17 +32,28 @@ func (s *CardTagService) GetTagsByCard(cardID int) ([]CardTag, error) {
 	return out, rows.Err()
 }
 
-func (s *CardTagService) AddTag(cardID int, name, color string) (*CardTag, error) {
-	var id int
-	err := s.DB.QueryRow(
-		"INSERT INTO card_tags (card_id, name, color) VALUES ($1,$2,$3) ON CONFLICT (card_id, name) DO UPDATE SET color=$3 RETURNING id",
-		cardID, name, color,
-	).Scan(&id)
+// AddTag attaches the label to the card. added is false when the card already had it.
+func (s *CardTagService) AddTag(cardID, labelID int) (tag *CardTag, added bool, err error) {
+	res, err := s.DB.Exec("INSERT INTO card_labels (card_id, label_id) VALUES ($1,$2) ON CONFLICT DO NOTHING", cardID, labelID)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, err
 	}
+	tag, err = s.GetTag(cardID, labelID)
+	return tag, n > 0, err
+}
+
+// GetTag returns the label as attached to the card, or sql.ErrNoRows when it is not.
+func (s *CardTagService) GetTag(cardID, labelID int) (*CardTag, error) {
 	var t CardTag
-	err = s.DB.QueryRow("SELECT id, card_id, name, color FROM card_tags WHERE id=$1", id).
+	err := s.DB.QueryRow(`
+		SELECT bl.id, cl.card_id, bl.name, bl.color
+		FROM card_labels cl
+		JOIN board_labels bl ON bl.id = cl.label_id
+		WHERE cl.card_id=$1 AND cl.label_id=$2`, cardID, labelID).
 		Scan(&t.ID, &t.CardID, &t.Name, &t.Color)
 	if err != nil {
 		return nil, err
@@ -46,7 +61,7 @@ func (s *CardTagService) AddTag(cardID int, name, color string) (*CardTag, error
 	return &t, nil
 }
 
-func (s *CardTagService) RemoveTag(id int) error {
-	_, err := s.DB.Exec("DELETE FROM card_tags WHERE id=$1", id)
+func (s *CardTagService) RemoveTag(cardID, labelID int) error {
+	_, err := s.DB.Exec("DELETE FROM card_labels WHERE card_id=$1 AND label_id=$2", cardID, labelID)
 	return err
 }
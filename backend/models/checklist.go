@@ -0,0 +1,241 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Checklist struct {
+	ID        int             `json:"id"`
+	CardID    int             `json:"card_id"`
+	Title     string          `json:"title"`
+	Position  int             `json:"position"`
+	Items     []ChecklistItem `json:"items"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type ChecklistItem struct {
+	ID          int        `json:"id"`
+	ChecklistID int        `json:"checklist_id"`
+	Text        string     `json:"text"`
+	Done        bool       `json:"done"`
+	Position    int        `json:"position"`
+	AssigneeID  *int       `json:"assignee_id"`
+	DueDate     *time.Time `json:"due_date"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CompletedBy *int       `json:"completed_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// ChecklistProgress counts checklist items across all checklists of a card.
+type ChecklistProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+type ChecklistService struct {
+	DB DBTX
+}
+
+func (s *ChecklistService) CreateChecklist(cardID int, title string) (*Checklist, error) {
+	var id int
+	err := s.DB.QueryRow(`
+		INSERT INTO checklists (card_id, title, position)
+		VALUES ($1, $2, COALESCE((SELECT MAX(position) + 1 FROM checklists WHERE card_id = $1), 0))
+		RETURNING id
+	`, cardID, title).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetChecklistByID(id)
+}
+
+func (s *ChecklistService) GetChecklistByID(id int) (*Checklist, error) {
+	var c Checklist
+	err := s.DB.QueryRow("SELECT id, card_id, title, position, created_at FROM checklists WHERE id = $1", id).
+		Scan(&c.ID, &c.CardID, &c.Title, &c.Position, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.getItems("WHERE i.checklist_id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	c.Items = items
+	return &c, nil
+}
+
+// GetChecklistsByCard returns the card's checklists in order, each with its ordered items.
+func (s *ChecklistService) GetChecklistsByCard(cardID int) ([]Checklist, error) {
+	rows, err := s.DB.Query("SELECT id, card_id, title, position, created_at FROM checklists WHERE card_id = $1 ORDER BY position, id", cardID)
+	if err != nil {
+		return nil, err
+	}
+	var out []Checklist
+	index := map[int]int{}
+	for rows.Next() {
+		var c Checklist
+		if err := rows.Scan(&c.ID, &c.CardID, &c.Title, &c.Position, &c.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.Items = []ChecklistItem{}
+		index[c.ID] = len(out)
+		out = append(out, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	items, err := s.getItems("JOIN checklists c ON c.id = i.checklist_id WHERE c.card_id = $1", cardID)
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range items {
+		if i, ok := index[it.ChecklistID]; ok {
+			out[i].Items = append(out[i].Items, it)
+		}
+	}
+	return out, nil
+}
+
+// UpdateChecklist renames the checklist and moves it to position among the card's checklists.
+func (s *ChecklistService) UpdateChecklist(c *Checklist, title string, position int) (*Checklist, error) {
+	if position != c.Position {
+		if err := s.shift("checklists", "card_id", c.CardID, c.Position, position); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.DB.Exec("UPDATE checklists SET title = $2, position = $3 WHERE id = $1", c.ID, title, position); err != nil {
+		return nil, err
+	}
+	return s.GetChecklistByID(c.ID)
+}
+
+func (s *ChecklistService) DeleteChecklist(id int) error {
+	_, err := s.DB.Exec("DELETE FROM checklists WHERE id = $1", id)
+	return err
+}
+
+const checklistItemColumns = `i.id, i.checklist_id, i.text, i.done, i.position, i.assignee_id, i.due_date, i.completed_at, i.completed_by, i.created_at`
+
+func (s *ChecklistService) getItems(where string, args ...interface{}) ([]ChecklistItem, error) {
+	rows, err := s.DB.Query("SELECT "+checklistItemColumns+" FROM checklist_items i "+where+" ORDER BY i.position, i.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ChecklistItem{}
+	for rows.Next() {
+		it, err := scanChecklistItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *it)
+	}
+	return out, rows.Err()
+}
+
+func scanChecklistItem(row interface{ Scan(...interface{}) error }) (*ChecklistItem, error) {
+	var it ChecklistItem
+	var assignee, completedBy sql.NullInt64
+	var due, completedAt sql.NullTime
+	err := row.Scan(&it.ID, &it.ChecklistID, &it.Text, &it.Done, &it.Position, &assignee, &due, &completedAt, &completedBy, &it.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	it.AssigneeID = nullIntPtr(assignee)
+	it.CompletedBy = nullIntPtr(completedBy)
+	if due.Valid {
+		it.DueDate = &due.Time
+	}
+	if completedAt.Valid {
+		it.CompletedAt = &completedAt.Time
+	}
+	return &it, nil
+}
+
+func (s *ChecklistService) GetItemByID(id int) (*ChecklistItem, error) {
+	return scanChecklistItem(s.DB.QueryRow("SELECT "+checklistItemColumns+" FROM checklist_items i WHERE i.id = $1", id))
+}
+
+func (s *ChecklistService) AddItem(checklistID int, text string, assigneeID *int, dueDate *time.Time) (*ChecklistItem, error) {
+	var id int
+	err := s.DB.QueryRow(`
+		INSERT INTO checklist_items (checklist_id, text, assignee_id, due_date, position)
+		VALUES ($1, $2, $3, $4, COALESCE((SELECT MAX(position) + 1 FROM checklist_items WHERE checklist_id = $1), 0))
+		RETURNING id
+	`, checklistID, text, assigneeID, dueDate).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetItemByID(id)
+}
+
+// UpdateItem saves the item's fields. completedBy is recorded when the item flips to done and
+// cleared when it is unchecked.
+func (s *ChecklistService) UpdateItem(before *ChecklistItem, text string, done bool, position int, assigneeID *int, dueDate *time.Time, completedBy int) (*ChecklistItem, error) {
+	if position != before.Position {
+		if err := s.shift("checklist_items", "checklist_id", before.ChecklistID, before.Position, position); err != nil {
+			return nil, err
+		}
+	}
+	_, err := s.DB.Exec(`
+		UPDATE checklist_items SET text = $2, position = $3, assignee_id = $4, due_date = $5, done = $6,
+		  completed_at = CASE WHEN NOT $6 THEN NULL WHEN done THEN completed_at ELSE CURRENT_TIMESTAMP END,
+		  completed_by = CASE WHEN NOT $6 THEN NULL WHEN done THEN completed_by ELSE $7 END
+		WHERE id = $1
+	`, before.ID, text, position, assigneeID, dueDate, done, completedBy)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetItemByID(before.ID)
+}
+
+func (s *ChecklistService) DeleteItem(id int) error {
+	_, err := s.DB.Exec("DELETE FROM checklist_items WHERE id = $1", id)
+	return err
+}
+
+// shift makes room for a row moving from position from to position to among its siblings.
+func (s *ChecklistService) shift(table, parentColumn string, parentID, from, to int) error {
+	var query string
+	if to < from {
+		query = "UPDATE " + table + " SET position = position + 1 WHERE " + parentColumn + " = $1 AND position >= $2 AND position < $3"
+		_, err := s.DB.Exec(query, parentID, to, from)
+		return err
+	}
+	query = "UPDATE " + table + " SET position = position - 1 WHERE " + parentColumn + " = $1 AND position > $2 AND position <= $3"
+	_, err := s.DB.Exec(query, parentID, from, to)
+	return err
+}
+
+// ProgressByBoard returns checklist progress for every card of the board that has items.
+func (s *ChecklistService) ProgressByBoard(boardID int) (map[int]ChecklistProgress, error) {
+	rows, err := s.DB.Query(`
+		SELECT c.card_id, COUNT(*) FILTER (WHERE i.done), COUNT(*)
+		FROM checklist_items i
+		JOIN checklists c ON c.id = i.checklist_id
+		JOIN cards cd ON cd.id = c.card_id
+		JOIN lists l ON l.id = cd.list_id
+		WHERE l.board_id = $1
+		GROUP BY c.card_id
+	`, boardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int]ChecklistProgress{}
+	for rows.Next() {
+		var cardID int
+		var p ChecklistProgress
+		if err := rows.Scan(&cardID, &p.Done, &p.Total); err != nil {
+			return nil, err
+		}
+		out[cardID] = p
+	}
+	return out, rows.Err()
+}
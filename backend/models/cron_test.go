@@ -0,0 +1,169 @@
+package models
+
+import (
+	"testing"
+	"time"
+	// Tests must not depend on the zoneinfo of the machine running them.
+	_ "time/tzdata"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("loading %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-b * * * *",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q): expected an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	utc := time.UTC
+	ny := mustLocation(t, "America/New_York")
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", time.Date(2024, 5, 1, 10, 0, 30, 0, utc), time.Date(2024, 5, 1, 10, 1, 0, 0, utc)},
+		{"strictly after", "0 9 * * *", time.Date(2024, 5, 1, 9, 0, 0, 0, utc), time.Date(2024, 5, 2, 9, 0, 0, 0, utc)},
+		{"step", "*/15 * * * *", time.Date(2024, 5, 1, 10, 16, 0, 0, utc), time.Date(2024, 5, 1, 10, 30, 0, 0, utc)},
+		{"range with step", "0 8-18/2 * * *", time.Date(2024, 5, 1, 11, 0, 0, 0, utc), time.Date(2024, 5, 1, 12, 0, 0, 0, utc)},
+		{"value with step", "0 20/2 * * *", time.Date(2024, 5, 1, 21, 0, 0, 0, utc), time.Date(2024, 5, 1, 22, 0, 0, 0, utc)},
+		{"list", "0 9 1,15 * *", time.Date(2024, 5, 2, 0, 0, 0, 0, utc), time.Date(2024, 5, 15, 9, 0, 0, 0, utc)},
+		{"weekdays over a weekend", "0 9 * * 1-5", time.Date(2024, 5, 3, 10, 0, 0, 0, utc), time.Date(2024, 5, 6, 9, 0, 0, 0, utc)},
+		{"sunday as 7", "0 9 * * 7", time.Date(2024, 5, 1, 0, 0, 0, 0, utc), time.Date(2024, 5, 5, 9, 0, 0, 0, utc)},
+		{"day of month or weekday", "0 0 13 * 5", time.Date(2024, 9, 1, 0, 0, 0, 0, utc), time.Date(2024, 9, 6, 0, 0, 0, 0, utc)},
+		{"month", "0 0 1 7 *", time.Date(2024, 7, 1, 0, 0, 0, 0, utc), time.Date(2025, 7, 1, 0, 0, 0, 0, utc)},
+		{"year end", "0 0 * * *", time.Date(2024, 12, 31, 12, 0, 0, 0, utc), time.Date(2025, 1, 1, 0, 0, 0, 0, utc)},
+
+		{"31st skips short months", "0 0 31 * *", time.Date(2024, 1, 31, 0, 0, 0, 0, utc), time.Date(2024, 3, 31, 0, 0, 0, 0, utc)},
+		{"31st skips april", "0 0 31 * *", time.Date(2024, 3, 31, 0, 0, 0, 0, utc), time.Date(2024, 5, 31, 0, 0, 0, 0, utc)},
+		{"30th skips february", "0 12 30 * *", time.Date(2024, 1, 30, 12, 0, 0, 0, utc), time.Date(2024, 3, 30, 12, 0, 0, 0, utc)},
+		{"leap day", "0 0 29 2 *", time.Date(2023, 3, 1, 0, 0, 0, 0, utc), time.Date(2024, 2, 29, 0, 0, 0, 0, utc)},
+		{"month end to next month", "0 9 1 * *", time.Date(2024, 2, 29, 23, 59, 0, 0, utc), time.Date(2024, 3, 1, 9, 0, 0, 0, utc)},
+
+		{"local time", "0 9 * * *", time.Date(2024, 5, 1, 12, 0, 0, 0, utc).In(ny), time.Date(2024, 5, 1, 13, 0, 0, 0, utc)},
+		{"skipped time runs after the change", "30 2 * * *", time.Date(2024, 3, 9, 3, 0, 0, 0, ny), time.Date(2024, 3, 10, 7, 30, 0, 0, utc)},
+		{"day after the gap", "30 2 * * *", time.Date(2024, 3, 10, 7, 30, 0, 0, utc).In(ny), time.Date(2024, 3, 11, 6, 30, 0, 0, utc)},
+		{"hourly across the gap", "0 * * * *", time.Date(2024, 3, 10, 1, 30, 0, 0, ny), time.Date(2024, 3, 10, 7, 0, 0, 0, utc)},
+		{"hourly after the gap", "0 * * * *", time.Date(2024, 3, 10, 7, 0, 0, 0, utc).In(ny), time.Date(2024, 3, 10, 8, 0, 0, 0, utc)},
+		{"repeated time runs once", "30 1 * * *", time.Date(2024, 11, 3, 0, 0, 0, 0, ny), time.Date(2024, 11, 3, 5, 30, 0, 0, utc)},
+		{"repeated time not again", "30 1 * * *", time.Date(2024, 11, 3, 5, 30, 0, 0, utc).In(ny), time.Date(2024, 11, 4, 6, 30, 0, 0, utc)},
+		{"from the repeated hour", "30 1 * * *", time.Date(2024, 11, 3, 6, 0, 0, 0, utc).In(ny), time.Date(2024, 11, 4, 6, 30, 0, 0, utc)},
+		{"after the repeated hour", "0 9 * * *", time.Date(2024, 11, 3, 0, 0, 0, 0, ny), time.Date(2024, 11, 3, 14, 0, 0, 0, utc)},
+	}
+	for _, tt := range tests {
+		sched, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: parseCron(%q): %v", tt.name, tt.expr, err)
+		}
+		got, err := sched.next(tt.from)
+		if err != nil {
+			t.Errorf("%s: next(%s): %v", tt.name, tt.from, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: next(%s) = %s, want %s", tt.name, tt.from, got.UTC(), tt.want)
+		}
+		if got.Location() != tt.from.Location() {
+			t.Errorf("%s: next returned %s, want %s", tt.name, got.Location(), tt.from.Location())
+		}
+	}
+}
+
+func TestCronNeverFires(t *testing.T) {
+	for _, expr := range []string{"0 0 30 2 *", "0 0 31 4 *", "0 0 31 6,9,11 *"} {
+		sched, err := parseCron(expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", expr, err)
+		}
+		if got, err := sched.next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+			t.Errorf("next(%q) = %s, expected an error", expr, got)
+		}
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	from := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		rec  CardRecurrence
+		want time.Time
+	}{
+		{"daily", CardRecurrence{Frequency: RecurDaily, Time: "09:00", Timezone: "Europe/Paris"}, time.Date(2024, 5, 2, 7, 0, 0, 0, time.UTC)},
+		{"weekly", CardRecurrence{Frequency: RecurWeekly, Time: "08:30", Weekdays: []int{1, 3}, Timezone: "UTC"}, time.Date(2024, 5, 6, 8, 30, 0, 0, time.UTC)},
+		{"monthly", CardRecurrence{Frequency: RecurMonthly, Time: "00:00", MonthDay: 28, Timezone: "UTC"}, time.Date(2024, 5, 28, 0, 0, 0, 0, time.UTC)},
+		{"cron", CardRecurrence{Frequency: RecurCron, Cron: "0 0 L * *", Timezone: "UTC"}, time.Time{}},
+		{"cron in a timezone", CardRecurrence{Frequency: RecurCron, Cron: "0 0 1 * *", Timezone: "Asia/Tokyo"}, time.Date(2024, 5, 31, 15, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := tt.rec.Next(from)
+		if tt.want.IsZero() {
+			if err == nil {
+				t.Errorf("%s: Next = %s, expected an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Next: %v", tt.name, err)
+			continue
+		}
+		if !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("%s: Next = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// A schedule that can never fire again has no next run, which the recurrence worker
+// records by disabling the rule.
+func TestRecurrenceWithoutNextRun(t *testing.T) {
+	rec := CardRecurrence{Frequency: RecurCron, Cron: "0 0 30 2 *", Timezone: "UTC"}
+	if err := rec.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got, err := rec.Next(time.Now()); err == nil {
+		t.Errorf("Next = %s, expected an error", got)
+	}
+	if got, err := rec.Occurrences(time.Now(), 5); err == nil {
+		t.Errorf("Occurrences = %v, expected an error", got)
+	}
+}
+
+func TestRecurrenceValidate(t *testing.T) {
+	for _, rec := range []CardRecurrence{
+		{Frequency: RecurDaily, Time: "9am", Timezone: "UTC"},
+		{Frequency: RecurDaily, Time: "09:00", Timezone: "Mars/Olympus"},
+		{Frequency: RecurWeekly, Time: "09:00", Timezone: "UTC"},
+		{Frequency: RecurWeekly, Time: "09:00", Weekdays: []int{7}, Timezone: "UTC"},
+		{Frequency: RecurMonthly, Time: "09:00", MonthDay: 31, Timezone: "UTC"},
+		{Frequency: "yearly", Time: "09:00", Timezone: "UTC"},
+	} {
+		if err := rec.Validate(); err == nil {
+			t.Errorf("Validate(%+v): expected an error", rec)
+		}
+	}
+}
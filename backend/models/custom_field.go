@@ -0,0 +1,580 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type FieldType string
+
+const (
+	FieldText         FieldType = "text"
+	FieldNumber       FieldType = "number"
+	FieldDate         FieldType = "date"
+	FieldCheckbox     FieldType = "checkbox"
+	FieldSingleSelect FieldType = "single_select"
+	FieldMultiSelect  FieldType = "multi_select"
+)
+
+// FieldDateLayout is the format of date field values: a calendar day, with no time zone.
+const FieldDateLayout = "2006-01-02"
+
+const maxFieldTextLength = 1000
+
+// CustomField is a board-defined card field. Options lists the choices of select fields.
+type CustomField struct {
+	ID        int       `json:"id"`
+	BoardID   int       `json:"board_id"`
+	Name      string    `json:"name"`
+	Type      FieldType `json:"type"`
+	Options   []string  `json:"options"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CustomFieldValue is a card's value for one field, in the JSON form its type uses: a string
+// for text, date (YYYY-MM-DD) and single_select, a number, a boolean for checkbox and an array
+// of strings for multi_select.
+type CustomFieldValue struct {
+	FieldID int             `json:"field_id"`
+	Value   json.RawMessage `json:"value"`
+}
+
+// ErrFieldExists is returned when a board already has a field with the name, ignoring case.
+var ErrFieldExists = errors.New("a custom field with this name already exists on the board")
+
+func (t FieldType) valid() bool {
+	switch t {
+	case FieldText, FieldNumber, FieldDate, FieldCheckbox, FieldSingleSelect, FieldMultiSelect:
+		return true
+	}
+	return false
+}
+
+func (t FieldType) isSelect() bool {
+	return t == FieldSingleSelect || t == FieldMultiSelect
+}
+
+// Validate trims the name and options and checks them against the type.
+func (f *CustomField) Validate() error {
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" {
+		return errors.New("name is required")
+	}
+	if !f.Type.valid() {
+		return fmt.Errorf("unknown field type %q", f.Type)
+	}
+	if !f.Type.isSelect() {
+		if len(f.Options) > 0 {
+			return errors.New("options are only allowed on select fields")
+		}
+		f.Options = []string{}
+		return nil
+	}
+	seen := map[string]bool{}
+	var options []string
+	for _, o := range f.Options {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			return errors.New("options cannot be empty")
+		}
+		if seen[strings.ToLower(o)] {
+			return fmt.Errorf("duplicate option %q", o)
+		}
+		seen[strings.ToLower(o)] = true
+		options = append(options, o)
+	}
+	if len(options) == 0 {
+		return errors.New("select fields need at least one option")
+	}
+	f.Options = options
+	return nil
+}
+
+// option returns the field's spelling of an option, matched ignoring case.
+func (f *CustomField) option(s string) (string, bool) {
+	for _, o := range f.Options {
+		if strings.EqualFold(o, strings.TrimSpace(s)) {
+			return o, true
+		}
+	}
+	return "", false
+}
+
+// NormalizeValue checks a JSON value against the field's type and returns it in canonical
+// form. A JSON null, an empty string or an empty multi-select means no value and returns nil.
+func (f *CustomField) NormalizeValue(raw json.RawMessage) (json.RawMessage, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var v interface{}
+	switch f.Type {
+	case FieldText:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("expected a string")
+		}
+		if s = strings.TrimSpace(s); s == "" {
+			return nil, nil
+		}
+		if len([]rune(s)) > maxFieldTextLength {
+			return nil, fmt.Errorf("text is longer than %d characters", maxFieldTextLength)
+		}
+		v = s
+	case FieldNumber:
+		var n float64
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, errors.New("expected a number")
+		}
+		if math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, errors.New("expected a finite number")
+		}
+		v = n
+	case FieldDate:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("expected a date string")
+		}
+		if s = strings.TrimSpace(s); s == "" {
+			return nil, nil
+		}
+		d, err := time.Parse(FieldDateLayout, s)
+		if err != nil {
+			return nil, errors.New("dates must be YYYY-MM-DD")
+		}
+		v = d.Format(FieldDateLayout)
+	case FieldCheckbox:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return nil, errors.New("expected true or false")
+		}
+		v = b
+	case FieldSingleSelect:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("expected one of the options")
+		}
+		if strings.TrimSpace(s) == "" {
+			return nil, nil
+		}
+		o, ok := f.option(s)
+		if !ok {
+			return nil, fmt.Errorf("%q is not one of the options", s)
+		}
+		v = o
+	case FieldMultiSelect:
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, errors.New("expected an array of options")
+		}
+		chosen := map[string]bool{}
+		for _, s := range list {
+			o, ok := f.option(s)
+			if !ok {
+				return nil, fmt.Errorf("%q is not one of the options", s)
+			}
+			chosen[o] = true
+		}
+		if len(chosen) == 0 {
+			return nil, nil
+		}
+		// Keep the options' order so equal selections compare equal.
+		var ordered []string
+		for _, o := range f.Options {
+			if chosen[o] {
+				ordered = append(ordered, o)
+			}
+		}
+		v = ordered
+	}
+	return json.Marshal(v)
+}
+
+// FormatValue renders a stored value for activity details.
+func (f *CustomField) FormatValue(raw json.RawMessage) string {
+	var v interface{}
+	if len(raw) == 0 || json.Unmarshal(raw, &v) != nil || v == nil {
+		return ""
+	}
+	switch x := v.(type) {
+	case bool:
+		if x {
+			return "checked"
+		}
+		return "unchecked"
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, len(x))
+		for i, p := range x {
+			parts[i] = fmt.Sprint(p)
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(v)
+}
+
+// FieldFilter keeps cards whose value for FieldID matches. Op is one of "=", "!=", "<", "<=",
+// ">", ">=", "~" (text contains) and "has"; an empty Value with "=" matches cards without a
+// value.
+type FieldFilter struct {
+	Field *CustomField
+	Op    string
+	Value string
+}
+
+// ParseFieldFilter reads "value", "op value" ("<5", ">=2024-01-01", "!=Prod") or "" against
+// the field's type. Text fields match case-insensitive substrings; multi-select fields match
+// cards having the option.
+func ParseFieldFilter(f *CustomField, expr string) (*FieldFilter, error) {
+	expr = strings.TrimSpace(expr)
+	op := "="
+	for _, candidate := range []string{"<=", ">=", "!=", "<", ">", "="} {
+		if strings.HasPrefix(expr, candidate) {
+			op, expr = candidate, strings.TrimSpace(expr[len(candidate):])
+			break
+		}
+	}
+	filter := &FieldFilter{Field: f, Op: op, Value: expr}
+	if expr == "" {
+		if op != "=" && op != "!=" {
+			return nil, fmt.Errorf("%s needs a value", op)
+		}
+		return filter, nil
+	}
+	ordered := op == "<" || op == "<=" || op == ">" || op == ">="
+	switch f.Type {
+	case FieldText:
+		if ordered {
+			return nil, errors.New("text fields support = and != only")
+		}
+		filter.Op = map[string]string{"=": "~", "!=": "!~"}[op]
+	case FieldNumber:
+		n, err := strconv.ParseFloat(expr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", expr)
+		}
+		filter.Value = strconv.FormatFloat(n, 'f', -1, 64)
+	case FieldDate:
+		if _, err := time.Parse(FieldDateLayout, expr); err != nil {
+			return nil, errors.New("dates must be YYYY-MM-DD")
+		}
+	case FieldCheckbox:
+		b, err := strconv.ParseBool(expr)
+		if err != nil || ordered {
+			return nil, errors.New("checkbox fields take =true or =false")
+		}
+		filter.Value = strconv.FormatBool(b)
+	case FieldSingleSelect, FieldMultiSelect:
+		o, ok := f.option(expr)
+		if !ok || ordered {
+			return nil, fmt.Errorf("%q is not one of the options", expr)
+		}
+		filter.Value = o
+	}
+	return filter, nil
+}
+
+// Matches reports whether a card with the stored value raw (nil when unset) passes the filter.
+// Unset values never pass ordered comparisons.
+func (ff *FieldFilter) Matches(raw json.RawMessage) bool {
+	if ff.Value == "" {
+		return (raw == nil) == (ff.Op == "=")
+	}
+	if raw == nil {
+		// An unset checkbox counts as unchecked; otherwise only negations match.
+		if ff.Field.Type == FieldCheckbox {
+			return (ff.Value == "false") == (ff.Op == "=")
+		}
+		return ff.Op == "!=" || ff.Op == "!~"
+	}
+	var v interface{}
+	if json.Unmarshal(raw, &v) != nil {
+		return false
+	}
+	switch ff.Field.Type {
+	case FieldText:
+		contains := strings.Contains(strings.ToLower(fmt.Sprint(v)), strings.ToLower(ff.Value))
+		return contains == (ff.Op == "~")
+	case FieldMultiSelect:
+		has := false
+		if list, ok := v.([]interface{}); ok {
+			for _, o := range list {
+				if o == ff.Value {
+					has = true
+				}
+			}
+		}
+		return has == (ff.Op == "=")
+	case FieldNumber:
+		n, _ := v.(float64)
+		want, _ := strconv.ParseFloat(ff.Value, 64)
+		return compareOp(ff.Op, cmpFloat(n, want))
+	default:
+		// Dates compare correctly as YYYY-MM-DD strings.
+		return compareOp(ff.Op, strings.Compare(fmt.Sprint(v), ff.Value))
+	}
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareOp(op string, c int) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// CompareValues orders two stored values of the field; unset values sort last. Select fields
+// sort by option order, checkboxes unchecked first.
+func (f *CustomField) CompareValues(a, b json.RawMessage) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return 1
+		}
+		return -1
+	}
+	var va, vb interface{}
+	json.Unmarshal(a, &va)
+	json.Unmarshal(b, &vb)
+	switch f.Type {
+	case FieldNumber:
+		x, _ := va.(float64)
+		y, _ := vb.(float64)
+		return cmpFloat(x, y)
+	case FieldCheckbox:
+		x, _ := va.(bool)
+		y, _ := vb.(bool)
+		if x == y {
+			return 0
+		}
+		if !x {
+			return -1
+		}
+		return 1
+	case FieldSingleSelect, FieldMultiSelect:
+		return f.optionRank(va) - f.optionRank(vb)
+	case FieldText:
+		return strings.Compare(strings.ToLower(fmt.Sprint(va)), strings.ToLower(fmt.Sprint(vb)))
+	}
+	return strings.Compare(fmt.Sprint(va), fmt.Sprint(vb))
+}
+
+// optionRank is the index of a single-select value, or of a multi-select's first option.
+func (f *CustomField) optionRank(v interface{}) int {
+	if list, ok := v.([]interface{}); ok {
+		if len(list) == 0 {
+			return len(f.Options)
+		}
+		v = list[0]
+	}
+	for i, o := range f.Options {
+		if o == v {
+			return i
+		}
+	}
+	return len(f.Options)
+}
+
+type CustomFieldService struct{ DB DBTX }
+
+const customFieldColumns = `id, board_id, name, type, options, position, created_at`
+
+func scanCustomField(row interface{ Scan(...interface{}) error }) (*CustomField, error) {
+	var f CustomField
+	var options []string
+	if err := row.Scan(&f.ID, &f.BoardID, &f.Name, &f.Type, pq.Array(&options), &f.Position, &f.CreatedAt); err != nil {
+		return nil, err
+	}
+	f.Options = options
+	if f.Options == nil {
+		f.Options = []string{}
+	}
+	return &f, nil
+}
+
+func (s *CustomFieldService) CreateField(f *CustomField) (*CustomField, error) {
+	var id int
+	err := s.DB.QueryRow(`
+		INSERT INTO custom_fields (board_id, name, type, options, position)
+		VALUES ($1, $2, $3, $4, COALESCE((SELECT MAX(position) + 1 FROM custom_fields WHERE board_id = $1), 0))
+		ON CONFLICT (board_id, lower(name)) DO NOTHING
+		RETURNING id
+	`, f.BoardID, f.Name, f.Type, pq.Array(f.Options)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrFieldExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetFieldByID(id)
+}
+
+func (s *CustomFieldService) GetFieldByID(id int) (*CustomField, error) {
+	return scanCustomField(s.DB.QueryRow("SELECT "+customFieldColumns+" FROM custom_fields WHERE id = $1", id))
+}
+
+func (s *CustomFieldService) GetFieldsByBoard(boardID int) ([]CustomField, error) {
+	rows, err := s.DB.Query("SELECT "+customFieldColumns+" FROM custom_fields WHERE board_id = $1 ORDER BY position, id", boardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []CustomField
+	for rows.Next() {
+		f, err := scanCustomField(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *f)
+	}
+	return out, rows.Err()
+}
+
+// UpdateField saves the name and options. Values using options that were removed lose them,
+// and values left empty are deleted; it returns the ids of the cards whose value changed.
+func (s *CustomFieldService) UpdateField(f *CustomField) (*CustomField, []int, error) {
+	_, err := s.DB.Exec("UPDATE custom_fields SET name = $2, options = $3 WHERE id = $1", f.ID, f.Name, pq.Array(f.Options))
+	if isUniqueViolation(err) {
+		return nil, nil, ErrFieldExists
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var cardIDs []int
+	switch f.Type {
+	case FieldSingleSelect:
+		cardIDs, err = queryIDs(s.DB, "DELETE FROM card_field_values WHERE field_id = $1 AND NOT (value #>> '{}' = ANY($2)) RETURNING card_id", f.ID, pq.Array(f.Options))
+	case FieldMultiSelect:
+		cardIDs, err = queryIDs(s.DB, `
+			UPDATE card_field_values SET value = (
+				SELECT COALESCE(jsonb_agg(e), '[]'::jsonb) FROM jsonb_array_elements_text(value) e WHERE e = ANY($2)
+			) WHERE field_id = $1 AND EXISTS (SELECT 1 FROM jsonb_array_elements_text(value) e WHERE NOT e = ANY($2))
+			RETURNING card_id`, f.ID, pq.Array(f.Options))
+		if err == nil {
+			_, err = s.DB.Exec("DELETE FROM card_field_values WHERE field_id = $1 AND value = '[]'::jsonb", f.ID)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	updated, err := s.GetFieldByID(f.ID)
+	return updated, cardIDs, err
+}
+
+// DeleteField removes the field and every card's value for it.
+func (s *CustomFieldService) DeleteField(id int) error {
+	_, err := s.DB.Exec("DELETE FROM custom_fields WHERE id = $1", id)
+	return err
+}
+
+// SetValue stores a normalized value; nil deletes it.
+func (s *CustomFieldService) SetValue(cardID, fieldID int, value json.RawMessage) error {
+	if value == nil {
+		_, err := s.DB.Exec("DELETE FROM card_field_values WHERE card_id = $1 AND field_id = $2", cardID, fieldID)
+		return err
+	}
+	_, err := s.DB.Exec(`
+		INSERT INTO card_field_values (card_id, field_id, value) VALUES ($1, $2, $3)
+		ON CONFLICT (card_id, field_id) DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP
+	`, cardID, fieldID, string(value))
+	return err
+}
+
+func (s *CustomFieldService) GetValuesByCard(cardID int) ([]CustomFieldValue, error) {
+	values, err := s.getValues(`
+		SELECT v.card_id, v.field_id, v.value FROM card_field_values v
+		JOIN custom_fields f ON f.id = v.field_id
+		WHERE v.card_id = $1 ORDER BY f.position, f.id`, cardID)
+	if err != nil {
+		return nil, err
+	}
+	return values[cardID], nil
+}
+
+// ValuesByBoard returns the field values of every card of the board, by card id.
+func (s *CustomFieldService) ValuesByBoard(boardID int) (map[int][]CustomFieldValue, error) {
+	return s.getValues(`
+		SELECT v.card_id, v.field_id, v.value FROM card_field_values v
+		JOIN custom_fields f ON f.id = v.field_id
+		WHERE f.board_id = $1 ORDER BY f.position, f.id`, boardID)
+}
+
+func (s *CustomFieldService) getValues(query string, arg int) (map[int][]CustomFieldValue, error) {
+	rows, err := s.DB.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int][]CustomFieldValue{}
+	for rows.Next() {
+		var cardID int
+		var v CustomFieldValue
+		var value []byte
+		if err := rows.Scan(&cardID, &v.FieldID, &value); err != nil {
+			return nil, err
+		}
+		v.Value = json.RawMessage(value)
+		out[cardID] = append(out[cardID], v)
+	}
+	return out, rows.Err()
+}
+
+// DropValuesOffBoard deletes the card's values for fields of other boards, after a move.
+func (s *CustomFieldService) DropValuesOffBoard(cardID, boardID int) error {
+	_, err := s.DB.Exec(`
+		DELETE FROM card_field_values v USING custom_fields f
+		WHERE v.field_id = f.id AND v.card_id = $1 AND f.board_id <> $2`, cardID, boardID)
+	return err
+}
+
+// SortCards orders cards by their value for the field, keeping position order among equals.
+func SortCards(cards []Card, field *CustomField, values map[int]json.RawMessage, desc bool) {
+	sort.SliceStable(cards, func(i, j int) bool {
+		a, b := values[cards[i].ID], values[cards[j].ID]
+		if a == nil || b == nil {
+			// Unset values stay last in both directions.
+			return a != nil && b == nil
+		}
+		c := field.CompareValues(a, b)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var (
+	textField     = &CustomField{Type: FieldText}
+	numberField   = &CustomField{Type: FieldNumber}
+	dateField     = &CustomField{Type: FieldDate}
+	checkboxField = &CustomField{Type: FieldCheckbox}
+	singleField   = &CustomField{Type: FieldSingleSelect, Options: []string{"Low", "Medium", "High"}}
+	multiField    = &CustomField{Type: FieldMultiSelect, Options: []string{"Low", "Medium", "High"}}
+)
+
+func TestNormalizeValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		field *CustomField
+		raw   string
+		want  string // "" when the value is cleared
+	}{
+		{"null", textField, "null", ""},
+		{"empty", numberField, "", ""},
+		{"text trimmed", textField, `"  hi  "`, `"hi"`},
+		{"blank text", textField, `"   "`, ""},
+		{"number", numberField, "3.50", "3.5"},
+		{"negative number", numberField, "-2", "-2"},
+		{"date", dateField, `" 2024-02-03 "`, `"2024-02-03"`},
+		{"blank date", dateField, `""`, ""},
+		{"checked", checkboxField, "true", "true"},
+		{"unchecked", checkboxField, "false", "false"},
+		{"option case", singleField, `"high"`, `"High"`},
+		{"blank option", singleField, `""`, ""},
+		{"options in field order", multiField, `["high", "low", "HIGH"]`, `["Low","High"]`},
+		{"no options", multiField, `[]`, ""},
+	}
+	for _, tt := range tests {
+		got, err := tt.field.NormalizeValue(json.RawMessage(tt.raw))
+		if err != nil {
+			t.Errorf("%s: NormalizeValue(%s): %v", tt.name, tt.raw, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: NormalizeValue(%s) = %s, want %s", tt.name, tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeValueErrors(t *testing.T) {
+	tests := []struct {
+		field *CustomField
+		raw   string
+	}{
+		{textField, "5"},
+		{textField, `"` + strings.Repeat("a", maxFieldTextLength+1) + `"`},
+		{numberField, `"3"`},
+		{dateField, `"2024-02-30"`},
+		{dateField, `"03/02/2024"`},
+		{checkboxField, `"yes"`},
+		{singleField, `"Urgent"`},
+		{singleField, `["Low"]`},
+		{multiField, `"Low"`},
+		{multiField, `["Low", "Urgent"]`},
+	}
+	for _, tt := range tests {
+		if _, err := tt.field.NormalizeValue(json.RawMessage(tt.raw)); err == nil {
+			t.Errorf("%s NormalizeValue(%s): expected an error", tt.field.Type, tt.raw)
+		}
+	}
+}
+
+func TestParseFieldFilter(t *testing.T) {
+	tests := []struct {
+		field     *CustomField
+		expr      string
+		wantOp    string
+		wantValue string
+	}{
+		{textField, "bug", "~", "bug"},
+		{textField, "!= bug", "!~", "bug"},
+		{textField, "", "=", ""},
+		{textField, "!=", "!=", ""},
+		{numberField, "<5", "<", "5"},
+		{numberField, ">= 2.50", ">=", "2.5"},
+		{numberField, "=10", "=", "10"},
+		{dateField, ">=2024-01-01", ">=", "2024-01-01"},
+		{checkboxField, "true", "=", "true"},
+		{checkboxField, "!=1", "!=", "true"},
+		{singleField, "!=medium", "!=", "Medium"},
+		{multiField, "high", "=", "High"},
+	}
+	for _, tt := range tests {
+		ff, err := ParseFieldFilter(tt.field, tt.expr)
+		if err != nil {
+			t.Errorf("%s ParseFieldFilter(%q): %v", tt.field.Type, tt.expr, err)
+			continue
+		}
+		if ff.Op != tt.wantOp || ff.Value != tt.wantValue {
+			t.Errorf("%s ParseFieldFilter(%q) = %q %q, want %q %q", tt.field.Type, tt.expr, ff.Op, ff.Value, tt.wantOp, tt.wantValue)
+		}
+	}
+}
+
+func TestParseFieldFilterErrors(t *testing.T) {
+	tests := []struct {
+		field *CustomField
+		expr  string
+	}{
+		{numberField, "<"},
+		{textField, "<bug"},
+		{numberField, "five"},
+		{dateField, "2024-13-01"},
+		{checkboxField, "maybe"},
+		{checkboxField, ">true"},
+		{singleField, "Urgent"},
+		{multiField, "<=High"},
+	}
+	for _, tt := range tests {
+		if _, err := ParseFieldFilter(tt.field, tt.expr); err == nil {
+			t.Errorf("%s ParseFieldFilter(%q): expected an error", tt.field.Type, tt.expr)
+		}
+	}
+}
+
+func TestFieldFilterMatches(t *testing.T) {
+	tests := []struct {
+		field *CustomField
+		expr  string
+		raw   string // "" for a card without a value
+		want  bool
+	}{
+		{textField, "", "", true},
+		{textField, "", `"x"`, false},
+		{textField, "!=", `"x"`, true},
+		{textField, "!=", "", false},
+		{textField, "BUG", `"a bug report"`, true},
+		{textField, "bug", `"feature"`, false},
+		{textField, "bug", "", false},
+		{textField, "!=bug", "", true},
+		{textField, "!=bug", `"a bug"`, false},
+		{numberField, "<5", "3", true},
+		{numberField, "<5", "5", false},
+		{numberField, "<=5", "5", true},
+		{numberField, "=2.5", "2.5", true},
+		{numberField, "<5", "", false},
+		{numberField, "!=5", "", true},
+		{dateField, ">=2024-01-01", `"2024-01-01"`, true},
+		{dateField, ">2024-01-01", `"2023-12-31"`, false},
+		{checkboxField, "true", "true", true},
+		{checkboxField, "true", "false", false},
+		{checkboxField, "false", "", true},
+		{checkboxField, "true", "", false},
+		{checkboxField, "!=true", "", true},
+		{singleField, "high", `"High"`, true},
+		{singleField, "!=high", `"Low"`, true},
+		{multiField, "medium", `["Low","Medium"]`, true},
+		{multiField, "high", `["Low","Medium"]`, false},
+		{multiField, "!=high", `["Low","Medium"]`, true},
+	}
+	for _, tt := range tests {
+		ff, err := ParseFieldFilter(tt.field, tt.expr)
+		if err != nil {
+			t.Fatalf("%s ParseFieldFilter(%q): %v", tt.field.Type, tt.expr, err)
+		}
+		var raw json.RawMessage
+		if tt.raw != "" {
+			raw = json.RawMessage(tt.raw)
+		}
+		if got := ff.Matches(raw); got != tt.want {
+			t.Errorf("%s %q Matches(%s) = %v, want %v", tt.field.Type, tt.expr, tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestSortCards(t *testing.T) {
+	tests := []struct {
+		name   string
+		field  *CustomField
+		values map[int]string
+		desc   bool
+		want   []int
+	}{
+		{"numbers, equals keep position", numberField, map[int]string{1: "5", 3: "2", 4: "5"}, false, []int{3, 1, 4, 2}},
+		{"numbers descending, unset last", numberField, map[int]string{1: "5", 3: "2", 4: "5"}, true, []int{1, 4, 3, 2}},
+		{"text ignores case", textField, map[int]string{1: `"beta"`, 2: `"Alpha"`, 3: `"gamma"`, 4: `"alpha"`}, false, []int{2, 4, 1, 3}},
+		{"dates", dateField, map[int]string{1: `"2024-03-01"`, 2: `"2023-12-31"`, 4: `"2024-01-15"`}, false, []int{2, 4, 1, 3}},
+		{"option order", singleField, map[int]string{1: `"High"`, 2: `"Low"`, 4: `"Medium"`}, false, []int{2, 4, 1, 3}},
+		{"option order descending", singleField, map[int]string{1: `"High"`, 2: `"Low"`, 4: `"Medium"`}, true, []int{1, 4, 2, 3}},
+		{"multi-select by first option", multiField, map[int]string{1: `["Medium","High"]`, 2: `["High"]`, 3: `["Low"]`}, false, []int{3, 1, 2, 4}},
+		{"unchecked first", checkboxField, map[int]string{1: "true", 2: "false", 3: "true"}, false, []int{2, 1, 3, 4}},
+	}
+	for _, tt := range tests {
+		cards := []Card{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}
+		values := map[int]json.RawMessage{}
+		for id, v := range tt.values {
+			values[id] = json.RawMessage(v)
+		}
+		SortCards(cards, tt.field, values, tt.desc)
+		var got []int
+		for _, c := range cards {
+			got = append(got, c.ID)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: SortCards = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -11,6 +11,26 @@ import (
 
 var DB *sql.DB
 
+// DBTX is satisfied by both *sql.DB and *sql.Tx so services can run inside a transaction.
+type DBTX interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// WithTx runs fn inside a transaction, committing on success and rolling back on error.
+func WithTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 func InitDB() (*sql.DB, error) {
 	host := getEnv("DB_HOST", "postgres")
 	port := getEnv("DB_PORT", "5432")
@@ -99,22 +119,34 @@ func InitDB() (*sql.DB, error) {
 
     _, _ = db.Exec(`ALTER TABLE cards ADD COLUMN IF NOT EXISTS description TEXT DEFAULT ''`)
 
-    createCardTagsTableSQL := `
-    CREATE TABLE IF NOT EXISTS card_tags (
+    createLabelsTableSQL := `
+    CREATE TABLE IF NOT EXISTS board_labels (
         id SERIAL PRIMARY KEY,
-        card_id INTEGER NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+        board_id INTEGER NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
         name TEXT NOT NULL,
         color TEXT NOT NULL DEFAULT 'primary',
-        UNIQUE(card_id, name)
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_board_labels_board_name ON board_labels(board_id, lower(name));
+
+    CREATE TABLE IF NOT EXISTS card_labels (
+        card_id INTEGER NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+        label_id INTEGER NOT NULL REFERENCES board_labels(id) ON DELETE CASCADE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (card_id, label_id)
     );
-    CREATE INDEX IF NOT EXISTS idx_card_tags_card_id ON card_tags(card_id);
+    CREATE INDEX IF NOT EXISTS idx_card_labels_label_id ON card_labels(label_id);
     `
 
-    _, err = db.Exec(createCardTagsTableSQL)
+    _, err = db.Exec(createLabelsTableSQL)
     if err != nil {
         return nil, err
     }
 
+    if err := foldCardTags(db); err != nil {
+        return nil, err
+    }
+
     createCardCommentsTableSQL := `
     CREATE TABLE IF NOT EXISTS card_comments (
         id SERIAL PRIMARY KEY,
@@ -182,11 +214,483 @@ func InitDB() (*sql.DB, error) {
         return nil, err
     }
 
+    _, _ = db.Exec(`ALTER TABLE activities ADD COLUMN IF NOT EXISTS board_id INTEGER REFERENCES boards(id) ON DELETE CASCADE`)
+    _, _ = db.Exec(`ALTER TABLE activities ADD COLUMN IF NOT EXISTS payload JSONB`)
+    _, _ = db.Exec(`CREATE INDEX IF NOT EXISTS idx_activities_board_id ON activities(board_id)`)
+
+    createNotificationsTableSQL := `
+    CREATE TABLE IF NOT EXISTS notifications (
+        id SERIAL PRIMARY KEY,
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+        type TEXT NOT NULL,
+        board_id INTEGER REFERENCES boards(id) ON DELETE CASCADE,
+        card_id INTEGER REFERENCES cards(id) ON DELETE CASCADE,
+        message TEXT NOT NULL,
+        read_at TIMESTAMPTZ,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, read_at);
+    `
+    _, err = db.Exec(createNotificationsTableSQL)
+    if err != nil {
+        return nil, err
+    }
+
+    createNotificationPreferencesTableSQL := `
+    CREATE TABLE IF NOT EXISTS notification_preferences (
+        user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+        email_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+        card_assigned BOOLEAN NOT NULL DEFAULT TRUE,
+        board_invite BOOLEAN NOT NULL DEFAULT TRUE,
+        card_comment BOOLEAN NOT NULL DEFAULT TRUE,
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+    _, err = db.Exec(createNotificationPreferencesTableSQL)
+    if err != nil {
+        return nil, err
+    }
+
+    _, _ = db.Exec(`ALTER TABLE notifications ADD COLUMN IF NOT EXISTS emailed_at TIMESTAMPTZ`)
+    _, _ = db.Exec(`ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS digest_frequency TEXT NOT NULL DEFAULT 'daily'`)
+    _, _ = db.Exec(`ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS last_digest_at TIMESTAMPTZ`)
+    _, _ = db.Exec(`ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS unsubscribe_token TEXT UNIQUE`)
+    _, _ = db.Exec(`ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS due_reminder BOOLEAN NOT NULL DEFAULT TRUE`)
+
+    createDueRemindersTableSQL := `
+    CREATE TABLE IF NOT EXISTS due_reminders (
+        id SERIAL PRIMARY KEY,
+        card_id INTEGER NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+        offset_minutes INTEGER NOT NULL,
+        due_date TIMESTAMPTZ NOT NULL,
+        sent_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE(card_id, offset_minutes, due_date)
+    );
+    CREATE INDEX IF NOT EXISTS idx_cards_due_date ON cards(due_date) WHERE due_date IS NOT NULL;
+    `
+    _, err = db.Exec(createDueRemindersTableSQL)
+    if err != nil {
+        return nil, err
+    }
+
+    createWebhooksTableSQL := `
+    CREATE TABLE IF NOT EXISTS webhooks (
+        id SERIAL PRIMARY KEY,
+        board_id INTEGER NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+        url TEXT NOT NULL,
+        secret TEXT NOT NULL,
+        events TEXT[] NOT NULL DEFAULT '{}',
+        active BOOLEAN NOT NULL DEFAULT TRUE,
+        created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_webhooks_board_id ON webhooks(board_id);
+
+    CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        id SERIAL PRIMARY KEY,
+        webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+        activity_id INTEGER REFERENCES activities(id) ON DELETE SET NULL,
+        event TEXT NOT NULL,
+        payload JSONB NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+        locked_until TIMESTAMPTZ,
+        last_status_code INTEGER,
+        last_error TEXT,
+        delivered_at TIMESTAMPTZ,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id);
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+    `
+    _, err = db.Exec(createWebhooksTableSQL)
+    if err != nil {
+        return nil, err
+    }
+    // Response bodies may echo internal data, so they are no longer stored.
+    _, _ = db.Exec(`ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS last_response`)
+
+    createAutomationTablesSQL := `
+    CREATE TABLE IF NOT EXISTS automation_rules (
+        id SERIAL PRIMARY KEY,
+        board_id INTEGER NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+        name TEXT NOT NULL,
+        trigger_type TEXT NOT NULL,
+        trigger JSONB NOT NULL,
+        conditions JSONB NOT NULL DEFAULT '[]',
+        actions JSONB NOT NULL,
+        enabled BOOLEAN NOT NULL DEFAULT TRUE,
+        created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_automation_rules_board_trigger ON automation_rules(board_id, trigger_type);
+
+    CREATE TABLE IF NOT EXISTS automation_runs (
+        id SERIAL PRIMARY KEY,
+        rule_id INTEGER REFERENCES automation_rules(id) ON DELETE SET NULL,
+        rule_name TEXT NOT NULL,
+        board_id INTEGER NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+        card_id INTEGER REFERENCES cards(id) ON DELETE SET NULL,
+        trigger_type TEXT NOT NULL,
+        status TEXT NOT NULL,
+        depth INTEGER NOT NULL DEFAULT 0,
+        actions JSONB NOT NULL DEFAULT '[]',
+        error TEXT,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_automation_runs_board_id ON automation_runs(board_id, id DESC);
+
+    CREATE TABLE IF NOT EXISTS automation_due_triggers (
+        id SERIAL PRIMARY KEY,
+        card_id INTEGER NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+        due_date TIMESTAMPTZ NOT NULL,
+        fired_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE(card_id, due_date)
+    );
+    `
+    _, err = db.Exec(createAutomationTablesSQL)
+    if err != nil {
+        return nil, err
+    }
+
+    createRecurrencesTableSQL := `
+    CREATE TABLE IF NOT EXISTS card_recurrences (
+        id SERIAL PRIMARY KEY,
+        card_id INTEGER NOT NULL UNIQUE REFERENCES cards(id) ON DELETE CASCADE,
+        target_list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+        frequency TEXT NOT NULL,
+        time_of_day TEXT NOT NULL DEFAULT '09:00',
+        weekdays INTEGER[] NOT NULL DEFAULT '{}',
+        month_day INTEGER NOT NULL DEFAULT 0,
+        cron TEXT NOT NULL DEFAULT '',
+        timezone TEXT NOT NULL DEFAULT 'UTC',
+        enabled BOOLEAN NOT NULL DEFAULT TRUE,
+        next_run_at TIMESTAMPTZ,
+        last_run_at TIMESTAMPTZ,
+        last_card_id INTEGER REFERENCES cards(id) ON DELETE SET NULL,
+        created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_card_recurrences_next_run ON card_recurrences(next_run_at) WHERE enabled;
+    `
+    _, err = db.Exec(createRecurrencesTableSQL)
+    if err != nil {
+        return nil, err
+    }
+
+    createChecklistsTableSQL := `
+    CREATE TABLE IF NOT EXISTS checklists (
+        id SERIAL PRIMARY KEY,
+        card_id INTEGER NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+        title TEXT NOT NULL,
+        position INTEGER NOT NULL DEFAULT 0,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_checklists_card_id ON checklists(card_id);
+
+    CREATE TABLE IF NOT EXISTS checklist_items (
+        id SERIAL PRIMARY KEY,
+        checklist_id INTEGER NOT NULL REFERENCES checklists(id) ON DELETE CASCADE,
+        text TEXT NOT NULL,
+        done BOOLEAN NOT NULL DEFAULT FALSE,
+        position INTEGER NOT NULL DEFAULT 0,
+        assignee_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+        due_date TIMESTAMPTZ,
+        completed_at TIMESTAMPTZ,
+        completed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_checklist_items_checklist_id ON checklist_items(checklist_id);
+    `
+    _, err = db.Exec(createChecklistsTableSQL)
+    if err != nil {
+        return nil, err
+    }
+
+    createAttachmentsTableSQL := `
+    CREATE TABLE IF NOT EXISTS attachments (
+        id SERIAL PRIMARY KEY,
+        card_id INTEGER NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+        uploader_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+        filename TEXT NOT NULL,
+        mime_type TEXT NOT NULL,
+        size_bytes BIGINT NOT NULL,
+        content_hash TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_attachments_card_id ON attachments(card_id);
+    CREATE INDEX IF NOT EXISTS idx_attachments_content_hash ON attachments(content_hash);
+    `
+    _, err = db.Exec(createAttachmentsTableSQL)
+    if err != nil {
+        return nil, err
+    }
+
+    _, _ = db.Exec(`ALTER TABLE cards ADD COLUMN IF NOT EXISTS cover_attachment_id INTEGER REFERENCES attachments(id) ON DELETE SET NULL`)
+    _, _ = db.Exec(`ALTER TABLE cards ADD COLUMN IF NOT EXISTS cover_color TEXT NOT NULL DEFAULT ''`)
+    _, _ = db.Exec(`ALTER TABLE cards ADD COLUMN IF NOT EXISTS priority TEXT NOT NULL DEFAULT 'none'`)
+    _, _ = db.Exec(`ALTER TABLE cards ADD COLUMN IF NOT EXISTS start_date TIMESTAMPTZ`)
+    _, _ = db.Exec(`ALTER TABLE cards ADD COLUMN IF NOT EXISTS completed BOOLEAN NOT NULL DEFAULT false`)
+    _, _ = db.Exec(`ALTER TABLE cards ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ`)
+    _, _ = db.Exec(`ALTER TABLE cards ADD COLUMN IF NOT EXISTS parent_card_id INTEGER REFERENCES cards(id) ON DELETE SET NULL`)
+    _, _ = db.Exec(`CREATE INDEX IF NOT EXISTS idx_cards_parent_card_id ON cards(parent_card_id) WHERE parent_card_id IS NOT NULL`)
+
+    createCustomFieldsTableSQL := `
+    CREATE TABLE IF NOT EXISTS custom_fields (
+        id SERIAL PRIMARY KEY,
+        board_id INTEGER NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+        name TEXT NOT NULL,
+        type TEXT NOT NULL,
+        options TEXT[] NOT NULL DEFAULT '{}',
+        position INTEGER NOT NULL DEFAULT 0,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_custom_fields_board_name ON custom_fields(board_id, lower(name));
+
+    CREATE TABLE IF NOT EXISTS card_field_values (
+        card_id INTEGER NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+        field_id INTEGER NOT NULL REFERENCES custom_fields(id) ON DELETE CASCADE,
+        value JSONB NOT NULL,
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (card_id, field_id)
+    );
+    CREATE INDEX IF NOT EXISTS idx_card_field_values_field_id ON card_field_values(field_id);
+    `
+    _, err = db.Exec(createCustomFieldsTableSQL)
+    if err != nil {
+        return nil, err
+    }
+
+    createCardRelationsTableSQL := `
+    CREATE TABLE IF NOT EXISTS card_relations (
+        id SERIAL PRIMARY KEY,
+        from_card_id INTEGER NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+        to_card_id INTEGER NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+        type TEXT NOT NULL CHECK (type IN ('blocks', 'relates_to', 'duplicates')),
+        created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE(from_card_id, to_card_id, type),
+        CHECK (from_card_id <> to_card_id)
+    );
+    CREATE INDEX IF NOT EXISTS idx_card_relations_to_card_id ON card_relations(to_card_id);
+    `
+    _, err = db.Exec(createCardRelationsTableSQL)
+    if err != nil {
+        return nil, err
+    }
+
+    // Full-text search: generated tsvector columns stay in sync with the text they index.
+    // The configuration must match SearchConfig.
+    _, _ = db.Exec(`ALTER TABLE cards ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', COALESCE(title, '')), 'A') || setweight(to_tsvector('simple', COALESCE(description, '')), 'B')
+    ) STORED`)
+    _, _ = db.Exec(`ALTER TABLE card_comments ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED`)
+    _, _ = db.Exec(`ALTER TABLE board_labels ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', name)) STORED`)
+    createSearchIndexesSQL := `
+    CREATE INDEX IF NOT EXISTS idx_cards_search ON cards USING GIN (search_vector);
+    CREATE INDEX IF NOT EXISTS idx_card_comments_search ON card_comments USING GIN (search_vector);
+    CREATE INDEX IF NOT EXISTS idx_board_labels_search ON board_labels USING GIN (search_vector);
+    `
+    _, err = db.Exec(createSearchIndexesSQL)
+    if err != nil {
+        return nil, err
+    }
+
+    createSavedFiltersTableSQL := `
+    CREATE TABLE IF NOT EXISTS saved_filters (
+        id SERIAL PRIMARY KEY,
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        board_id INTEGER NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+        name TEXT NOT NULL,
+        query TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_saved_filters_user_board_name ON saved_filters(user_id, board_id, lower(name));
+    `
+    _, err = db.Exec(createSavedFiltersTableSQL)
+    if err != nil {
+        return nil, err
+    }
+
+    createCardTransitionsTableSQL := `
+    CREATE TABLE IF NOT EXISTS card_transitions (
+        id SERIAL PRIMARY KEY,
+        card_id INTEGER NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+        board_id INTEGER NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+        from_list_id INTEGER REFERENCES lists(id) ON DELETE SET NULL,
+        to_list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+        moved_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_card_transitions_card_id ON card_transitions(card_id, moved_at);
+    CREATE INDEX IF NOT EXISTS idx_card_transitions_board_id ON card_transitions(board_id, moved_at);
+    `
+    _, err = db.Exec(createCardTransitionsTableSQL)
+    if err != nil {
+        return nil, err
+    }
+    if err := backfillCardTransitions(db); err != nil {
+        return nil, err
+    }
+
+    createSprintsTableSQL := `
+    CREATE TABLE IF NOT EXISTS sprints (
+        id SERIAL PRIMARY KEY,
+        board_id INTEGER NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+        name TEXT NOT NULL,
+        goal TEXT NOT NULL DEFAULT '',
+        start_date DATE NOT NULL,
+        end_date DATE NOT NULL,
+        state TEXT NOT NULL DEFAULT 'planned' CHECK (state IN ('planned', 'active', 'closed')),
+        closed_at TIMESTAMPTZ,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        CHECK (end_date >= start_date)
+    );
+    CREATE INDEX IF NOT EXISTS idx_sprints_board_id ON sprints(board_id, start_date);
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_sprints_one_active ON sprints(board_id) WHERE state = 'active';
+    `
+    _, err = db.Exec(createSprintsTableSQL)
+    if err != nil {
+        return nil, err
+    }
+    _, _ = db.Exec("ALTER TABLE cards ADD COLUMN IF NOT EXISTS sprint_id INTEGER REFERENCES sprints(id) ON DELETE SET NULL")
+    _, _ = db.Exec("ALTER TABLE cards ADD COLUMN IF NOT EXISTS story_points NUMERIC(6,1) CHECK (story_points >= 0)")
+    _, _ = db.Exec("CREATE INDEX IF NOT EXISTS idx_cards_sprint_id ON cards(sprint_id) WHERE sprint_id IS NOT NULL")
+
+    createSprintCarryoversTableSQL := `
+    CREATE TABLE IF NOT EXISTS sprint_carryovers (
+        sprint_id INTEGER NOT NULL REFERENCES sprints(id) ON DELETE CASCADE,
+        card_id INTEGER NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+        story_points NUMERIC(6,1),
+        PRIMARY KEY (sprint_id, card_id)
+    );
+    `
+    _, err = db.Exec(createSprintCarryoversTableSQL)
+    if err != nil {
+        return nil, err
+    }
+    _, _ = db.Exec("ALTER TABLE lists ADD COLUMN IF NOT EXISTS wip_limit INTEGER CHECK (wip_limit > 0)")
+    _, _ = db.Exec("ALTER TABLE boards ADD COLUMN IF NOT EXISTS wip_policy TEXT NOT NULL DEFAULT 'block' CHECK (wip_policy IN ('block', 'warn'))")
+
+    createTimeEntriesTableSQL := `
+    CREATE TABLE IF NOT EXISTS time_entries (
+        id SERIAL PRIMARY KEY,
+        card_id INTEGER NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        started_at TIMESTAMPTZ NOT NULL,
+        ended_at TIMESTAMPTZ,
+        note TEXT NOT NULL DEFAULT '',
+        manual BOOLEAN NOT NULL DEFAULT FALSE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        CHECK (ended_at IS NULL OR ended_at >= started_at)
+    );
+    CREATE INDEX IF NOT EXISTS idx_time_entries_card_id ON time_entries(card_id, started_at);
+    CREATE INDEX IF NOT EXISTS idx_time_entries_user_id ON time_entries(user_id, started_at);
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_time_entries_running ON time_entries(user_id) WHERE ended_at IS NULL;
+    `
+    _, err = db.Exec(createTimeEntriesTableSQL)
+    if err != nil {
+        return nil, err
+    }
+
+    createBoardTemplatesTableSQL := `
+    CREATE TABLE IF NOT EXISTS board_templates (
+        id SERIAL PRIMARY KEY,
+        user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+        builtin_key TEXT UNIQUE,
+        name TEXT NOT NULL,
+        description TEXT NOT NULL DEFAULT '',
+        content JSONB NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        CHECK ((user_id IS NULL) <> (builtin_key IS NULL))
+    );
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_board_templates_user_name ON board_templates(user_id, lower(name));
+    `
+    _, err = db.Exec(createBoardTemplatesTableSQL)
+    if err != nil {
+        return nil, err
+    }
+    if err := seedBoardTemplates(db); err != nil {
+        return nil, err
+    }
+
 	DB = db
 	log.Println("Database initialized successfully")
 	return db, nil
 }
 
+// backfillCardTransitions rebuilds the list history of cards that have none, which are the
+// cards created before transitions were recorded: the card entered its first list when it was
+// created, then followed its move_card activities. Moves to lists since deleted are lost.
+func backfillCardTransitions(db *sql.DB) error {
+	_, err := db.Exec(`
+		WITH untracked AS (
+		    SELECT c.id, c.list_id, c.created_at FROM cards c
+		    WHERE NOT EXISTS (SELECT 1 FROM card_transitions t WHERE t.card_id = c.id)
+		),
+		moves AS (
+		    SELECT a.id, a.card_id, (a.payload->'before'->>'list_id')::int AS from_list_id,
+		           (a.payload->'after'->>'list_id')::int AS to_list_id, a.created_at
+		    FROM activities a JOIN untracked u ON u.id = a.card_id
+		    WHERE a.action_type = 'move_card' AND a.payload->'after'->>'list_id' IS NOT NULL
+		),
+		history AS (
+		    SELECT u.id AS card_id, NULL::int AS from_list_id,
+		           COALESCE((SELECT m.from_list_id FROM moves m WHERE m.card_id = u.id ORDER BY m.created_at, m.id LIMIT 1), u.list_id) AS to_list_id,
+		           u.created_at AS moved_at
+		    FROM untracked u
+		    UNION ALL
+		    SELECT card_id, from_list_id, to_list_id, created_at FROM moves
+		)
+		INSERT INTO card_transitions (card_id, board_id, from_list_id, to_list_id, moved_at)
+		SELECT h.card_id, l.board_id, fl.id, l.id, h.moved_at
+		FROM history h
+		JOIN lists l ON l.id = h.to_list_id
+		LEFT JOIN lists fl ON fl.id = h.from_list_id
+	`)
+	return err
+}
+
+// foldCardTags moves the per-card tags of older databases into the board label catalog.
+// Tags whose names only differ in case become one label, which takes the color of the oldest
+// tag. The card_tags table is dropped afterwards, so this runs once.
+func foldCardTags(db *sql.DB) error {
+	var exists bool
+	if err := db.QueryRow("SELECT to_regclass('card_tags') IS NOT NULL").Scan(&exists); err != nil || !exists {
+		return err
+	}
+	return WithTx(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO board_labels (board_id, name, color)
+			SELECT DISTINCT ON (l.board_id, lower(t.name)) l.board_id, t.name, t.color
+			FROM card_tags t
+			JOIN cards c ON c.id = t.card_id
+			JOIN lists l ON l.id = c.list_id
+			ORDER BY l.board_id, lower(t.name), t.id
+			ON CONFLICT (board_id, lower(name)) DO NOTHING
+		`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO card_labels (card_id, label_id)
+			SELECT t.card_id, bl.id
+			FROM card_tags t
+			JOIN cards c ON c.id = t.card_id
+			JOIN lists l ON l.id = c.list_id
+			JOIN board_labels bl ON bl.board_id = l.board_id AND lower(bl.name) = lower(t.name)
+			ON CONFLICT DO NOTHING
+		`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DROP TABLE card_tags")
+		return err
+	})
+}
+
 func getEnv(key, fallback string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// DueReminder is a card claimed for a reminder at a given offset before its due date.
+// OffsetMinutes is 0 for the overdue reminder.
+type DueReminder struct {
+	CardID        int
+	CardTitle     string
+	BoardID       int
+	DueDate       time.Time
+	OffsetMinutes int
+}
+
+type DueReminderService struct {
+	DB DBTX
+}
+
+// ClaimWindow locks open cards due in (from, to] that have not had the reminder for this offset
+// and due date yet, and records the reminder as sent. It must run inside a transaction;
+// rows locked by another replica are skipped so every reminder is claimed exactly once.
+func (s *DueReminderService) ClaimWindow(offsetMinutes int, from, to time.Time, limit int) ([]DueReminder, error) {
+	rows, err := s.DB.Query(`
+		SELECT c.id, c.title, l.board_id, c.due_date
+		FROM cards c
+		JOIN lists l ON l.id = c.list_id
+		WHERE c.due_date > $1 AND c.due_date <= $2
+		  AND NOT c.completed AND LOWER(TRIM(l.title)) <> 'done'
+		  AND NOT EXISTS (
+		    SELECT 1 FROM due_reminders r
+		    WHERE r.card_id = c.id AND r.offset_minutes = $3 AND r.due_date = c.due_date
+		  )
+		ORDER BY c.due_date
+		LIMIT $4
+		FOR UPDATE OF c SKIP LOCKED
+	`, from, to, offsetMinutes, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []DueReminder
+	for rows.Next() {
+		d := DueReminder{OffsetMinutes: offsetMinutes}
+		if err := rows.Scan(&d.CardID, &d.CardTitle, &d.BoardID, &d.DueDate); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var claimed []DueReminder
+	for _, d := range candidates {
+		res, err := s.DB.Exec(
+			`INSERT INTO due_reminders (card_id, offset_minutes, due_date) VALUES ($1, $2, $3)
+			 ON CONFLICT (card_id, offset_minutes, due_date) DO NOTHING`,
+			d.CardID, d.OffsetMinutes, d.DueDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			claimed = append(claimed, d)
+		}
+	}
+	return claimed, nil
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// FlowSeries is the number of cards in a list at the end of each day of a cumulative flow
+// diagram.
+type FlowSeries struct {
+	ListID int    `json:"list_id"`
+	Title  string `json:"title"`
+	Counts []int  `json:"counts"`
+}
+
+// DurationStats summarises durations in hours; the figures are nil when Count is 0.
+type DurationStats struct {
+	Count        int      `json:"count"`
+	AverageHours *float64 `json:"average_hours"`
+	P50Hours     *float64 `json:"p50_hours"`
+	P85Hours     *float64 `json:"p85_hours"`
+	P95Hours     *float64 `json:"p95_hours"`
+}
+
+// ListDwell is how long cards stay in a list per visit. Visits still going on count up to now.
+type ListDwell struct {
+	ListID       int      `json:"list_id"`
+	Title        string   `json:"title"`
+	Visits       int      `json:"visits"`
+	Ongoing      int      `json:"ongoing"`
+	AverageHours *float64 `json:"average_hours"`
+}
+
+type FlowMetricsService struct{ DB DBTX }
+
+// boardVisits is a CTE of the stays of the board's cards in lists: one row per transition,
+// lasting until the card's next one. Cards that left the board keep their history here.
+const boardVisits = `visits AS (
+	    SELECT t.card_id, t.to_list_id AS list_id, t.moved_at AS entered_at,
+	           LEAD(t.moved_at) OVER (PARTITION BY t.card_id ORDER BY t.moved_at, t.id) AS left_at
+	    FROM card_transitions t
+	    WHERE t.card_id IN (SELECT card_id FROM card_transitions WHERE board_id = $1)
+	)`
+
+// cardDoneAt is when the card c, in list cl, was done: completed, or entered the Done list it
+// is still in, whichever came first. It is NULL for open cards.
+const cardDoneAt = `LEAST(
+	    CASE WHEN LOWER(TRIM(cl.title)) = 'done' THEN (
+	        SELECT MAX(dt.moved_at) FROM card_transitions dt JOIN lists dl ON dl.id = dt.to_list_id
+	        WHERE dt.card_id = c.id AND LOWER(TRIM(dl.title)) = 'done'
+	    ) END,
+	    CASE WHEN c.completed THEN c.completed_at END
+	)`
+
+// CumulativeFlow counts the cards in each list of the board at each of dayEnds.
+func (s *FlowMetricsService) CumulativeFlow(boardID int, dayEnds []time.Time) ([]FlowSeries, error) {
+	ends := make([]string, len(dayEnds))
+	for i, t := range dayEnds {
+		ends[i] = t.UTC().Format(time.RFC3339)
+	}
+	rows, err := s.DB.Query(`
+		WITH `+boardVisits+`,
+		days AS (SELECT day_end, ord FROM unnest($2::timestamptz[]) WITH ORDINALITY AS d(day_end, ord))
+		SELECT l.id, l.title, d.ord, COUNT(v.card_id)
+		FROM lists l
+		CROSS JOIN days d
+		LEFT JOIN visits v ON v.list_id = l.id AND v.entered_at < d.day_end AND (v.left_at IS NULL OR v.left_at >= d.day_end)
+		WHERE l.board_id = $1
+		GROUP BY l.id, d.ord
+		ORDER BY l.position, l.id, d.ord
+	`, boardID, pq.Array(ends))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []FlowSeries{}
+	for rows.Next() {
+		var listID, ord, n int
+		var title string
+		if err := rows.Scan(&listID, &title, &ord, &n); err != nil {
+			return nil, err
+		}
+		if len(out) == 0 || out[len(out)-1].ListID != listID {
+			out = append(out, FlowSeries{ListID: listID, Title: title, Counts: make([]int, len(dayEnds))})
+		}
+		out[len(out)-1].Counts[ord-1] = n
+	}
+	return out, rows.Err()
+}
+
+// LeadAndCycleTimes measures the cards of the board done within [from, to) (see cardDoneAt).
+// Lead time runs from their creation, cycle time from when they first entered an In Progress
+// or Doing list.
+func (s *FlowMetricsService) LeadAndCycleTimes(boardID int, from, to time.Time) (*DurationStats, *DurationStats, error) {
+	var lead, cycle DurationStats
+	var leadAvg, cycleAvg sql.NullFloat64
+	var leadPct, cyclePct pq.Float64Array
+	err := s.DB.QueryRow(`
+		WITH history AS (
+		    SELECT t.card_id, t.moved_at, LOWER(TRIM(l.title)) AS list_title
+		    FROM card_transitions t
+		    JOIN lists l ON l.id = t.to_list_id
+		    JOIN cards c ON c.id = t.card_id
+		    JOIN lists cl ON cl.id = c.list_id
+		    WHERE cl.board_id = $1
+		),
+		done AS (
+		    SELECT c.id AS card_id, `+cardDoneAt+` AS done_at
+		    FROM cards c JOIN lists cl ON cl.id = c.list_id
+		    WHERE cl.board_id = $1
+		),
+		durations AS (
+		    SELECT (EXTRACT(EPOCH FROM d.done_at - (SELECT MIN(h.moved_at) FROM history h WHERE h.card_id = d.card_id)) / 3600)::float8 AS lead_hours,
+		           (EXTRACT(EPOCH FROM d.done_at - (SELECT MIN(h.moved_at) FROM history h
+		               WHERE h.card_id = d.card_id AND h.list_title IN ('in progress', 'doing') AND h.moved_at <= d.done_at)) / 3600)::float8 AS cycle_hours
+		    FROM done d
+		    WHERE d.done_at >= $2 AND d.done_at < $3
+		)
+		SELECT COUNT(lead_hours), AVG(lead_hours), percentile_cont(ARRAY[0.5, 0.85, 0.95]) WITHIN GROUP (ORDER BY lead_hours),
+		       COUNT(cycle_hours), AVG(cycle_hours), percentile_cont(ARRAY[0.5, 0.85, 0.95]) WITHIN GROUP (ORDER BY cycle_hours)
+		FROM durations
+	`, boardID, from, to).Scan(&lead.Count, &leadAvg, &leadPct, &cycle.Count, &cycleAvg, &cyclePct)
+	if err != nil {
+		return nil, nil, err
+	}
+	lead.fill(leadAvg, leadPct)
+	cycle.fill(cycleAvg, cyclePct)
+	return &lead, &cycle, nil
+}
+
+func (d *DurationStats) fill(avg sql.NullFloat64, pct pq.Float64Array) {
+	if avg.Valid {
+		d.AverageHours = hours(avg.Float64)
+	}
+	if len(pct) == 3 {
+		d.P50Hours, d.P85Hours, d.P95Hours = hours(pct[0]), hours(pct[1]), hours(pct[2])
+	}
+}
+
+// hours rounds a number of hours to the hundredth.
+func hours(h float64) *float64 {
+	h = math.Round(h*100) / 100
+	return &h
+}
+
+// DwellTimes averages, per list of the board, the visits that started within [from, to).
+func (s *FlowMetricsService) DwellTimes(boardID int, from, to time.Time) ([]ListDwell, error) {
+	rows, err := s.DB.Query(`
+		WITH `+boardVisits+`
+		SELECT l.id, l.title, COUNT(v.entered_at), COUNT(v.entered_at) FILTER (WHERE v.left_at IS NULL),
+		       AVG(EXTRACT(EPOCH FROM COALESCE(v.left_at, NOW()) - v.entered_at)) / 3600
+		FROM lists l
+		LEFT JOIN visits v ON v.list_id = l.id AND v.entered_at >= $2 AND v.entered_at < $3
+		WHERE l.board_id = $1
+		GROUP BY l.id
+		ORDER BY l.position, l.id
+	`, boardID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ListDwell{}
+	for rows.Next() {
+		var d ListDwell
+		var avg sql.NullFloat64
+		if err := rows.Scan(&d.ListID, &d.Title, &d.Visits, &d.Ongoing, &avg); err != nil {
+			return nil, err
+		}
+		if avg.Valid {
+			d.AverageHours = hours(avg.Float64)
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
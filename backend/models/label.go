@@ -0,0 +1,138 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Label is an entry of a board's label catalog. Cards reference labels by id, so renaming
+// or recoloring a label changes it on every card.
+type Label struct {
+	ID        int       `json:"id"`
+	BoardID   int       `json:"board_id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	CardCount int       `json:"card_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ErrLabelExists is returned when a board already has a label with the name, ignoring case.
+var ErrLabelExists = errors.New("a label with this name already exists on the board")
+
+type LabelService struct{ DB DBTX }
+
+const labelColumns = `bl.id, bl.board_id, bl.name, bl.color, (SELECT COUNT(*) FROM card_labels cl WHERE cl.label_id = bl.id), bl.created_at`
+
+func scanLabel(row interface{ Scan(...interface{}) error }) (*Label, error) {
+	var l Label
+	if err := row.Scan(&l.ID, &l.BoardID, &l.Name, &l.Color, &l.CardCount, &l.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (s *LabelService) CreateLabel(boardID int, name, color string) (*Label, error) {
+	var id int
+	err := s.DB.QueryRow(
+		"INSERT INTO board_labels (board_id, name, color) VALUES ($1, $2, $3) ON CONFLICT (board_id, lower(name)) DO NOTHING RETURNING id",
+		boardID, name, color,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrLabelExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetLabelByID(id)
+}
+
+func (s *LabelService) GetLabelByID(id int) (*Label, error) {
+	return scanLabel(s.DB.QueryRow("SELECT "+labelColumns+" FROM board_labels bl WHERE bl.id = $1", id))
+}
+
+// GetLabelByName finds a board's label by name, ignoring case.
+func (s *LabelService) GetLabelByName(boardID int, name string) (*Label, error) {
+	return scanLabel(s.DB.QueryRow("SELECT "+labelColumns+" FROM board_labels bl WHERE bl.board_id = $1 AND lower(bl.name) = lower($2)", boardID, name))
+}
+
+func (s *LabelService) GetLabelsByBoard(boardID int) ([]Label, error) {
+	rows, err := s.DB.Query("SELECT "+labelColumns+" FROM board_labels bl WHERE bl.board_id = $1 ORDER BY lower(bl.name), bl.id", boardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Label
+	for rows.Next() {
+		l, err := scanLabel(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *l)
+	}
+	return out, rows.Err()
+}
+
+// EnsureLabel returns the board's label with the name, creating it with color when the board
+// has none. An existing label keeps its color.
+func (s *LabelService) EnsureLabel(boardID int, name, color string) (*Label, error) {
+	l, err := s.GetLabelByName(boardID, name)
+	if err != sql.ErrNoRows {
+		return l, err
+	}
+	l, err = s.CreateLabel(boardID, name, color)
+	if err == ErrLabelExists {
+		// Created concurrently since the lookup.
+		return s.GetLabelByName(boardID, name)
+	}
+	return l, err
+}
+
+func (s *LabelService) UpdateLabel(id int, name, color string) (*Label, error) {
+	_, err := s.DB.Exec("UPDATE board_labels SET name = $2, color = $3 WHERE id = $1", id, name, color)
+	if isUniqueViolation(err) {
+		return nil, ErrLabelExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetLabelByID(id)
+}
+
+// DeleteLabel removes the label from the catalog and from every card, and returns the ids of
+// the cards that carried it.
+func (s *LabelService) DeleteLabel(id int) ([]int, error) {
+	cardIDs, err := queryIDs(s.DB, "DELETE FROM card_labels WHERE label_id = $1 RETURNING card_id", id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.DB.Exec("DELETE FROM board_labels WHERE id = $1", id)
+	return cardIDs, err
+}
+
+// queryIDs runs a query returning one integer column and collects it.
+func queryIDs(db DBTX, query string, args ...interface{}) ([]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -1,6 +1,6 @@
 package models
 
-import "database/sql"
+import "strconv"
 
 type List struct {
     ID       int    `json:"id"`
@@ -8,9 +8,11 @@ type List struct {
     Title    string `json:"title"`
     Accent   string `json:"accent"`
     Position int    `json:"position"`
+    // WIPLimit caps the cards in the list; nil means no limit.
+    WIPLimit *int   `json:"wip_limit"`
 }
 
-type ListService struct { DB *sql.DB }
+type ListService struct { DB DBTX }
 
 func (s *ListService) CreateList(boardID int, title, accent string, position int) (*List, error) {
     var id int
@@ -24,22 +26,64 @@ func (s *ListService) CreateList(boardID int, title, accent string, position int
 
 func (s *ListService) GetListByID(id int) (*List, error) {
     var l List
-    err := s.DB.QueryRow("SELECT id, board_id, title, accent, position FROM lists WHERE id=$1", id).
-        Scan(&l.ID, &l.BoardID, &l.Title, &l.Accent, &l.Position)
+    err := s.DB.QueryRow("SELECT id, board_id, title, accent, position, wip_limit FROM lists WHERE id=$1", id).
+        Scan(&l.ID, &l.BoardID, &l.Title, &l.Accent, &l.Position, &l.WIPLimit)
     if err != nil { return nil, err }
     return &l, nil
 }
 
 func (s *ListService) GetListsByBoard(boardID int) ([]List, error) {
-    rows, err := s.DB.Query("SELECT id, board_id, title, accent, position FROM lists WHERE board_id=$1 ORDER BY position, id", boardID)
+    rows, err := s.DB.Query("SELECT id, board_id, title, accent, position, wip_limit FROM lists WHERE board_id=$1 ORDER BY position, id", boardID)
     if err != nil { return nil, err }
     defer rows.Close()
     var out []List
     for rows.Next() {
         var l List
-        if err := rows.Scan(&l.ID, &l.BoardID, &l.Title, &l.Accent, &l.Position); err != nil { return nil, err }
+        if err := rows.Scan(&l.ID, &l.BoardID, &l.Title, &l.Accent, &l.Position, &l.WIPLimit); err != nil { return nil, err }
         out = append(out, l)
     }
     return out, rows.Err()
 }
 
+func (s *ListService) UpdateList(id int, title, accent string, wipLimit *int) (*List, error) {
+    _, err := s.DB.Exec("UPDATE lists SET title=$2, accent=$3, wip_limit=$4 WHERE id=$1", id, title, accent, wipLimit)
+    if err != nil { return nil, err }
+    return s.GetListByID(id)
+}
+
+// LockForEntry locks the list until the end of the transaction and counts its cards, so that
+// concurrent moves into it are checked one after the other against its WIP limit.
+func (s *ListService) LockForEntry(id int) (int, error) {
+    if _, err := s.DB.Exec("SELECT 1 FROM lists WHERE id=$1 FOR UPDATE", id); err != nil { return 0, err }
+    var n int
+    err := s.DB.QueryRow("SELECT COUNT(*) FROM cards WHERE list_id=$1", id).Scan(&n)
+    return n, err
+}
+
+// WIPLimitError refuses a card entering a list already at its WIP limit.
+type WIPLimitError struct {
+    List  *List
+    Count int
+}
+
+func (e *WIPLimitError) Error() string {
+    return "list " + strconv.Quote(e.List.Title) + " is at its WIP limit of " + strconv.Itoa(*e.List.WIPLimit) +
+        " cards (" + strconv.Itoa(e.Count) + " now)"
+}
+
+// EnterList checks the WIP limit of the list a card is about to enter, holding a lock on the
+// list for the rest of the transaction. Every path that puts a card in a list goes through it.
+// When the card would go over the limit it returns a *WIPLimitError if the board blocks, or
+// the warning "<count after>/<limit>" if it only warns.
+func (s *ListService) EnterList(id int) (string, error) {
+    l, err := s.GetListByID(id)
+    if err != nil { return "", err }
+    if l.WIPLimit == nil { return "", nil }
+    n, err := s.LockForEntry(id)
+    if err != nil { return "", err }
+    if n < *l.WIPLimit { return "", nil }
+    var policy string
+    if err := s.DB.QueryRow("SELECT wip_policy FROM boards WHERE id=$1", l.BoardID).Scan(&policy); err != nil { return "", err }
+    if policy != WIPWarn { return "", &WIPLimitError{List: l, Count: n} }
+    return strconv.Itoa(n+1) + "/" + strconv.Itoa(*l.WIPLimit), nil
+}
@@ -0,0 +1,330 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+type NotificationType string
+
+const (
+	NotificationCardAssigned NotificationType = "card_assigned"
+	NotificationBoardInvite  NotificationType = "board_invite"
+	NotificationCardComment  NotificationType = "card_comment"
+	NotificationDueSoon      NotificationType = "due_soon"
+	NotificationOverdue      NotificationType = "overdue"
+)
+
+const (
+	DigestOff    = "off"
+	DigestHourly = "hourly"
+	DigestDaily  = "daily"
+)
+
+func ValidDigestFrequency(f string) bool {
+	return f == DigestOff || f == DigestHourly || f == DigestDaily
+}
+
+type Notification struct {
+	ID         int              `json:"id"`
+	UserID     int              `json:"user_id"`
+	ActorID    *int             `json:"actor_id"`
+	ActorEmail string           `json:"actor_email"`
+	Type       NotificationType `json:"type"`
+	BoardID    *int             `json:"board_id"`
+	CardID     *int             `json:"card_id"`
+	Message    string           `json:"message"`
+	ReadAt     *time.Time       `json:"read_at"`
+	CreatedAt  time.Time        `json:"created_at"`
+
+	// EmailedDirectly marks a notification that was already emailed on its own so digests skip it.
+	EmailedDirectly bool `json:"-"`
+}
+
+// NotificationPreferences holds one row per user; a missing row means every type is enabled.
+type NotificationPreferences struct {
+	UserID          int    `json:"user_id"`
+	EmailEnabled    bool   `json:"email_enabled"`
+	DigestFrequency string `json:"digest_frequency"`
+	CardAssigned    bool   `json:"card_assigned"`
+	BoardInvite     bool   `json:"board_invite"`
+	CardComment     bool   `json:"card_comment"`
+	DueReminder     bool   `json:"due_reminder"`
+}
+
+func (p *NotificationPreferences) Allows(t NotificationType) bool {
+	switch t {
+	case NotificationCardAssigned:
+		return p.CardAssigned
+	case NotificationBoardInvite:
+		return p.BoardInvite
+	case NotificationCardComment:
+		return p.CardComment
+	case NotificationDueSoon, NotificationOverdue:
+		return p.DueReminder
+	}
+	return true
+}
+
+type NotificationService struct {
+	DB DBTX
+}
+
+const notificationColumns = `n.id, n.user_id, n.actor_id, COALESCE(u.email,''), n.type, n.board_id, n.card_id, n.message, n.read_at, n.created_at`
+
+func scanNotifications(rows *sql.Rows) ([]Notification, error) {
+	defer rows.Close()
+	var out []Notification
+	for rows.Next() {
+		var n Notification
+		var actorID, boardID, cardID sql.NullInt64
+		var readAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.UserID, &actorID, &n.ActorEmail, &n.Type, &boardID, &cardID, &n.Message, &readAt, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.ActorID = nullIntPtr(actorID)
+		n.BoardID = nullIntPtr(boardID)
+		n.CardID = nullIntPtr(cardID)
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+// Notify stores a notification unless the recipient is the actor or has muted that type.
+func (s *NotificationService) Notify(n Notification) error {
+	if n.ActorID != nil && *n.ActorID == n.UserID {
+		return nil
+	}
+	prefs, err := s.GetPreferences(n.UserID)
+	if err != nil {
+		return err
+	}
+	if !prefs.Allows(n.Type) {
+		return nil
+	}
+	_, err = s.DB.Exec(
+		`INSERT INTO notifications (user_id, actor_id, type, board_id, card_id, message, emailed_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, CASE WHEN $7 THEN CURRENT_TIMESTAMP END)`,
+		n.UserID, n.ActorID, string(n.Type), n.BoardID, n.CardID, n.Message, n.EmailedDirectly,
+	)
+	return err
+}
+
+func (s *NotificationService) GetNotificationsByUser(userID int, unreadOnly bool, limit, offset int) ([]Notification, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+notificationColumns+`
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.actor_id
+		WHERE n.user_id = $1 AND ($2 = false OR n.read_at IS NULL)
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT $3 OFFSET $4
+	`, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotifications(rows)
+}
+
+func (s *NotificationService) CountUnread(userID int) (int, error) {
+	var count int
+	err := s.DB.QueryRow(
+		"SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL",
+		userID,
+	).Scan(&count)
+	return count, err
+}
+
+// MarkRead reports whether the notification exists and belongs to the user.
+func (s *NotificationService) MarkRead(userID, id int) (bool, error) {
+	res, err := s.DB.Exec(
+		"UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP) WHERE id = $1 AND user_id = $2",
+		id, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *NotificationService) MarkAllRead(userID int) (int, error) {
+	res, err := s.DB.Exec(
+		"UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND read_at IS NULL",
+		userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *NotificationService) GetPreferences(userID int) (*NotificationPreferences, error) {
+	p := NotificationPreferences{
+		UserID:          userID,
+		EmailEnabled:    true,
+		DigestFrequency: DigestDaily,
+		CardAssigned:    true,
+		BoardInvite:     true,
+		CardComment:     true,
+		DueReminder:     true,
+	}
+	err := s.DB.QueryRow(
+		`SELECT email_enabled, digest_frequency, card_assigned, board_invite, card_comment, due_reminder
+		 FROM notification_preferences WHERE user_id = $1`,
+		userID,
+	).Scan(&p.EmailEnabled, &p.DigestFrequency, &p.CardAssigned, &p.BoardInvite, &p.CardComment, &p.DueReminder)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *NotificationService) SavePreferences(p NotificationPreferences) (*NotificationPreferences, error) {
+	_, err := s.DB.Exec(
+		`INSERT INTO notification_preferences (user_id, email_enabled, digest_frequency, card_assigned, board_invite, card_comment, due_reminder)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (user_id) DO UPDATE SET
+		   email_enabled = $2, digest_frequency = $3, card_assigned = $4, board_invite = $5, card_comment = $6,
+		   due_reminder = $7, updated_at = CURRENT_TIMESTAMP`,
+		p.UserID, p.EmailEnabled, p.DigestFrequency, p.CardAssigned, p.BoardInvite, p.CardComment, p.DueReminder,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPreferences(p.UserID)
+}
+
+// digestDueSQL matches preference rows whose digest period has elapsed.
+const digestDueSQL = `p.email_enabled AND p.digest_frequency IN ('hourly', 'daily')
+	AND (p.last_digest_at IS NULL OR p.last_digest_at <= CURRENT_TIMESTAMP -
+		CASE p.digest_frequency WHEN 'hourly' THEN INTERVAL '1 hour' ELSE INTERVAL '1 day' END)`
+
+// DueDigestUsers lists users with unread, not yet emailed notifications whose digest is due.
+// Users without a preferences row get one with the defaults so they can be locked later.
+func (s *NotificationService) DueDigestUsers() ([]int, error) {
+	_, err := s.DB.Exec(`
+		INSERT INTO notification_preferences (user_id)
+		SELECT DISTINCT user_id FROM notifications WHERE read_at IS NULL AND emailed_at IS NULL
+		ON CONFLICT (user_id) DO NOTHING
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT p.user_id FROM notification_preferences p
+		WHERE ` + digestDueSQL + `
+		AND EXISTS (SELECT 1 FROM notifications n WHERE n.user_id = p.user_id AND n.read_at IS NULL AND n.emailed_at IS NULL)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// LockDueDigest locks the user's preferences row if their digest is still due. It returns
+// false when another worker holds the row or already sent the digest.
+func (s *NotificationService) LockDueDigest(userID int) (bool, error) {
+	var locked int
+	err := s.DB.QueryRow(`
+		SELECT p.user_id FROM notification_preferences p
+		WHERE p.user_id = $1 AND `+digestDueSQL+`
+		FOR UPDATE SKIP LOCKED
+	`, userID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *NotificationService) GetUndigested(userID int) ([]Notification, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+notificationColumns+`
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.actor_id
+		WHERE n.user_id = $1 AND n.read_at IS NULL AND n.emailed_at IS NULL
+		ORDER BY n.created_at ASC, n.id ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotifications(rows)
+}
+
+// MarkDigested flags notifications up to lastID as emailed and stamps the digest time.
+func (s *NotificationService) MarkDigested(userID, lastID int) error {
+	_, err := s.DB.Exec(
+		"UPDATE notifications SET emailed_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND id <= $2 AND emailed_at IS NULL",
+		userID, lastID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(
+		"UPDATE notification_preferences SET last_digest_at = CURRENT_TIMESTAMP WHERE user_id = $1",
+		userID,
+	)
+	return err
+}
+
+// UnsubscribeToken returns the user's opaque unsubscribe token, creating it on first use.
+func (s *NotificationService) UnsubscribeToken(userID int) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	var token string
+	err := s.DB.QueryRow(`
+		INSERT INTO notification_preferences (user_id, unsubscribe_token) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET unsubscribe_token = COALESCE(notification_preferences.unsubscribe_token, $2)
+		RETURNING unsubscribe_token
+	`, userID, hex.EncodeToString(b)).Scan(&token)
+	return token, err
+}
+
+// ValidUnsubscribeToken reports whether token belongs to a user, without changing anything.
+func (s *NotificationService) ValidUnsubscribeToken(token string) (bool, error) {
+	var exists bool
+	err := s.DB.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM notification_preferences WHERE unsubscribe_token = $1)",
+		token,
+	).Scan(&exists)
+	return exists, err
+}
+
+// Unsubscribe turns off email for the user owning token and reports whether one matched.
+func (s *NotificationService) Unsubscribe(token string) (bool, error) {
+	res, err := s.DB.Exec(
+		"UPDATE notification_preferences SET email_enabled = false, updated_at = CURRENT_TIMESTAMP WHERE unsubscribe_token = $1",
+		token,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func nullIntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
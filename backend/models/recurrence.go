@@ -0,0 +1,236 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	RecurDaily   = "daily"
+	RecurWeekly  = "weekly"
+	RecurMonthly = "monthly"
+	RecurCron    = "cron"
+)
+
+// CardRecurrence makes a card a template that is cloned into TargetListID on a schedule.
+// Time is the local "HH:MM" in Timezone for the daily, weekly and monthly frequencies;
+// the cron frequency uses a five-field expression evaluated in Timezone instead.
+type CardRecurrence struct {
+	ID           int        `json:"id"`
+	CardID       int        `json:"card_id"`
+	TargetListID int        `json:"target_list_id"`
+	Frequency    string     `json:"frequency"`
+	Time         string     `json:"time"`
+	Weekdays     []int      `json:"weekdays"`
+	MonthDay     int        `json:"month_day"`
+	Cron         string     `json:"cron"`
+	Timezone     string     `json:"timezone"`
+	Enabled      bool       `json:"enabled"`
+	NextRunAt    *time.Time `json:"next_run_at"`
+	LastRunAt    *time.Time `json:"last_run_at"`
+	LastCardID   *int       `json:"last_card_id"`
+	CreatedBy    int        `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// DueRecurrence is a recurrence claimed by the scheduler, with what is needed to log the clone.
+type DueRecurrence struct {
+	CardRecurrence
+	BoardID      int
+	BoardOwnerID int
+	CardTitle    string
+}
+
+func (r *CardRecurrence) schedule() (*cronSchedule, error) {
+	if r.Frequency == RecurCron {
+		return parseCron(r.Cron)
+	}
+	clock, err := time.Parse("15:04", r.Time)
+	if err != nil {
+		return nil, fmt.Errorf("time must be HH:MM")
+	}
+	prefix := fmt.Sprintf("%d %d", clock.Minute(), clock.Hour())
+	switch r.Frequency {
+	case RecurDaily:
+		return parseCron(prefix + " * * *")
+	case RecurWeekly:
+		if len(r.Weekdays) == 0 {
+			return nil, fmt.Errorf("weekly recurrence needs at least one weekday")
+		}
+		days := make([]string, len(r.Weekdays))
+		for i, d := range r.Weekdays {
+			if d < 0 || d > 6 {
+				return nil, fmt.Errorf("weekdays must be between 0 (Sunday) and 6 (Saturday)")
+			}
+			days[i] = strconv.Itoa(d)
+		}
+		return parseCron(prefix + " * * " + strings.Join(days, ","))
+	case RecurMonthly:
+		if r.MonthDay < 1 || r.MonthDay > 28 {
+			return nil, fmt.Errorf("month_day must be between 1 and 28, use a cron expression for other days")
+		}
+		return parseCron(fmt.Sprintf("%s %d * *", prefix, r.MonthDay))
+	}
+	return nil, fmt.Errorf("unknown frequency %q", r.Frequency)
+}
+
+func (r *CardRecurrence) Validate() error {
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", r.Timezone)
+	}
+	_, err := r.schedule()
+	return err
+}
+
+// Occurrences returns up to n run times strictly after the given time, in UTC.
+func (r *CardRecurrence) Occurrences(after time.Time, n int) ([]time.Time, error) {
+	sched, err := r.schedule()
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	out := []time.Time{}
+	t := after.In(loc)
+	for len(out) < n {
+		if t, err = sched.next(t); err != nil {
+			if len(out) > 0 {
+				break
+			}
+			return nil, err
+		}
+		out = append(out, t.UTC())
+	}
+	return out, nil
+}
+
+// Next returns the first run time strictly after the given time.
+func (r *CardRecurrence) Next(after time.Time) (time.Time, error) {
+	times, err := r.Occurrences(after, 1)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return times[0], nil
+}
+
+type RecurrenceService struct {
+	DB DBTX
+}
+
+const recurrenceColumns = `r.id, r.card_id, r.target_list_id, r.frequency, r.time_of_day, r.weekdays, r.month_day, r.cron,
+	r.timezone, r.enabled, r.next_run_at, r.last_run_at, r.last_card_id, COALESCE(r.created_by, 0), r.created_at`
+
+func scanRecurrence(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*CardRecurrence, error) {
+	var r CardRecurrence
+	var weekdays []int64
+	var nextRun, lastRun sql.NullTime
+	var lastCard sql.NullInt64
+	dest := []interface{}{&r.ID, &r.CardID, &r.TargetListID, &r.Frequency, &r.Time, pq.Array(&weekdays), &r.MonthDay, &r.Cron,
+		&r.Timezone, &r.Enabled, &nextRun, &lastRun, &lastCard, &r.CreatedBy, &r.CreatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	r.Weekdays = make([]int, len(weekdays))
+	for i, d := range weekdays {
+		r.Weekdays[i] = int(d)
+	}
+	if nextRun.Valid {
+		r.NextRunAt = &nextRun.Time
+	}
+	if lastRun.Valid {
+		r.LastRunAt = &lastRun.Time
+	}
+	r.LastCardID = nullIntPtr(lastCard)
+	return &r, nil
+}
+
+func (s *RecurrenceService) GetByCard(cardID int) (*CardRecurrence, error) {
+	return scanRecurrence(s.DB.QueryRow("SELECT "+recurrenceColumns+" FROM card_recurrences r WHERE r.card_id = $1", cardID))
+}
+
+// Save creates or replaces the card's recurrence and schedules its next run.
+func (s *RecurrenceService) Save(r *CardRecurrence) (*CardRecurrence, error) {
+	var next *time.Time
+	if r.Enabled {
+		t, err := r.Next(time.Now())
+		if err != nil {
+			return nil, err
+		}
+		next = &t
+	}
+	if r.Weekdays == nil {
+		r.Weekdays = []int{}
+	}
+	_, err := s.DB.Exec(`
+		INSERT INTO card_recurrences (card_id, target_list_id, frequency, time_of_day, weekdays, month_day, cron, timezone, enabled, next_run_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (card_id) DO UPDATE SET
+		  target_list_id = EXCLUDED.target_list_id, frequency = EXCLUDED.frequency, time_of_day = EXCLUDED.time_of_day,
+		  weekdays = EXCLUDED.weekdays, month_day = EXCLUDED.month_day, cron = EXCLUDED.cron, timezone = EXCLUDED.timezone,
+		  enabled = EXCLUDED.enabled, next_run_at = EXCLUDED.next_run_at
+	`, r.CardID, r.TargetListID, r.Frequency, r.Time, pq.Array(r.Weekdays), r.MonthDay, r.Cron, r.Timezone, r.Enabled, next, r.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByCard(r.CardID)
+}
+
+func (s *RecurrenceService) Delete(cardID int) (bool, error) {
+	res, err := s.DB.Exec("DELETE FROM card_recurrences WHERE card_id = $1", cardID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ClaimDue locks enabled recurrences whose next run is due. It must run inside a
+// transaction; rows locked by another replica are skipped.
+func (s *RecurrenceService) ClaimDue(now time.Time, limit int) ([]DueRecurrence, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+recurrenceColumns+`, l.board_id, b.user_id, c.title
+		FROM card_recurrences r
+		JOIN cards c ON c.id = r.card_id
+		JOIN lists l ON l.id = r.target_list_id
+		JOIN boards b ON b.id = l.board_id
+		WHERE r.enabled AND r.next_run_at <= $1
+		ORDER BY r.next_run_at
+		LIMIT $2
+		FOR UPDATE OF r SKIP LOCKED
+	`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DueRecurrence
+	for rows.Next() {
+		var d DueRecurrence
+		r, err := scanRecurrence(rows, &d.BoardID, &d.BoardOwnerID, &d.CardTitle)
+		if err != nil {
+			return nil, err
+		}
+		d.CardRecurrence = *r
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// MarkRun records a clone and schedules the next run; a nil next disables the recurrence.
+func (s *RecurrenceService) MarkRun(id int, cloneID *int, next *time.Time) error {
+	_, err := s.DB.Exec(`
+		UPDATE card_recurrences SET
+		  last_run_at = CASE WHEN $2::int IS NULL THEN last_run_at ELSE CURRENT_TIMESTAMP END,
+		  last_card_id = COALESCE($2, last_card_id),
+		  next_run_at = $3, enabled = enabled AND $3::timestamptz IS NOT NULL
+		WHERE id = $1
+	`, id, cloneID, next)
+	return err
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SavedFilter is a named card filter query a user keeps for a board. Filters are private to
+// the user who saved them.
+type SavedFilter struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	BoardID   int       `json:"board_id"`
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ErrFilterExists is returned when the user already has a filter with the name on the board,
+// ignoring case.
+var ErrFilterExists = errors.New("you already have a filter with this name on the board")
+
+type SavedFilterService struct{ DB DBTX }
+
+const savedFilterColumns = `id, user_id, board_id, name, query, created_at`
+
+func scanSavedFilter(row interface{ Scan(...interface{}) error }) (*SavedFilter, error) {
+	var f SavedFilter
+	if err := row.Scan(&f.ID, &f.UserID, &f.BoardID, &f.Name, &f.Query, &f.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (s *SavedFilterService) CreateFilter(userID, boardID int, name, query string) (*SavedFilter, error) {
+	var id int
+	err := s.DB.QueryRow(
+		"INSERT INTO saved_filters (user_id, board_id, name, query) VALUES ($1, $2, $3, $4) ON CONFLICT (user_id, board_id, lower(name)) DO NOTHING RETURNING id",
+		userID, boardID, name, query,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrFilterExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetFilterByID(id)
+}
+
+func (s *SavedFilterService) GetFilterByID(id int) (*SavedFilter, error) {
+	return scanSavedFilter(s.DB.QueryRow("SELECT "+savedFilterColumns+" FROM saved_filters WHERE id = $1", id))
+}
+
+// GetFilters lists the user's filters for the board by name.
+func (s *SavedFilterService) GetFilters(userID, boardID int) ([]SavedFilter, error) {
+	rows, err := s.DB.Query("SELECT "+savedFilterColumns+" FROM saved_filters WHERE user_id = $1 AND board_id = $2 ORDER BY lower(name), id", userID, boardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SavedFilter
+	for rows.Next() {
+		f, err := scanSavedFilter(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *f)
+	}
+	return out, rows.Err()
+}
+
+func (s *SavedFilterService) UpdateFilter(id int, name, query string) (*SavedFilter, error) {
+	_, err := s.DB.Exec("UPDATE saved_filters SET name = $2, query = $3 WHERE id = $1", id, name, query)
+	if isUniqueViolation(err) {
+		return nil, ErrFilterExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetFilterByID(id)
+}
+
+func (s *SavedFilterService) DeleteFilter(id int) error {
+	_, err := s.DB.Exec("DELETE FROM saved_filters WHERE id = $1", id)
+	return err
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"database/sql"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// SearchConfig is the text search configuration of the search_vector columns and queries.
+// "simple" only lowercases words, so boards written in any language match alike.
+const SearchConfig = "simple"
+
+// Snippets are highlighted by Postgres with these markers, which are unlikely in card text;
+// highlight then escapes the text and swaps them for <mark> tags.
+const (
+	searchStartSel = "⟦"
+	searchStopSel  = "⟧"
+	headlineOpts   = "StartSel=" + searchStartSel + ", StopSel=" + searchStopSel + `, MaxFragments=2, MaxWords=18, MinWords=6, FragmentDelimiter=" … "`
+	// Titles are short: keep them whole rather than cut into fragments.
+	titleHeadlineOpts = "StartSel=" + searchStartSel + ", StopSel=" + searchStopSel + ", HighlightAll=true"
+)
+
+// SearchHit is a card matching a search. Sources says which parts matched: "card" (title or
+// description), "comment" and "label". Title and Snippet are HTML-escaped, with matches
+// wrapped in <mark>; Snippet comes from the description or, failing that, the best comment.
+type SearchHit struct {
+	CardID        int      `json:"card_id"`
+	Title         string   `json:"title"`
+	ListID        int      `json:"list_id"`
+	ListTitle     string   `json:"list_title"`
+	BoardID       int      `json:"board_id"`
+	BoardTitle    string   `json:"board_title"`
+	Rank          float64  `json:"rank"`
+	Sources       []string `json:"sources"`
+	Snippet       string   `json:"snippet"`
+	SnippetSource string   `json:"snippet_source,omitempty"`
+	CommentID     *int     `json:"comment_id,omitempty"`
+}
+
+type SearchService struct{ DB DBTX }
+
+// SearchCards ranks the cards of the boards userID can open (or of boardID only, when it is
+// not zero) against a web-style query: words, "quoted phrases", OR and -excluded words.
+// Only cards matching cond, a card filter condition as in CardService.MatchingCardIDs, are
+// kept. It returns one page of hits and the total number of matching cards.
+func (s *SearchService) SearchCards(userID, boardID int, query, cond string, condArgs []interface{}, limit, offset int) ([]SearchHit, int, error) {
+	rows, err := s.DB.Query(`
+		WITH q AS (
+		    SELECT websearch_to_tsquery('`+SearchConfig+`', $2) AS query
+		),
+		visible AS (
+		    SELECT b.id, b.title FROM boards b
+		    WHERE (b.user_id = $1 OR EXISTS (SELECT 1 FROM board_members m WHERE m.board_id = b.id AND m.user_id = $1))
+		      AND ($3 = 0 OR b.id = $3)
+		),
+		hits AS (
+		    SELECT c.id AS card_id, ts_rank(c.search_vector, q.query) AS rank, NULL::int AS comment_id, 'card' AS source
+		    FROM q, cards c
+		    JOIN lists l ON l.id = c.list_id JOIN visible v ON v.id = l.board_id
+		    WHERE c.search_vector @@ q.query
+		    UNION ALL
+		    SELECT cc.card_id, ts_rank(cc.search_vector, q.query) * 0.5, cc.id, 'comment'
+		    FROM q, card_comments cc
+		    JOIN cards c ON c.id = cc.card_id JOIN lists l ON l.id = c.list_id JOIN visible v ON v.id = l.board_id
+		    WHERE cc.search_vector @@ q.query
+		    UNION ALL
+		    SELECT cl.card_id, ts_rank(bl.search_vector, q.query) * 0.4, NULL, 'label'
+		    FROM q, board_labels bl
+		    JOIN visible v ON v.id = bl.board_id JOIN card_labels cl ON cl.label_id = bl.id
+		    WHERE bl.search_vector @@ q.query
+		),
+		ranked AS (
+		    SELECT card_id, SUM(rank) AS rank, array_agg(DISTINCT source) AS sources,
+		           (array_agg(comment_id ORDER BY rank DESC) FILTER (WHERE comment_id IS NOT NULL))[1] AS comment_id
+		    FROM hits GROUP BY card_id
+		)
+		SELECT r.card_id, ts_headline('`+SearchConfig+`', c.title, q.query, $7), c.list_id, l.title, v.id, v.title,
+		       r.rank, r.sources,
+		       CASE WHEN to_tsvector('`+SearchConfig+`', COALESCE(c.description, '')) @@ q.query
+		                 THEN ts_headline('`+SearchConfig+`', c.description, q.query, $6)
+		            WHEN cc.id IS NOT NULL THEN ts_headline('`+SearchConfig+`', cc.content, q.query, $6)
+		            ELSE '' END,
+		       CASE WHEN to_tsvector('`+SearchConfig+`', COALESCE(c.description, '')) @@ q.query THEN 'description'
+		            WHEN cc.id IS NOT NULL THEN 'comment'
+		            ELSE '' END,
+		       r.comment_id,
+		       COUNT(*) OVER ()
+		FROM q, ranked r
+		JOIN cards c ON c.id = r.card_id
+		JOIN lists l ON l.id = c.list_id
+		JOIN visible v ON v.id = l.board_id
+		LEFT JOIN card_comments cc ON cc.id = r.comment_id
+		WHERE `+shiftParams(cond, 7)+`
+		ORDER BY r.rank DESC, r.card_id DESC
+		LIMIT $4 OFFSET $5
+	`, append([]interface{}{userID, query, boardID, limit, offset, headlineOpts, titleHeadlineOpts}, condArgs...)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var out []SearchHit
+	total := 0
+	for rows.Next() {
+		var h SearchHit
+		var commentID sql.NullInt64
+		if err := rows.Scan(&h.CardID, &h.Title, &h.ListID, &h.ListTitle, &h.BoardID, &h.BoardTitle,
+			&h.Rank, pq.Array(&h.Sources), &h.Snippet, &h.SnippetSource, &commentID, &total); err != nil {
+			return nil, 0, err
+		}
+		h.Title, h.Snippet = highlight(h.Title), highlight(h.Snippet)
+		h.CommentID = nullIntPtr(commentID)
+		out = append(out, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(out) == 0 && offset > 0 {
+		// The total rides on the rows, so a page past the end has to count separately.
+		_, total, err := s.SearchCards(userID, boardID, query, cond, condArgs, 1, 0)
+		return out, total, err
+	}
+	return out, total, nil
+}
+
+// FilterCards lists the cards of the boards userID can open (or of boardID only, when it is
+// not zero) that match cond, in board, list and card order, without ranking or snippets.
+func (s *SearchService) FilterCards(userID, boardID int, cond string, condArgs []interface{}, limit, offset int) ([]SearchHit, int, error) {
+	rows, err := s.DB.Query(`
+		WITH visible AS (
+		    SELECT b.id, b.title FROM boards b
+		    WHERE (b.user_id = $1 OR EXISTS (SELECT 1 FROM board_members m WHERE m.board_id = b.id AND m.user_id = $1))
+		      AND ($2 = 0 OR b.id = $2)
+		)
+		SELECT c.id, c.title, c.list_id, l.title, v.id, v.title, COUNT(*) OVER ()
+		FROM cards c
+		JOIN lists l ON l.id = c.list_id
+		JOIN visible v ON v.id = l.board_id
+		WHERE `+shiftParams(cond, 4)+`
+		ORDER BY v.id, l.position, c.position, c.id
+		LIMIT $3 OFFSET $4
+	`, append([]interface{}{userID, boardID, limit, offset}, condArgs...)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var out []SearchHit
+	total := 0
+	for rows.Next() {
+		h := SearchHit{Sources: []string{}}
+		if err := rows.Scan(&h.CardID, &h.Title, &h.ListID, &h.ListTitle, &h.BoardID, &h.BoardTitle, &total); err != nil {
+			return nil, 0, err
+		}
+		h.Title = html.EscapeString(h.Title)
+		out = append(out, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(out) == 0 && offset > 0 {
+		_, total, err := s.FilterCards(userID, boardID, cond, condArgs, 1, 0)
+		return out, total, err
+	}
+	return out, total, nil
+}
+
+var paramRe = regexp.MustCompile(`\$(\d+)`)
+
+// shiftParams renumbers the $n placeholders of a compiled condition to follow the by
+// parameters of the query it is embedded in.
+func shiftParams(cond string, by int) string {
+	return paramRe.ReplaceAllStringFunc(cond, func(p string) string {
+		n, _ := strconv.Atoi(p[1:])
+		return "$" + strconv.Itoa(n+by)
+	})
+}
+
+// highlight HTML-escapes a ts_headline result and turns its markers into <mark> tags.
+func highlight(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, searchStartSel, "<mark>")
+	return strings.ReplaceAll(s, searchStopSel, "</mark>")
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SprintState is where a sprint is in its life: planned, then active, then closed. A board has
+// at most one active sprint.
+type SprintState string
+
+const (
+	SprintPlanned SprintState = "planned"
+	SprintActive  SprintState = "active"
+	SprintClosed  SprintState = "closed"
+)
+
+// Sprint is a time box of a board. StartDate and EndDate are days (YYYY-MM-DD), both included.
+// The counts cover the cards in the sprint, and for a closed sprint the unfinished cards it
+// carried over too; done cards are completed or in a list titled Done.
+type Sprint struct {
+	ID         int         `json:"id"`
+	BoardID    int         `json:"board_id"`
+	Name       string      `json:"name"`
+	Goal       string      `json:"goal"`
+	StartDate  string      `json:"start_date"`
+	EndDate    string      `json:"end_date"`
+	State      SprintState `json:"state"`
+	ClosedAt   *time.Time  `json:"closed_at"`
+	CreatedAt  time.Time   `json:"created_at"`
+	Cards      int         `json:"cards"`
+	DoneCards  int         `json:"done_cards"`
+	Points     float64     `json:"points"`
+	DonePoints float64     `json:"done_points"`
+}
+
+// SprintProgress is how much of a sprint's scope was done by the end of each day.
+type SprintProgress struct {
+	TotalCards  int
+	TotalPoints float64
+	DoneCards   []int
+	DonePoints  []float64
+}
+
+// ErrSprintActive is returned when starting a sprint while another one of the board is active.
+var ErrSprintActive = errors.New("another sprint of the board is already active")
+
+type SprintService struct{ DB DBTX }
+
+const sprintColumns = `s.id, s.board_id, s.name, s.goal, to_char(s.start_date, 'YYYY-MM-DD'), to_char(s.end_date, 'YYYY-MM-DD'),
+	s.state, s.closed_at, s.created_at, st.cards, st.done_cards, st.points, st.done_points`
+
+// sprintScope is the scope of the sprint $1: its current cards, plus the cards carried over when
+// it closed, which count with their points at that time and were never done in it.
+const sprintScope = `
+	    SELECT c.id, COALESCE(c.story_points, 0)::float8 AS points, ` + cardDoneAt + ` AS done_at
+	    FROM cards c JOIN lists cl ON cl.id = c.list_id
+	    WHERE c.sprint_id = $1
+	    UNION ALL
+	    SELECT co.card_id, COALESCE(co.story_points, 0)::float8, NULL::timestamptz
+	    FROM sprint_carryovers co JOIN cards c ON c.id = co.card_id
+	    WHERE co.sprint_id = $1 AND c.sprint_id IS DISTINCT FROM $1`
+
+// sprintFrom joins each sprint s to the stats st of its scope.
+const sprintFrom = `sprints s
+	CROSS JOIN LATERAL (
+	    SELECT COUNT(*) AS cards,
+	           COUNT(*) FILTER (WHERE sc.done) AS done_cards,
+	           COALESCE(SUM(sc.points), 0)::float8 AS points,
+	           COALESCE(SUM(sc.points) FILTER (WHERE sc.done), 0)::float8 AS done_points
+	    FROM (
+	        SELECT c.story_points AS points, c.completed OR LOWER(TRIM(l.title)) = 'done' AS done
+	        FROM cards c JOIN lists l ON l.id = c.list_id
+	        WHERE c.sprint_id = s.id
+	        UNION ALL
+	        SELECT co.story_points, FALSE
+	        FROM sprint_carryovers co JOIN cards c ON c.id = co.card_id
+	        WHERE co.sprint_id = s.id AND c.sprint_id IS DISTINCT FROM s.id
+	    ) sc
+	) st`
+
+func scanSprint(row interface{ Scan(...interface{}) error }) (*Sprint, error) {
+	var sp Sprint
+	var closedAt sql.NullTime
+	err := row.Scan(&sp.ID, &sp.BoardID, &sp.Name, &sp.Goal, &sp.StartDate, &sp.EndDate,
+		&sp.State, &closedAt, &sp.CreatedAt, &sp.Cards, &sp.DoneCards, &sp.Points, &sp.DonePoints)
+	if err != nil {
+		return nil, err
+	}
+	if closedAt.Valid {
+		sp.ClosedAt = &closedAt.Time
+	}
+	return &sp, nil
+}
+
+func (s *SprintService) CreateSprint(boardID int, name, goal, startDate, endDate string) (*Sprint, error) {
+	var id int
+	err := s.DB.QueryRow(
+		"INSERT INTO sprints (board_id, name, goal, start_date, end_date) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		boardID, name, goal, startDate, endDate,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSprintByID(id)
+}
+
+func (s *SprintService) GetSprintByID(id int) (*Sprint, error) {
+	return scanSprint(s.DB.QueryRow("SELECT "+sprintColumns+" FROM "+sprintFrom+" WHERE s.id = $1", id))
+}
+
+// GetSprintsByBoard lists the board's sprints by start date.
+func (s *SprintService) GetSprintsByBoard(boardID int) ([]Sprint, error) {
+	rows, err := s.DB.Query("SELECT "+sprintColumns+" FROM "+sprintFrom+" WHERE s.board_id = $1 ORDER BY s.start_date, s.id", boardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Sprint
+	for rows.Next() {
+		sp, err := scanSprint(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *sp)
+	}
+	return out, rows.Err()
+}
+
+// NextPlannedSprint returns the board's planned sprint starting first, other than exceptID, or
+// nil when there is none.
+func (s *SprintService) NextPlannedSprint(boardID, exceptID int) (*Sprint, error) {
+	sprints, err := s.GetSprintsByBoard(boardID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sprints {
+		if sprints[i].State == SprintPlanned && sprints[i].ID != exceptID {
+			return &sprints[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *SprintService) UpdateSprint(id int, name, goal, startDate, endDate string) (*Sprint, error) {
+	_, err := s.DB.Exec("UPDATE sprints SET name = $2, goal = $3, start_date = $4, end_date = $5 WHERE id = $1", id, name, goal, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSprintByID(id)
+}
+
+// SetState moves the sprint to state, stamping closed_at when it closes.
+func (s *SprintService) SetState(id int, state SprintState) error {
+	_, err := s.DB.Exec(
+		"UPDATE sprints SET state = $2, closed_at = CASE WHEN $2 = 'closed' THEN NOW() END WHERE id = $1",
+		id, string(state),
+	)
+	if isUniqueViolation(err) {
+		return ErrSprintActive
+	}
+	return err
+}
+
+// CarryOver moves the sprint's unfinished cards to the sprint toID, or to the backlog when it
+// is nil, and returns their ids. It records them in sprint_carryovers with their estimates, so
+// the sprint keeps them in its scope once closed.
+func (s *SprintService) CarryOver(id int, toID *int) ([]int, error) {
+	rows, err := s.DB.Query(`
+		WITH moved AS (
+		    UPDATE cards c SET sprint_id = $2
+		    FROM lists l
+		    WHERE l.id = c.list_id AND c.sprint_id = $1 AND NOT c.completed AND LOWER(TRIM(l.title)) <> 'done'
+		    RETURNING c.id, c.story_points
+		)
+		INSERT INTO sprint_carryovers (sprint_id, card_id, story_points)
+		SELECT $1, id, story_points FROM moved
+		ON CONFLICT (sprint_id, card_id) DO UPDATE SET story_points = EXCLUDED.story_points
+		RETURNING card_id
+	`, id, toID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var cardID int
+		if err := rows.Scan(&cardID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, cardID)
+	}
+	return ids, rows.Err()
+}
+
+// DeleteSprint removes the sprint; its cards go back to the backlog.
+func (s *SprintService) DeleteSprint(id int) error {
+	_, err := s.DB.Exec("DELETE FROM sprints WHERE id = $1", id)
+	return err
+}
+
+// Progress measures the sprint's scope (see sprintScope) at each of dayEnds, using when each card
+// was done (see cardDoneAt). Cards without an estimate count for no points.
+func (s *SprintService) Progress(id int, dayEnds []time.Time) (*SprintProgress, error) {
+	ends := make([]string, len(dayEnds))
+	for i, t := range dayEnds {
+		ends[i] = t.UTC().Format(time.RFC3339)
+	}
+	rows, err := s.DB.Query(`
+		WITH scope AS (`+sprintScope+`
+		),
+		days AS (SELECT day_end, ord FROM unnest($2::timestamptz[]) WITH ORDINALITY AS d(day_end, ord))
+		SELECT d.ord, (SELECT COUNT(*) FROM scope), (SELECT COALESCE(SUM(points), 0) FROM scope),
+		       COUNT(sc.id), COALESCE(SUM(sc.points), 0)
+		FROM days d
+		LEFT JOIN scope sc ON sc.done_at < d.day_end
+		GROUP BY d.ord
+		ORDER BY d.ord
+	`, id, pq.Array(ends))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	p := &SprintProgress{DoneCards: make([]int, len(dayEnds)), DonePoints: make([]float64, len(dayEnds))}
+	for rows.Next() {
+		var ord, done int
+		var donePoints float64
+		if err := rows.Scan(&ord, &p.TotalCards, &p.TotalPoints, &done, &donePoints); err != nil {
+			return nil, err
+		}
+		p.DoneCards[ord-1], p.DonePoints[ord-1] = done, donePoints
+	}
+	return p, rows.Err()
+}
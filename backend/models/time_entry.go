@@ -0,0 +1,166 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// TimeEntry is time a user spent on a card, from a timer or entered by hand. EndedAt is nil
+// while the timer runs, and Seconds then counts up to now.
+type TimeEntry struct {
+	ID        int        `json:"id"`
+	CardID    int        `json:"card_id"`
+	UserID    int        `json:"user_id"`
+	UserEmail string     `json:"user_email"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Seconds   int        `json:"seconds"`
+	Note      string     `json:"note"`
+	Manual    bool       `json:"manual"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TimesheetRow is the time a user logged on one card of a board.
+type TimesheetRow struct {
+	UserID    int
+	Email     string
+	CardID    int
+	CardTitle string
+	ListTitle string
+	Entries   int
+	Seconds   int
+}
+
+// ErrTimerRunning is returned when starting a timer while the user already has one running.
+var ErrTimerRunning = errors.New("you already have a running timer; stop it first")
+
+type TimeEntryService struct{ DB DBTX }
+
+const timeEntryColumns = `t.id, t.card_id, t.user_id, u.email, t.started_at, t.ended_at,
+	EXTRACT(EPOCH FROM COALESCE(t.ended_at, NOW()) - t.started_at)::int, t.note, t.manual, t.created_at`
+
+const timeEntryFrom = `time_entries t JOIN users u ON u.id = t.user_id`
+
+func scanTimeEntry(row interface{ Scan(...interface{}) error }) (*TimeEntry, error) {
+	var e TimeEntry
+	var endedAt sql.NullTime
+	err := row.Scan(&e.ID, &e.CardID, &e.UserID, &e.UserEmail, &e.StartedAt, &endedAt, &e.Seconds, &e.Note, &e.Manual, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if endedAt.Valid {
+		e.EndedAt = &endedAt.Time
+	}
+	return &e, nil
+}
+
+// StartTimer starts a timer for the user on the card. A user runs one timer at a time.
+func (s *TimeEntryService) StartTimer(cardID, userID int) (*TimeEntry, error) {
+	var id int
+	err := s.DB.QueryRow(
+		"INSERT INTO time_entries (card_id, user_id, started_at) VALUES ($1, $2, NOW()) RETURNING id",
+		cardID, userID,
+	).Scan(&id)
+	if isUniqueViolation(err) {
+		return nil, ErrTimerRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetEntryByID(id)
+}
+
+// RunningTimer returns the user's running timer, or sql.ErrNoRows when there is none.
+func (s *TimeEntryService) RunningTimer(userID int) (*TimeEntry, error) {
+	return scanTimeEntry(s.DB.QueryRow("SELECT "+timeEntryColumns+" FROM "+timeEntryFrom+" WHERE t.user_id = $1 AND t.ended_at IS NULL", userID))
+}
+
+// StopTimer stops a running timer now.
+func (s *TimeEntryService) StopTimer(id int) (*TimeEntry, error) {
+	_, err := s.DB.Exec("UPDATE time_entries SET ended_at = GREATEST(NOW(), started_at) WHERE id = $1 AND ended_at IS NULL", id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetEntryByID(id)
+}
+
+// CreateEntry records time entered by hand.
+func (s *TimeEntryService) CreateEntry(cardID, userID int, startedAt, endedAt time.Time, note string) (*TimeEntry, error) {
+	var id int
+	err := s.DB.QueryRow(
+		"INSERT INTO time_entries (card_id, user_id, started_at, ended_at, note, manual) VALUES ($1, $2, $3, $4, $5, TRUE) RETURNING id",
+		cardID, userID, startedAt, endedAt, note,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetEntryByID(id)
+}
+
+func (s *TimeEntryService) GetEntryByID(id int) (*TimeEntry, error) {
+	return scanTimeEntry(s.DB.QueryRow("SELECT "+timeEntryColumns+" FROM "+timeEntryFrom+" WHERE t.id = $1", id))
+}
+
+// GetEntriesByCard lists the card's entries, latest first.
+func (s *TimeEntryService) GetEntriesByCard(cardID int) ([]TimeEntry, error) {
+	rows, err := s.DB.Query("SELECT "+timeEntryColumns+" FROM "+timeEntryFrom+" WHERE t.card_id = $1 ORDER BY t.started_at DESC, t.id DESC", cardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TimeEntry
+	for rows.Next() {
+		e, err := scanTimeEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *e)
+	}
+	return out, rows.Err()
+}
+
+// UpdateEntry changes an entry's times and note. endedAt is nil only for a running timer.
+func (s *TimeEntryService) UpdateEntry(id int, startedAt time.Time, endedAt *time.Time, note string) (*TimeEntry, error) {
+	_, err := s.DB.Exec("UPDATE time_entries SET started_at = $2, ended_at = $3, note = $4 WHERE id = $1", id, startedAt, endedAt, note)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetEntryByID(id)
+}
+
+func (s *TimeEntryService) DeleteEntry(id int) error {
+	_, err := s.DB.Exec("DELETE FROM time_entries WHERE id = $1", id)
+	return err
+}
+
+// Timesheet sums the time logged on the board's cards per user and card, over the entries
+// started within [from, to). Running timers count up to now.
+func (s *TimeEntryService) Timesheet(boardID int, from, to time.Time) ([]TimesheetRow, error) {
+	rows, err := s.DB.Query(`
+		SELECT u.id, u.email, c.id, c.title, l.title, COUNT(t.id),
+		       SUM(EXTRACT(EPOCH FROM COALESCE(t.ended_at, NOW()) - t.started_at))::bigint
+		FROM time_entries t
+		JOIN users u ON u.id = t.user_id
+		JOIN cards c ON c.id = t.card_id
+		JOIN lists l ON l.id = c.list_id
+		WHERE l.board_id = $1 AND t.started_at >= $2 AND t.started_at < $3
+		GROUP BY u.id, c.id, l.id
+		ORDER BY u.email, l.position, c.position, c.id
+	`, boardID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TimesheetRow
+	for rows.Next() {
+		var row TimesheetRow
+		if err := rows.Scan(&row.UserID, &row.Email, &row.CardID, &row.CardTitle, &row.ListTitle, &row.Entries, &row.Seconds); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
@@ -1,7 +1,6 @@
 package models
 
 import (
-	"database/sql"
 	"time"
 )
 
@@ -12,7 +11,7 @@ type User struct {
 }
 
 type UserService struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (us *UserService) CreateUser(email, passwordHash string) (*User, error) {
@@ -0,0 +1,267 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+type Webhook struct {
+	ID        int          `json:"id"`
+	BoardID   int          `json:"board_id"`
+	URL       string       `json:"url"`
+	Secret    string       `json:"secret,omitempty"`
+	Events    []ActionType `json:"events"`
+	Active    bool         `json:"active"`
+	CreatedBy int          `json:"created_by"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	ActivityID     *int            `json:"activity_id"`
+	Event          ActionType      `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+
+	// Filled in when a worker claims the delivery.
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type WebhookService struct {
+	DB DBTX
+}
+
+func (s *WebhookService) CreateWebhook(boardID, createdBy int, url, secret string, events []ActionType) (*Webhook, error) {
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(b)
+	}
+	var id int
+	err := s.DB.QueryRow(
+		`INSERT INTO webhooks (board_id, url, secret, events, created_by) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		boardID, url, secret, pq.Array(actionStrings(events)), createdBy,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.GetWebhookByID(id)
+	if err != nil {
+		return nil, err
+	}
+	w.Secret = secret
+	return w, nil
+}
+
+// GetWebhookByID never exposes the secret; it is only returned once, on creation.
+func (s *WebhookService) GetWebhookByID(id int) (*Webhook, error) {
+	var w Webhook
+	var events []string
+	err := s.DB.QueryRow(
+		"SELECT id, board_id, url, events, active, COALESCE(created_by, 0), created_at FROM webhooks WHERE id = $1",
+		id,
+	).Scan(&w.ID, &w.BoardID, &w.URL, pq.Array(&events), &w.Active, &w.CreatedBy, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	w.Events = toActionTypes(events)
+	return &w, nil
+}
+
+func (s *WebhookService) GetWebhooksByBoard(boardID int) ([]Webhook, error) {
+	rows, err := s.DB.Query(
+		"SELECT id, board_id, url, events, active, COALESCE(created_by, 0), created_at FROM webhooks WHERE board_id = $1 ORDER BY id",
+		boardID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Webhook
+	for rows.Next() {
+		var w Webhook
+		var events []string
+		if err := rows.Scan(&w.ID, &w.BoardID, &w.URL, pq.Array(&events), &w.Active, &w.CreatedBy, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		w.Events = toActionTypes(events)
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+func (s *WebhookService) DeleteWebhook(boardID, id int) (bool, error) {
+	res, err := s.DB.Exec("DELETE FROM webhooks WHERE id = $1 AND board_id = $2", id, boardID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Enqueue queues a delivery of the activity for every active webhook on its board whose
+// event filter is empty or contains the activity's action type.
+func (s *WebhookService) Enqueue(a *Activity) error {
+	if a.BoardID == nil {
+		return nil
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"event":    a.ActionType,
+		"activity": a,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(`
+		INSERT INTO webhook_deliveries (webhook_id, activity_id, event, payload)
+		SELECT w.id, $1, $2, $3 FROM webhooks w
+		WHERE w.board_id = $4 AND w.active AND (cardinality(w.events) = 0 OR $2 = ANY(w.events))
+	`, a.ID, string(a.ActionType), body, *a.BoardID)
+	return err
+}
+
+const deliveryColumns = `d.id, d.webhook_id, d.activity_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at,
+	d.last_status_code, COALESCE(d.last_error,''), d.delivered_at, d.created_at`
+
+func scanDelivery(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var activityID, statusCode sql.NullInt64
+	var nextAttempt, deliveredAt sql.NullTime
+	var payload []byte
+	dest := []interface{}{&d.ID, &d.WebhookID, &activityID, &d.Event, &payload, &d.Status, &d.Attempts, &nextAttempt,
+		&statusCode, &d.LastError, &deliveredAt, &d.CreatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	d.ActivityID = nullIntPtr(activityID)
+	d.LastStatusCode = nullIntPtr(statusCode)
+	d.Payload = payload
+	if nextAttempt.Valid {
+		d.NextAttemptAt = &nextAttempt.Time
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
+
+func (s *WebhookService) GetDeliveriesByWebhook(webhookID, limit, offset int) ([]WebhookDelivery, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries d
+		WHERE d.webhook_id = $1
+		ORDER BY d.id DESC
+		LIMIT $2 OFFSET $3
+	`, webhookID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+// ClaimDue leases up to limit due deliveries for the given duration. Rows leased by another
+// worker are skipped, so replicas never send the same delivery concurrently.
+func (s *WebhookService) ClaimDue(limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	rows, err := s.DB.Query(`
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			  AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d SET locked_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+		FROM due, webhooks w
+		WHERE d.id = due.id AND w.id = d.webhook_id
+		RETURNING `+deliveryColumns+`, w.url, w.secret
+	`, limit, int(lease/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WebhookDelivery
+	for rows.Next() {
+		var url, secret string
+		d, err := scanDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, err
+		}
+		d.URL, d.Secret = url, secret
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+func (s *WebhookService) MarkDelivered(id, statusCode int) error {
+	_, err := s.DB.Exec(`
+		UPDATE webhook_deliveries SET status = 'delivered', attempts = attempts + 1, last_status_code = $2,
+		  last_error = NULL, delivered_at = CURRENT_TIMESTAMP, next_attempt_at = NULL, locked_until = NULL
+		WHERE id = $1
+	`, id, statusCode)
+	return err
+}
+
+// MarkFailed records a failed attempt and schedules a retry at next, or dead-letters the
+// delivery when next is nil.
+func (s *WebhookService) MarkFailed(id int, statusCode *int, errMsg string, next *time.Time) error {
+	status := DeliveryPending
+	if next == nil {
+		status = DeliveryDead
+	}
+	_, err := s.DB.Exec(`
+		UPDATE webhook_deliveries SET status = $2, attempts = attempts + 1, last_status_code = $3,
+		  last_error = $4, next_attempt_at = $5, locked_until = NULL
+		WHERE id = $1
+	`, id, status, statusCode, errMsg, next)
+	return err
+}
+
+func actionStrings(actions []ActionType) []string {
+	out := make([]string, len(actions))
+	for i, a := range actions {
+		out[i] = string(a)
+	}
+	return out
+}
+
+func toActionTypes(values []string) []ActionType {
+	out := make([]ActionType, len(values))
+	for i, v := range values {
+		out[i] = ActionType(v)
+	}
+	return out
+}
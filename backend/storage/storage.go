@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when no blob exists under the key.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps immutable blobs under opaque keys. Keys are made of lowercase letters,
+// digits, '-' and '_' so they map onto file names and object keys alike; the attachment
+// code uses content hashes, which makes identical uploads share one blob.
+// Implementations must be safe for concurrent use.
+type BlobStore interface {
+	Put(key string, r io.Reader) error
+	Get(key string) (io.ReadCloser, error)
+	Exists(key string) (bool, error)
+	Delete(key string) error
+}
+
+// FromEnv builds the store selected by STORAGE_BACKEND. Only "local" exists today; an
+// S3-compatible store would be another case here.
+func FromEnv() (BlobStore, error) {
+	switch backend := getEnv("STORAGE_BACKEND", "local"); backend {
+	case "local":
+		return NewLocalStore(getEnv("STORAGE_DIR", "data/attachments"))
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+}
+
+func validKey(key string) bool {
+	if len(key) < 4 {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func getEnv(key, fallback string) string {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	return value
+}
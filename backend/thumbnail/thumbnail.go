@@ -0,0 +1,150 @@
+// Package thumbnail renders small previews of PNG, JPEG and GIF images using only the
+// standard library.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder; PNG and JPEG are imported for encoding
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Size is a fixed thumbnail box. Images are scaled to cover the box and centre-cropped.
+type Size struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+var (
+	// Small is used in attachment lists.
+	Small = Size{Name: "small", Width: 96, Height: 96}
+	// Cover is the card cover shown on the board.
+	Cover = Size{Name: "cover", Width: 320, Height: 180}
+
+	Sizes = []Size{Small, Cover}
+)
+
+// MaxPixels bounds the decoded source so a small file cannot expand into gigabytes of memory.
+const MaxPixels = 40_000_000
+
+// ErrTooLarge is returned for images whose dimensions exceed MaxPixels.
+var ErrTooLarge = errors.New("image is too large to thumbnail")
+
+// SizeByName returns the size with the given name.
+func SizeByName(name string) (Size, bool) {
+	for _, s := range Sizes {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Size{}, false
+}
+
+// Supported reports whether thumbnails can be made for the MIME type.
+func Supported(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Generate decodes the image read from r and renders it at each of sizes. Opaque results
+// are encoded as JPEG and the others as PNG; the returned content types match the slices.
+func Generate(r io.ReadSeeker, sizes ...Size) ([][]byte, []string, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, nil, ErrTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := make([][]byte, len(sizes))
+	types := make([]string, len(sizes))
+	for i, size := range sizes {
+		thumb := resize(src, size)
+		var buf bytes.Buffer
+		types[i] = "image/png"
+		if thumb.Opaque() {
+			types[i] = "image/jpeg"
+			err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, thumb)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		out[i] = buf.Bytes()
+	}
+	return out, types, nil
+}
+
+// resize crops the centre of src to the aspect ratio of size and box-filters it down (or
+// up) to the exact size.
+func resize(src image.Image, size Size) *image.RGBA {
+	b := src.Bounds()
+	cropW, cropH := b.Dx(), b.Dy()
+	if cropW*size.Height > cropH*size.Width {
+		cropW = cropH * size.Width / size.Height
+	} else {
+		cropH = cropW * size.Height / size.Width
+	}
+	if cropW < 1 {
+		cropW = 1
+	}
+	if cropH < 1 {
+		cropH = 1
+	}
+	origin := image.Pt(b.Min.X+(b.Dx()-cropW)/2, b.Min.Y+(b.Dy()-cropH)/2)
+
+	// Copy the crop into premultiplied RGBA first: draw has fast paths for the decoders'
+	// image types, and averaging premultiplied values keeps transparent edges clean.
+	crop := image.NewRGBA(image.Rect(0, 0, cropW, cropH))
+	draw.Draw(crop, crop.Bounds(), src, origin, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size.Width, size.Height))
+	for dy := 0; dy < size.Height; dy++ {
+		y0 := dy * cropH / size.Height
+		y1 := (dy + 1) * cropH / size.Height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for dx := 0; dx < size.Width; dx++ {
+			x0 := dx * cropW / size.Width
+			x1 := (dx + 1) * cropW / size.Width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, a, n uint32
+			for y := y0; y < y1; y++ {
+				row := crop.Pix[y*crop.Stride+x0*4 : y*crop.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint32(row[i])
+					g += uint32(row[i+1])
+					bl += uint32(row[i+2])
+					a += uint32(row[i+3])
+					n++
+				}
+			}
+			o := dst.PixOffset(dx, dy)
+			dst.Pix[o] = uint8(r / n)
+			dst.Pix[o+1] = uint8(g / n)
+			dst.Pix[o+2] = uint8(bl / n)
+			dst.Pix[o+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
@@ -214,6 +214,7 @@ function App() {
             path="/user/settings"
             element={
               <SettingsPage
+                authToken={authTokenState}
                 user={user}
                 theme={theme}
                 onToggleTheme={toggleTheme}
@@ -602,8 +603,11 @@ function BoardsIndexPage({ authToken, boards, setBoards, user }) {
   );
 }
 
+const templateColorClasses = ['template-card--purple', 'template-card--teal', 'template-card--orange', 'template-card--cyan'];
+
 function TemplatesGalleryPage({ authToken }) {
   const navigate = useNavigate();
+  const [templates, setTemplates] = useState([]);
   const [error, setError] = useState(null);
   const [creating, setCreating] = useState(false);
   const [namingTemplate, setNamingTemplate] = useState(null);
@@ -621,7 +625,7 @@ function TemplatesGalleryPage({ authToken }) {
     }
     try {
       setCreating(true);
-      const board = await api.createBoard(name, authToken);
+      const board = await api.createBoard(name, authToken, namingTemplate);
       navigate(`/user/boards/${board.id}`);
     } catch {
       setError('Unable to create board from template.');
@@ -630,8 +634,20 @@ function TemplatesGalleryPage({ authToken }) {
     }
   };
 
+  useEffect(() => {
+    if (!authToken) return;
+    api.getTemplates(authToken)
+      .then((list) => setTemplates(list.map((tpl, i) => ({
+        id: tpl.id,
+        title: tpl.name,
+        desc: tpl.description || `${tpl.content.lists.length} lists`,
+        colorClass: templateColorClasses[i % templateColorClasses.length],
+      }))))
+      .catch(() => setError('Unable to load templates.'));
+  }, [authToken]);
+
   const handleStartNaming = (tpl) => {
-    setNamingTemplate(tpl.title);
+    setNamingTemplate(tpl.id);
     setBoardName(tpl.title);
     setError(null);
   };
@@ -642,13 +658,6 @@ function TemplatesGalleryPage({ authToken }) {
     setError(null);
   };
 
-  const templates = [
-    { title: 'Kanban', desc: 'Ideas → Doing → Review → Done', colorClass: 'template-card--purple' },
-    { title: 'Sprint Planning', desc: 'Backlog → Sprint → QA → Retro', colorClass: 'template-card--teal' },
-    { title: 'Bug Triage', desc: 'New → Investigating → Fixing → Release', colorClass: 'template-card--orange' },
-    { title: 'Personal Tasks', desc: 'Today → This week → Someday', colorClass: 'template-card--cyan' },
-  ];
-
   return (
     <>
       <PageHeader
@@ -667,14 +676,14 @@ function TemplatesGalleryPage({ authToken }) {
         <div className="templates-gallery">
           {templates.map((tpl) => (
             <div
-              key={tpl.title}
+              key={tpl.id}
               className={`template-gallery-card ${tpl.colorClass}`}
             >
               <div className="template-gallery-card__content">
                 <h3>{tpl.title}</h3>
                 <p>{tpl.desc}</p>
               </div>
-              {namingTemplate === tpl.title ? (
+              {namingTemplate === tpl.id ? (
                 <div className="template-naming">
                   <input
                     className="template-naming__input"
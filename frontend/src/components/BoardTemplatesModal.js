@@ -2,54 +2,8 @@ import React from 'react';
 import Icon from './Icon';
 import './BoardTemplatesModal.css';
 
-const templates = [
-  {
-    key: 'kanban',
-    name: 'Kanban',
-    description: 'Ideas → In Progress → Review → Done',
-    columns: [
-      { title: 'Ideas', accent: 'accent', cards: [] },
-      { title: 'In Progress', accent: 'primary', cards: [] },
-      { title: 'Review', accent: 'warning', cards: [] },
-      { title: 'Done', accent: 'success', cards: [] },
-    ],
-  },
-  {
-    key: 'scrum',
-    name: 'Scrum',
-    description: 'Backlog → In Progress → Review → Done',
-    columns: [
-      { title: 'Backlog', accent: 'accent', cards: [] },
-      { title: 'In Progress', accent: 'primary', cards: [] },
-      { title: 'Review', accent: 'warning', cards: [] },
-      { title: 'Done', accent: 'success', cards: [] },
-    ],
-  },
-  {
-    key: 'personal',
-    name: 'Personal Tasks',
-    description: 'To do → Doing → Done',
-    columns: [
-      { title: 'To do', accent: 'accent', cards: [] },
-      { title: 'Doing', accent: 'primary', cards: [] },
-      { title: 'Done', accent: 'success', cards: [] },
-    ],
-  },
-  {
-    key: 'bugs',
-    name: 'Bug Tracker',
-    description: 'New → Investigating → Fix → QA → Closed',
-    columns: [
-      { title: 'New', accent: 'accent', cards: [] },
-      { title: 'Investigating', accent: 'primary', cards: []},
-      { title: 'Fix in Progress', accent: 'primary', cards: []},
-      { title: 'QA', accent: 'warning', cards: []},
-      { title: 'Closed', accent: 'success', cards: []},
-    ],
-  },
-];
-
-const BoardTemplatesModal = ({ open, onClose, onSelect }) => {
+// templates come from GET /api/templates: built-in ones first, then the user's own.
+const BoardTemplatesModal = ({ open, templates = [], onClose, onSelect }) => {
   if (!open) return null;
 
   return (
@@ -64,7 +18,7 @@ const BoardTemplatesModal = ({ open, onClose, onSelect }) => {
         <div className="btm-grid">
           {templates.map((tpl) => (
             <button
-              key={tpl.key}
+              key={tpl.id}
               type="button"
               className="btm-tile"
               onClick={() => onSelect?.(tpl)}
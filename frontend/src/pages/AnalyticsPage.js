@@ -30,56 +30,19 @@ function AnalyticsPage({ authToken }) {
 
         (async () => {
             try {
-                const data = await api.getBoards(authToken);
+                const data = await api.getAnalyticsOverview(authToken);
                 if (!cancelled) {
-
-                    let perBoardProgress = [];
-                    let totalLists = 0;
-                    let totalCards = 0;
-                    let completedCards = 0;
-
-                    const boardDetails = await Promise.all(
-                        (data || []).map(board =>
-                            api.getBoard(board.id, authToken).catch(() => null)
-                        )
-                    );
-
-                    boardDetails.forEach(board => {
-                        if (board && board.lists) {
-                            totalLists += board.lists.length;
-                            let boardCards = 0;
-                            let boardDone = 0;
-                            board.lists.forEach(list => {
-                                if (list.cards) {
-                                    totalCards += list.cards.length;
-                                    boardCards += list.cards.length;
-                                    if (list.title.toLowerCase().includes('done') ||
-                                        list.title.toLowerCase().includes('complete')) {
-                                        completedCards += list.cards.length;
-                                        boardDone += list.cards.length;
-                                    }
-                                }
-                            });
-                            const progress = boardCards > 0 ? Math.round((boardDone / boardCards) * 100) : 0;
-                            perBoardProgress.push({
-                                id: board.id || board.ID,
-                                name: board.title,
-                                progress,
-                            });
-                        }
-                    });
-
-                    const averageProgress = totalCards > 0
-                        ? Math.round((completedCards / totalCards) * 100)
-                        : 0;
-
-                    setBoardProgressData(perBoardProgress);
+                    setBoardProgressData((data.boards || []).map(board => ({
+                        id: board.board_id,
+                        name: board.title,
+                        progress: board.completion_percent,
+                    })));
                     setStats({
-                        totalBoards: data?.length || 0,
-                        totalLists,
-                        totalCards,
-                        completedCards,
-                        averageProgress,
+                        totalBoards: data.total_boards,
+                        totalLists: data.total_lists,
+                        totalCards: data.cards,
+                        completedCards: data.done,
+                        averageProgress: data.completion_percent,
                     });
                 }
             } catch (e) {
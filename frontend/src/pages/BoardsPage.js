@@ -1,7 +1,7 @@
 import { useEffect, useState, useCallback, useRef } from 'react';
 import { useNavigate, useParams } from 'react-router-dom';
 import { DragDropContext, Droppable, Draggable } from '@hello-pangea/dnd';
-import { api } from '../services/api';
+import { api, apiUrl } from '../services/api';
 import ShareBoardModal from '../components/ShareBoardModal';
 import { Button } from '../components/ui/Button';
 import { Badge } from '../components/ui/Badge';
@@ -104,6 +104,7 @@ function ensureIds(cols) {
         tags: card.tags || [],
         members: card.members || [],
         due_date: card.due_date || null,
+        cover: card.cover || null,
       })),
     };
   });
@@ -586,6 +587,18 @@ export default function BoardsPage({ authToken, user }) {
                                         {...cardProvided.dragHandleProps}
                                         style={cardProvided.draggableProps.style}
                                       >
+                                        {card.cover && (
+                                          <div className={`board-card__cover board-card__cover--${card.cover.color}`}>
+                                            {card.cover.type === 'image' && (
+                                              <img
+                                                src={apiUrl(card.cover.thumbnail_url)}
+                                                alt=""
+                                                loading="lazy"
+                                                onError={(e) => { e.currentTarget.style.display = 'none'; }}
+                                              />
+                                            )}
+                                          </div>
+                                        )}
                                         <div className="board-card__header">
                                           <Badge
                                             variant={card.color || col.accent}
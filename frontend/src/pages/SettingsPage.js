@@ -1,16 +1,17 @@
-import React, { useState } from 'react';
+import React, { useState, useEffect } from 'react';
 import { PageHeader, PageContent } from '../components/layout/MainLayout';
 import { Card, CardContent, CardHeader, CardTitle, CardDescription } from '../components/ui/Card';
 import { Button } from '../components/ui/Button';
 import { Input } from '../components/ui/Input';
 import { Avatar } from '../components/ui/Avatar';
 import { UserIcon, PaletteIcon, BellIcon, ShieldIcon, MonitorIcon, SunIcon, MoonIcon, CheckIcon } from '../components/ui/Icons';
+import { api } from '../services/api';
 import './SettingsPage.css';
 
 /**
  * Settings Page - User preferences and account settings
  */
-function SettingsPage({ user, theme, onToggleTheme, onLogout }) {
+function SettingsPage({ authToken, user, theme, onToggleTheme, onLogout }) {
     const [activeTab, setActiveTab] = useState('profile');
     const [saving, setSaving] = useState(false);
     const [saved, setSaved] = useState(false);
@@ -19,6 +20,47 @@ function SettingsPage({ user, theme, onToggleTheme, onLogout }) {
     const [displayName, setDisplayName] = useState(user?.email?.split('@')[0] || '');
     const [email] = useState(user?.email || '');
 
+    // Notification preferences, persisted server-side
+    const [notificationPrefs, setNotificationPrefs] = useState({
+        email_enabled: true,
+        digest_frequency: 'daily',
+        card_assigned: true,
+        board_invite: true,
+        card_comment: true,
+        due_reminder: true,
+    });
+
+    useEffect(() => {
+        if (!authToken) return;
+        let cancelled = false;
+        api.getNotificationPreferences(authToken)
+            .then((prefs) => { if (!cancelled) setNotificationPrefs(prefs); })
+            .catch(() => {});
+        return () => { cancelled = true; };
+    }, [authToken]);
+
+    const handleTogglePreference = async (key) => {
+        const next = { ...notificationPrefs, [key]: !notificationPrefs[key] };
+        setNotificationPrefs(next);
+        try {
+            const saved = await api.updateNotificationPreferences({ [key]: next[key] }, authToken);
+            setNotificationPrefs(saved);
+        } catch (e) {
+            setNotificationPrefs(notificationPrefs);
+        }
+    };
+
+    const handleDigestFrequencyChange = async (value) => {
+        const previous = notificationPrefs;
+        setNotificationPrefs({ ...notificationPrefs, digest_frequency: value });
+        try {
+            const saved = await api.updateNotificationPreferences({ digest_frequency: value }, authToken);
+            setNotificationPrefs(saved);
+        } catch (e) {
+            setNotificationPrefs(previous);
+        }
+    };
+
     const handleSaveProfile = async () => {
         setSaving(true);
         // Simulate API call
@@ -201,18 +243,58 @@ function SettingsPage({ user, theme, onToggleTheme, onLogout }) {
                                                     <p>Receive updates about board activity via email</p>
                                                 </div>
                                                 <label className="toggle-switch">
-                                                    <input type="checkbox" defaultChecked />
+                                                    <input
+                                                        type="checkbox"
+                                                        checked={!!notificationPrefs.email_enabled}
+                                                        onChange={() => handleTogglePreference('email_enabled')}
+                                                    />
                                                     <span className="toggle-switch__slider" />
                                                 </label>
                                             </div>
 
+                                            <div className="notification-option">
+                                                <div className="notification-option__info">
+                                                    <strong>Email digest</strong>
+                                                    <p>How often unread notifications are bundled into an email</p>
+                                                </div>
+                                                <select
+                                                    className="notification-option__select"
+                                                    value={notificationPrefs.digest_frequency || 'daily'}
+                                                    disabled={!notificationPrefs.email_enabled}
+                                                    onChange={(e) => handleDigestFrequencyChange(e.target.value)}
+                                                >
+                                                    <option value="hourly">Hourly</option>
+                                                    <option value="daily">Daily</option>
+                                                    <option value="off">Off</option>
+                                                </select>
+                                            </div>
+
                                             <div className="notification-option">
                                                 <div className="notification-option__info">
                                                     <strong>Card assignments</strong>
                                                     <p>Get notified when you're assigned to a card</p>
                                                 </div>
                                                 <label className="toggle-switch">
-                                                    <input type="checkbox" defaultChecked />
+                                                    <input
+                                                        type="checkbox"
+                                                        checked={!!notificationPrefs.card_assigned}
+                                                        onChange={() => handleTogglePreference('card_assigned')}
+                                                    />
+                                                    <span className="toggle-switch__slider" />
+                                                </label>
+                                            </div>
+
+                                            <div className="notification-option">
+                                                <div className="notification-option__info">
+                                                    <strong>Board invitations</strong>
+                                                    <p>Get notified when you're invited to a board</p>
+                                                </div>
+                                                <label className="toggle-switch">
+                                                    <input
+                                                        type="checkbox"
+                                                        checked={!!notificationPrefs.board_invite}
+                                                        onChange={() => handleTogglePreference('board_invite')}
+                                                    />
                                                     <span className="toggle-switch__slider" />
                                                 </label>
                                             </div>
@@ -220,10 +302,14 @@ function SettingsPage({ user, theme, onToggleTheme, onLogout }) {
                                             <div className="notification-option">
                                                 <div className="notification-option__info">
                                                     <strong>Comments & mentions</strong>
-                                                    <p>Get notified when someone mentions you</p>
+                                                    <p>Get notified when someone comments on your cards</p>
                                                 </div>
                                                 <label className="toggle-switch">
-                                                    <input type="checkbox" defaultChecked />
+                                                    <input
+                                                        type="checkbox"
+                                                        checked={!!notificationPrefs.card_comment}
+                                                        onChange={() => handleTogglePreference('card_comment')}
+                                                    />
                                                     <span className="toggle-switch__slider" />
                                                 </label>
                                             </div>
@@ -234,7 +320,11 @@ function SettingsPage({ user, theme, onToggleTheme, onLogout }) {
                                                     <p>Receive reminders before cards are due</p>
                                                 </div>
                                                 <label className="toggle-switch">
-                                                    <input type="checkbox" />
+                                                    <input
+                                                        type="checkbox"
+                                                        checked={!!notificationPrefs.due_reminder}
+                                                        onChange={() => handleTogglePreference('due_reminder')}
+                                                    />
                                                     <span className="toggle-switch__slider" />
                                                 </label>
                                             </div>
@@ -68,19 +68,59 @@ export const api = {
     return response.json();
   },
 
-  async createBoard(title, token) {
+  async createBoard(title, token, templateId) {
     const response = await fetch(`${API_URL}/boards`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
         'Authorization': `Bearer ${token}`
       },
-      body: JSON.stringify({ title })
+      body: JSON.stringify({ title, template_id: templateId })
     });
     if (!response.ok) throw new Error('Failed to create board');
     return response.json();
   },
 
+  async getTemplates(token) {
+    const response = await fetch(`${API_URL}/templates`, {
+      headers: { 'Authorization': `Bearer ${token}` }
+    });
+    if (!response.ok) throw new Error('Failed to fetch templates');
+    return response.json();
+  },
+
+  async saveBoardAsTemplate(boardId, { name, description, includeCards = true }, token) {
+    const response = await fetch(`${API_URL}/boards/${boardId}/save-as-template`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${token}`
+      },
+      body: JSON.stringify({ name, description, include_cards: includeCards })
+    });
+    if (!response.ok) {
+      const err = await response.text().catch(() => 'Failed to save template');
+      throw new Error(err || 'Failed to save template');
+    }
+    return response.json();
+  },
+
+  async getAnalyticsOverview(token) {
+    const response = await fetch(`${API_URL}/analytics/overview`, {
+      headers: { 'Authorization': `Bearer ${token}` }
+    });
+    if (!response.ok) throw new Error('Failed to fetch analytics');
+    return response.json();
+  },
+
+  async getBoardAnalytics(boardId, token) {
+    const response = await fetch(`${API_URL}/boards/${boardId}/analytics`, {
+      headers: { 'Authorization': `Bearer ${token}` }
+    });
+    if (!response.ok) throw new Error('Failed to fetch board analytics');
+    return response.json();
+  },
+
   async getBoard(boardId, token) {
     const response = await fetch(`${API_URL}/boards/${boardId}`, {
       headers: { 'Authorization': `Bearer ${token}` }
@@ -245,6 +285,53 @@ export const api = {
     if (!response.ok) throw new Error('Failed to fetch activities');
     return response.json();
   },
+
+  async getNotifications(token, { unread = false } = {}) {
+    const response = await fetch(`${API_URL}/notifications${unread ? '?unread=true' : ''}`, {
+      headers: { 'Authorization': `Bearer ${token}` }
+    });
+    if (!response.ok) throw new Error('Failed to fetch notifications');
+    return response.json();
+  },
+
+  async markNotificationRead(notificationId, token) {
+    const response = await fetch(`${API_URL}/notifications/${notificationId}/read`, {
+      method: 'POST',
+      headers: { 'Authorization': `Bearer ${token}` },
+    });
+    if (!response.ok) throw new Error('Failed to mark notification as read');
+    return response.json();
+  },
+
+  async markAllNotificationsRead(token) {
+    const response = await fetch(`${API_URL}/notifications/read-all`, {
+      method: 'POST',
+      headers: { 'Authorization': `Bearer ${token}` },
+    });
+    if (!response.ok) throw new Error('Failed to mark notifications as read');
+    return response.json();
+  },
+
+  async getNotificationPreferences(token) {
+    const response = await fetch(`${API_URL}/notifications/preferences`, {
+      headers: { 'Authorization': `Bearer ${token}` }
+    });
+    if (!response.ok) throw new Error('Failed to fetch notification preferences');
+    return response.json();
+  },
+
+  async updateNotificationPreferences(payload, token) {
+    const response = await fetch(`${API_URL}/notifications/preferences`, {
+      method: 'PUT',
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${token}`,
+      },
+      body: JSON.stringify(payload),
+    });
+    if (!response.ok) throw new Error('Failed to update notification preferences');
+    return response.json();
+  },
 };
 
 export const setAuthToken = (token) => {
@@ -258,3 +345,7 @@ export const setAuthToken = (token) => {
 export const getAuthToken = () => {
   return localStorage.getItem('token');
 };
+
+// Paths returned by the API (such as signed thumbnail URLs) start with /api; point them at
+// the configured API_URL so that they work as <img src>.
+export const apiUrl = (path) => path.replace(/^\/api(?=\/)/, API_URL);